@@ -0,0 +1,694 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miguelfrde/image-segmentation/colorspace"
+	"github.com/miguelfrde/image-segmentation/features"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/miguelfrde/image-segmentation/palette"
+	"github.com/miguelfrde/image-segmentation/segmentation"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * Maximum size of the body of an API request
+ */
+const MAX_REQUEST_SIZE = 32 << 20
+
+/**
+ * Maximum time that a synchronous segmentation request can take
+ */
+const SEGMENT_TIMEOUT = 2 * time.Minute
+
+/**
+ * Maximum radius of the neighborhood of a disk graph. Bigger neighborhoods
+ * make graphs that don't fit in memory.
+ */
+const MAX_DISK_RADIUS = 5
+
+/**
+ * Non standard status code used when the client closed the connection
+ * before the segmentation finished
+ */
+const STATUS_CLIENT_CLOSED_REQUEST = 499
+
+/**
+ * Parameters of a segmentation request. They can be sent as a JSON object,
+ * in which case Image is the base64 encoded image, or as multipart form
+ * fields with the image in the "file" field.
+ */
+type segmentParams struct {
+	Image          string   `json:"image,omitempty"`
+	Algorithm      string   `json:"algorithm"`
+	Sigma          float64  `json:"sigma"`
+	K              float64  `json:"k"`
+	MinSize        int      `json:"minsize"`
+	MinWeight      float64  `json:"minweight"`
+	Superpixels    int      `json:"superpixels"`
+	Compactness    float64  `json:"compactness"`
+	Graph          string   `json:"graph"`
+	Radius         float64  `json:"radius"`
+	WeightFn       string   `json:"weightfn"`
+	ColorSpace     string   `json:"colorspace"`
+	Features       []string `json:"features,omitempty"`
+	FeatureWeight  float64  `json:"featureWeight"`
+	Merge          string   `json:"merge,omitempty"`
+	MergeThreshold float64  `json:"mergeThreshold"`
+	MergeSegments  int      `json:"mergeSegments"`
+	Segments       int      `json:"segments,omitempty"`
+	MaxSegments    int      `json:"maxSegments,omitempty"`
+	renderParams
+}
+
+/**
+ * Parameters of how the result images are drawn: the render mode (fill,
+ * boundaries, blend or mask), the color and width of the boundaries, the
+ * opacity of the blended colors, whether the colors are random and the
+ * palette, seed and comma separated custom colors that choose them
+ */
+type renderParams struct {
+	Render        string  `json:"render"`
+	BoundaryColor string  `json:"boundaryColor"`
+	BoundaryWidth int     `json:"boundaryWidth"`
+	Opacity       float64 `json:"opacity"`
+	RandomColors  bool    `json:"randomColors"`
+	Palette       string  `json:"palette"`
+	Seed          int64   `json:"seed"`
+	PaletteColors string  `json:"paletteColors,omitempty"`
+}
+
+/**
+ * Successful response of the segmentation API. Timings are in milliseconds
+ * and indexed by phase name.
+ */
+type segmentResponse struct {
+	Id       string             `json:"id"`
+	Original string             `json:"original"`
+	Result   string             `json:"result"`
+	Segments int                `json:"segments"`
+	Timings  map[string]float64 `json:"timings"`
+}
+
+/**
+ * Error returned by the API. Code is a machine readable identifier of the
+ * error and Status the HTTP status code used in the response.
+ */
+type apiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (err *apiError) Error() string {
+	return err.Code + ": " + err.Message
+}
+
+func newAPIError(status int, code string, format string, args ...interface{}) *apiError {
+	return &apiError{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+/**
+ * Returns the parameters with the same default values that the web form uses
+ */
+func defaultSegmentParams() segmentParams {
+	return segmentParams{
+		Algorithm:      "gbs",
+		Sigma:          0.8,
+		K:              300,
+		MinSize:        50,
+		MinWeight:      5,
+		Superpixels:    400,
+		Compactness:    10,
+		Graph:          "kings",
+		Radius:         2,
+		WeightFn:       "euclidean",
+		ColorSpace:     "rgb",
+		FeatureWeight:  0.5,
+		MergeThreshold: 20,
+		MergeSegments:  10,
+		renderParams:   defaultRenderParams(),
+	}
+}
+
+func defaultRenderParams() renderParams {
+	return renderParams{Render: "fill", BoundaryColor: "#ff0000", BoundaryWidth: 1, Opacity: 0.5,
+		Palette: "distinct"}
+}
+
+/**
+ * Reads the render parameters present in a form
+ */
+func (params *renderParams) readForm(r *http.Request) *apiError {
+	for name, value := range map[string]*string{"render": &params.Render,
+		"boundaryColor": &params.BoundaryColor, "palette": &params.Palette,
+		"paletteColors": &params.PaletteColors} {
+		if r.FormValue(name) != "" {
+			*value = r.FormValue(name)
+		}
+	}
+	if width := r.FormValue("boundaryWidth"); width != "" {
+		parsed, err := strconv.Atoi(width)
+		if err != nil {
+			return newAPIError(http.StatusBadRequest, "invalid_parameter",
+				"boundaryWidth must be an integer")
+		}
+		params.BoundaryWidth = parsed
+	}
+	if opacity := r.FormValue("opacity"); opacity != "" {
+		parsed, err := strconv.ParseFloat(opacity, 64)
+		if err != nil {
+			return newAPIError(http.StatusBadRequest, "invalid_parameter", "opacity must be a number")
+		}
+		params.Opacity = parsed
+	}
+	if seed := r.FormValue("seed"); seed != "" {
+		parsed, err := strconv.ParseInt(seed, 10, 64)
+		if err != nil {
+			return newAPIError(http.StatusBadRequest, "invalid_parameter", "seed must be an integer")
+		}
+		params.Seed = parsed
+	}
+	if color := r.FormValue("randomColors"); color != "" {
+		params.RandomColors = color == "true" || color == "on"
+	}
+	return nil
+}
+
+/**
+ * Returns the renderer of the result images selected in the parameters
+ */
+func (params *renderParams) renderer() (segmentation.Renderer, *apiError) {
+	mode, err := segmentation.ParseRenderMode(params.Render)
+	if err != nil {
+		return segmentation.Renderer{}, newAPIError(http.StatusBadRequest, "invalid_parameter", "%v", err)
+	}
+	renderer := segmentation.NewRenderer(mode)
+	if renderer.BoundaryColor, err = colorspace.ParseHex(params.BoundaryColor); err != nil {
+		return renderer, newAPIError(http.StatusBadRequest, "invalid_parameter", "boundaryColor: %v", err)
+	}
+	if params.BoundaryWidth < 1 || params.BoundaryWidth > segmentation.MAX_BOUNDARY_WIDTH {
+		return renderer, newAPIError(http.StatusBadRequest, "invalid_parameter",
+			"boundaryWidth must be between 1 and %d", segmentation.MAX_BOUNDARY_WIDTH)
+	}
+	if params.Opacity < 0 || params.Opacity > 1 {
+		return renderer, newAPIError(http.StatusBadRequest, "invalid_parameter",
+			"opacity must be between 0 and 1")
+	}
+	if renderer.Palette.Mode, err = palette.Parse(params.Palette); err != nil {
+		return renderer, newAPIError(http.StatusBadRequest, "invalid_parameter", "%v", err)
+	}
+	if params.PaletteColors != "" {
+		if renderer.Palette.Colors, err = palette.ParseColors(params.PaletteColors); err != nil {
+			return renderer, newAPIError(http.StatusBadRequest, "invalid_parameter", "paletteColors: %v", err)
+		}
+	}
+	renderer.Palette.Seed = params.Seed
+	renderer.BoundaryWidth = params.BoundaryWidth
+	renderer.Opacity = params.Opacity
+	renderer.RandomColors = params.RandomColors
+	return renderer, nil
+}
+
+/**
+ * How the graph of a segmentation is built
+ */
+type graphSettings struct {
+	graphType  graph.GraphType
+	weightfn   graph.WeightFn
+	space      colorspace.Space
+	extractors []features.Extractor
+}
+
+/**
+ * Returns the graph settings selected in the parameters. CIEDE2000 always
+ * uses the CIELAB color space. If features are given, the weight function
+ * mixes the selected one with the feature distance.
+ */
+func (params *segmentParams) graphOptions() (graphSettings, *apiError) {
+	settings := graphSettings{graphType: graph.KINGSGRAPH, weightfn: segmentation.ColorDistance}
+	switch params.Graph {
+	case "kings":
+	case "grid":
+		settings.graphType = graph.GRIDGRAPH
+	case "nn":
+		settings.graphType = graph.NNGRAPH
+	case "24":
+		settings.graphType = graph.GRAPH24
+	case "disk":
+		if params.Radius < 1 || params.Radius > MAX_DISK_RADIUS {
+			return settings, newAPIError(http.StatusBadRequest, "invalid_parameter",
+				"radius must be between 1 and %d", MAX_DISK_RADIUS)
+		}
+		/* Radii with the same disk share its graph type, so requests can't add many */
+		settings.graphType = graph.DiskGraph(params.Radius)
+	default:
+		return settings, newAPIError(http.StatusBadRequest, "invalid_parameter",
+			"unknown graph type %q", params.Graph)
+	}
+	space, err := colorspace.Parse(params.ColorSpace)
+	if err != nil {
+		return settings, newAPIError(http.StatusBadRequest, "invalid_parameter", "%v", err)
+	}
+	settings.space = space
+	switch params.WeightFn {
+	case "euclidean":
+	case "intensity":
+		settings.weightfn = segmentation.IntensityDifference
+	case "ciede2000":
+		settings.weightfn = segmentation.CIEDE2000Weight
+		settings.space = colorspace.LAB
+	default:
+		return settings, newAPIError(http.StatusBadRequest, "invalid_parameter",
+			"unknown weight function %q", params.WeightFn)
+	}
+	for _, name := range params.Features {
+		extractor, err := features.Parse(name)
+		if err != nil {
+			return settings, newAPIError(http.StatusBadRequest, "invalid_parameter", "%v", err)
+		}
+		settings.extractors = append(settings.extractors, extractor)
+	}
+	if len(settings.extractors) > 0 {
+		if params.FeatureWeight < 0 || params.FeatureWeight > 1 {
+			return settings, newAPIError(http.StatusBadRequest, "invalid_parameter",
+				"featureWeight must be between 0 and 1")
+		}
+		settings.weightfn = segmentation.TextureWeight(settings.weightfn, params.FeatureWeight)
+	}
+	return settings, nil
+}
+
+/**
+ * Returns the criterion of the region merging stage selected in the
+ * parameters and true, or false if regions shouldn't be merged
+ */
+func (params *segmentParams) mergeCriterion() (segmentation.MergeCriterion, bool, *apiError) {
+	switch params.Merge {
+	case "":
+		return segmentation.MergeCriterion{}, false, nil
+	case "color", "boundary":
+		if params.MergeThreshold < 0 {
+			return segmentation.MergeCriterion{}, false, newAPIError(http.StatusBadRequest,
+				"invalid_parameter", "mergeThreshold can't be negative")
+		}
+		if params.Merge == "color" {
+			return segmentation.MergeByColor(params.MergeThreshold), true, nil
+		}
+		return segmentation.MergeByBoundary(params.MergeThreshold), true, nil
+	case "count":
+		if params.MergeSegments < 1 {
+			return segmentation.MergeCriterion{}, false, newAPIError(http.StatusBadRequest,
+				"invalid_parameter", "mergeSegments must be positive")
+		}
+		return segmentation.MergeToCount(params.MergeSegments), true, nil
+	}
+	return segmentation.MergeCriterion{}, false, newAPIError(http.StatusBadRequest,
+		"invalid_parameter", "unknown merge criterion %q", params.Merge)
+}
+
+/**
+ * Returns a new Segmenter of the image img that builds its graphs with the
+ * settings
+ */
+func (settings graphSettings) newSegmenter(img image.Image,
+	opts ...segmentation.Option) *segmentation.Segmenter {
+	segmenter := segmentation.New(img, settings.graphType, settings.weightfn, opts...)
+	segmenter.SetColorSpace(settings.space)
+	segmenter.SetFeatures(settings.extractors...)
+	return segmenter
+}
+
+/**
+ * Returns the API error for a segmentation that stopped because its context
+ * was done
+ */
+func canceledError(err error) *apiError {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return newAPIError(http.StatusGatewayTimeout, "timeout",
+			"the segmentation took too long")
+	}
+	return newAPIError(STATUS_CLIENT_CLOSED_REQUEST, "canceled", "the segmentation was canceled")
+}
+
+/**
+ * Returns the API error for a segmentation that failed: the one of
+ * canceledError if its context was done, a bad request if one of its
+ * arguments was invalid or an internal error otherwise
+ */
+func segmentError(err error) *apiError {
+	var canceled *segmentation.CanceledError
+	var invalid *segmentation.InvalidArgumentError
+	if errors.As(err, &canceled) {
+		return canceledError(err)
+	} else if errors.As(err, &invalid) {
+		return newAPIError(http.StatusBadRequest, "invalid_parameter", "%s: %v", invalid.Argument, err)
+	}
+	return newAPIError(http.StatusInternalServerError, "internal_error", "%v", err)
+}
+
+/**
+ * Runs the segmentation described by the parameters on the image img. It
+ * stops as soon as ctx is done. The progress is reported to the given
+ * function if it's not nil and the phases are logged to the given logger.
+ * Returns the segmenter that holds the result and the label map.
+ */
+func runSegmentation(ctx context.Context, img image.Image, params segmentParams,
+	progress segmentation.ProgressFn, logger *slog.Logger) (*segmentation.Segmenter,
+	*segmentation.Labels, *apiError) {
+	settings, err := params.graphOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+	criterion, merge, err := params.mergeCriterion()
+	if err != nil {
+		return nil, nil, err
+	}
+	renderer, err := params.renderer()
+	if err != nil {
+		return nil, nil, err
+	}
+	segmenter := settings.newSegmenter(img, segmentation.WithLogger(logger))
+	segmenter.SetRenderer(renderer)
+	segmenter.SetProgress(progress)
+	var labels *segmentation.Labels
+	var segmentErr error
+	if params.Segments != 0 {
+		if params.Segments < 1 || (params.MaxSegments != 0 && params.MaxSegments < params.Segments) {
+			return nil, nil, newAPIError(http.StatusBadRequest, "invalid_parameter",
+				"segments must be positive and not greater than maxSegments")
+		}
+		if params.Algorithm == "slic" {
+			return nil, nil, newAPIError(http.StatusBadRequest, "invalid_parameter",
+				"segments is only supported by gbs, hmsf and phmsf")
+		}
+	}
+	switch params.Algorithm {
+	case "gbs":
+		if params.Segments != 0 {
+			labels, _, segmentErr = segmenter.SegmentGBSToCountContext(ctx, params.Sigma,
+				params.MinSize, params.Segments, params.MaxSegments)
+		} else {
+			labels, segmentErr = segmenter.SegmentGBSContext(ctx, params.Sigma, params.K, params.MinSize)
+		}
+	case "hmsf":
+		if params.Segments != 0 {
+			labels, _, segmentErr = segmenter.SegmentHMSFToCountContext(ctx, params.Sigma,
+				params.Segments, params.MaxSegments)
+		} else {
+			labels, segmentErr = segmenter.SegmentHMSFContext(ctx, params.Sigma, params.MinWeight)
+		}
+	case "phmsf":
+		if params.Segments != 0 {
+			labels, _, segmentErr = segmenter.SegmentPHMSFToCountContext(ctx, params.Sigma,
+				params.Segments, params.MaxSegments)
+		} else {
+			labels, segmentErr = segmenter.SegmentPHMSFContext(ctx, params.Sigma, params.MinWeight)
+		}
+	case "slic":
+		if params.Superpixels < 1 {
+			return nil, nil, newAPIError(http.StatusBadRequest, "invalid_parameter",
+				"superpixels must be positive")
+		}
+		labels, segmentErr = segmenter.SegmentSLICContext(ctx, params.Superpixels, params.Compactness)
+	default:
+		return nil, nil, newAPIError(http.StatusBadRequest, "invalid_parameter",
+			"unknown algorithm %q", params.Algorithm)
+	}
+	if segmentErr == nil && merge {
+		labels, segmentErr = segmenter.MergeRegionsContext(ctx, criterion)
+	}
+	if segmentErr != nil {
+		logger.Info("segmentation failed", "error", segmentErr)
+		return nil, nil, segmentError(segmentErr)
+	}
+	return segmenter, labels, nil
+}
+
+/**
+ * Reads the parameters and the image of a JSON request. The image is stored
+ * in the tmp directory. Returns the parameters and the name and extension
+ * of the stored image.
+ */
+func parseJSONSegmentRequest(r *http.Request) (segmentParams, string, string, *apiError) {
+	params := defaultSegmentParams()
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return params, "", "", newAPIError(http.StatusBadRequest, "invalid_json", "%v", err)
+	}
+	filename, extension, apiErr := storeBase64Image(params.Image)
+	params.Image = ""
+	return params, filename, extension, apiErr
+}
+
+/**
+ * Stores the base64 encoded image of a JSON request in the tmp directory.
+ * Returns the name and extension of the stored image.
+ */
+func storeBase64Image(encoded string) (string, string, *apiError) {
+	if encoded == "" {
+		return "", "", newAPIError(http.StatusBadRequest, "missing_image",
+			"the image field is required")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", newAPIError(http.StatusBadRequest, "invalid_image",
+			"the image is not valid base64: %v", err)
+	}
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", "", newAPIError(http.StatusBadRequest, "invalid_image", "%v", err)
+	}
+	filename := randomString()
+	extension := "." + format
+	if err := ioutil.WriteFile("tmp/"+filename+extension, data, 0644); err != nil {
+		return "", "", newAPIError(http.StatusInternalServerError, "internal_error", "%v", err)
+	}
+	return filename, extension, nil
+}
+
+/**
+ * Reads the parameters and the image of a multipart request. The image is
+ * stored in the tmp directory. Returns the parameters and the name and
+ * extension of the stored image.
+ */
+func parseMultipartSegmentRequest(r *http.Request) (segmentParams, string, string, *apiError) {
+	params := defaultSegmentParams()
+	if err := r.ParseMultipartForm(MAX_REQUEST_SIZE); err != nil {
+		return params, "", "", newAPIError(http.StatusBadRequest, "invalid_form", "%v", err)
+	}
+	texts := map[string]*string{"algorithm": &params.Algorithm, "graph": &params.Graph,
+		"weightfn": &params.WeightFn, "colorspace": &params.ColorSpace, "merge": &params.Merge}
+	floats := map[string]*float64{"sigma": &params.Sigma, "k": &params.K,
+		"minweight": &params.MinWeight, "compactness": &params.Compactness,
+		"featureWeight": &params.FeatureWeight, "radius": &params.Radius,
+		"mergeThreshold": &params.MergeThreshold}
+	ints := map[string]*int{"minsize": &params.MinSize, "superpixels": &params.Superpixels,
+		"mergeSegments": &params.MergeSegments, "segments": &params.Segments,
+		"maxSegments": &params.MaxSegments}
+	for name, value := range texts {
+		if r.FormValue(name) != "" {
+			*value = r.FormValue(name)
+		}
+	}
+	for name, value := range floats {
+		if r.FormValue(name) == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(r.FormValue(name), 64)
+		if err != nil {
+			return params, "", "", newAPIError(http.StatusBadRequest, "invalid_parameter",
+				"%s must be a number", name)
+		}
+		*value = parsed
+	}
+	for name, value := range ints {
+		if r.FormValue(name) == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(r.FormValue(name))
+		if err != nil {
+			return params, "", "", newAPIError(http.StatusBadRequest, "invalid_parameter",
+				"%s must be an integer", name)
+		}
+		*value = parsed
+	}
+	params.Features = formFeatures(r)
+	if apiErr := params.readForm(r); apiErr != nil {
+		return params, "", "", apiErr
+	}
+
+	filename, extension, apiErr := storeFormImage(r)
+	return params, filename, extension, apiErr
+}
+
+/**
+ * Stores the image of the file field of a multipart request in the tmp
+ * directory. The extension comes from the format of the image, not from the
+ * name the client gave to the file. Returns the name and extension of the
+ * stored image.
+ */
+func storeFormImage(r *http.Request) (string, string, *apiError) {
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return "", "", newAPIError(http.StatusBadRequest, "missing_image",
+			"the file field is required")
+	}
+	_, format, err := image.DecodeConfig(file)
+	if err != nil {
+		file.Close()
+		return "", "", newAPIError(http.StatusBadRequest, "invalid_image", "%v", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return "", "", newAPIError(http.StatusInternalServerError, "internal_error", "%v", err)
+	}
+	extension := "." + format
+	filename, err := createFileInFS(file, extension)
+	if err != nil {
+		return "", "", newAPIError(http.StatusInternalServerError, "internal_error", "%v", err)
+	}
+	return filename, extension, nil
+}
+
+/**
+ * Returns the names of the features of a form. They can be given as several
+ * features fields or as a single comma separated one.
+ */
+func formFeatures(r *http.Request) []string {
+	var names []string
+	for _, value := range r.Form["features"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeAPIError(w http.ResponseWriter, err *apiError) {
+	writeJSON(w, err.Status, map[string]*apiError{"error": err})
+}
+
+/**
+ * Reads the parameters and the image of a segmentation request, either from
+ * a JSON or from a multipart body. The image is stored in the tmp directory.
+ * Returns the parameters and the name and extension of the stored image.
+ */
+func parseSegmentRequest(w http.ResponseWriter, r *http.Request) (segmentParams,
+	string, string, *apiError) {
+	mediaType, apiErr := checkAPIRequest(w, r)
+	if apiErr != nil {
+		return segmentParams{}, "", "", apiErr
+	}
+	if mediaType == "application/json" {
+		return parseJSONSegmentRequest(r)
+	}
+	return parseMultipartSegmentRequest(r)
+}
+
+/**
+ * Checks that an API request is a POST request with a JSON or a multipart
+ * body and limits the size of the body. Returns the media type of the body.
+ */
+func checkAPIRequest(w http.ResponseWriter, r *http.Request) (string, *apiError) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		return "", newAPIError(http.StatusMethodNotAllowed, "method_not_allowed",
+			"only POST is allowed")
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_REQUEST_SIZE)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" && mediaType != "multipart/form-data" {
+		return "", newAPIError(http.StatusUnsupportedMediaType, "unsupported_media_type",
+			"the body must be application/json or multipart/form-data")
+	}
+	return mediaType, nil
+}
+
+/**
+ * Segments the image stored in the tmp directory with the given name and
+ * extension and writes the result image next to it. It stops as soon as ctx
+ * is done. The progress is reported to the given function if it's not nil.
+ */
+func segmentStoredImage(ctx context.Context, filename, extension string, params segmentParams,
+	progress segmentation.ProgressFn, logger *slog.Logger) (segmentResponse, *apiError) {
+	img := loadImageFromFile("tmp/" + filename + extension)
+	if img == nil {
+		return segmentResponse{}, newAPIError(http.StatusBadRequest, "invalid_image",
+			"the image could not be decoded")
+	}
+	segmenter, labels, apiErr := runSegmentation(ctx, img, params, progress,
+		logger.With("image", filename))
+	if apiErr != nil {
+		return segmentResponse{}, apiErr
+	}
+
+	resultimg := segmenter.GetResultImage()
+	if resultimg == nil {
+		return segmentResponse{}, newAPIError(http.StatusInternalServerError, "internal_error",
+			"the result image could not be drawn")
+	}
+	toimg, err := os.Create("tmp/new_" + filename + ".png")
+	if err != nil {
+		return segmentResponse{}, newAPIError(http.StatusInternalServerError, "internal_error", "%v", err)
+	}
+	defer toimg.Close()
+	if err := png.Encode(toimg, resultimg); err != nil {
+		return segmentResponse{}, newAPIError(http.StatusInternalServerError, "internal_error", "%v", err)
+	}
+
+	timings := make(map[string]float64)
+	for phase, elapsed := range segmenter.GetTimings() {
+		timings[phase] = float64(elapsed) / float64(time.Millisecond)
+	}
+	return segmentResponse{
+		Id:       filename,
+		Original: "/tmp/" + filename + extension,
+		Result:   "/tmp/new_" + filename + ".png",
+		Segments: labels.Count,
+		Timings:  timings,
+	}, nil
+}
+
+/**
+ * Handles /api/v1/segment. Accepts POST requests with either a JSON or a
+ * multipart body and answers with a segmentResponse or an error as JSON.
+ * The segmentation stops if the client disconnects or it takes longer than
+ * SEGMENT_TIMEOUT.
+ */
+func apiSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	params, filename, extension, apiErr := parseSegmentRequest(w, r)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), SEGMENT_TIMEOUT)
+	defer cancel()
+	response, apiErr := segmentStoredImage(ctx, filename, extension, params, nil, requestLogger(r))
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
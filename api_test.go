@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/miguelfrde/image-segmentation/jobs"
+	"github.com/miguelfrde/image-segmentation/segmentation"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+/**
+ * Runs the tests inside a temporary directory with the tmp directory that
+ * the handlers write to and a queue of jobs that stores its index there
+ */
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		panic(err)
+	}
+	wd, _ := os.Getwd()
+	if err := os.Mkdir(filepath.Join(dir, "tmp"), 0755); err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	queue, err = jobs.NewQueue(1, MAX_QUEUED_JOBS, "tmp/jobs.json", runSegmentJob)
+	if err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.Chdir(wd)
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+/**
+ * Returns a PNG encoded width x height image with two flat halves
+ */
+func pngImage(width, height int) []byte {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for p := range img.Pix {
+		if p%width >= width/2 {
+			img.Pix[p] = 200
+		} else {
+			img.Pix[p] = 30
+		}
+	}
+	img.SetGray(0, 0, color.Gray{31})
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+/**
+ * Returns a JSON request to path with the given parameters and the
+ * image encoded in base64
+ */
+func jsonRequest(path string, params map[string]interface{}, img []byte) *http.Request {
+	body := map[string]interface{}{"image": base64.StdEncoding.EncodeToString(img)}
+	for name, value := range params {
+		body[name] = value
+	}
+	data, _ := json.Marshal(body)
+	r := httptest.NewRequest("POST", path, bytes.NewReader(data))
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+/**
+ * Returns a multipart request to path with the given fields and, if
+ * filename isn't empty, the file field with the given data
+ */
+func multipartRequest(path string, fields map[string]string, filename string,
+	data []byte) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	if filename != "" {
+		part, _ := writer.CreateFormFile("file", filename)
+		part.Write(data)
+	}
+	writer.Close()
+	r := httptest.NewRequest("POST", path, &body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	return r
+}
+
+func serve(handler http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+/**
+ * Returns the code of the API error of a response
+ */
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	var response struct {
+		Error apiError `json:"error"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response), w.Body.String())
+	return response.Error.Code
+}
+
+/*
+ * Tests
+ */
+
+func TestSegmentAPIRejectsInvalidRequests(t *testing.T) {
+	img := pngImage(20, 10)
+	plain := httptest.NewRequest("POST", "/api/v1/segment", strings.NewReader("hello"))
+	plain.Header.Set("Content-Type", "text/plain")
+	badJSON := httptest.NewRequest("POST", "/api/v1/segment", strings.NewReader("{"))
+	badJSON.Header.Set("Content-Type", "application/json")
+	noImage := jsonRequest("/api/v1/segment", nil, nil)
+	for name, test := range map[string]struct {
+		request *http.Request
+		status  int
+		code    string
+	}{
+		"get": {httptest.NewRequest("GET", "/api/v1/segment", nil), 405,
+			"method_not_allowed"},
+		"text":     {plain, 415, "unsupported_media_type"},
+		"bad json": {badJSON, 400, "invalid_json"},
+		"no image": {noImage, 400, "missing_image"},
+		"not an image": {jsonRequest("/api/v1/segment", nil, []byte("hello")), 400,
+			"invalid_image"},
+		"unknown algorithm": {jsonRequest("/api/v1/segment",
+			map[string]interface{}{"algorithm": "kmeans"}, img), 400, "invalid_parameter"},
+		"unknown graph": {jsonRequest("/api/v1/segment",
+			map[string]interface{}{"graph": "hex"}, img), 400, "invalid_parameter"},
+		"no superpixels": {jsonRequest("/api/v1/segment",
+			map[string]interface{}{"algorithm": "slic", "superpixels": 0}, img), 400,
+			"invalid_parameter"},
+		"no file": {multipartRequest("/api/v1/segment", nil, "", nil), 400, "missing_image"},
+		"not an image file": {multipartRequest("/api/v1/segment", nil, "img.png",
+			[]byte("hello")), 400, "invalid_image"},
+		"bad sigma": {multipartRequest("/api/v1/segment", map[string]string{"sigma": "a"},
+			"img.png", img), 400, "invalid_parameter"},
+	} {
+		w := serve(apiSegmentHandler, test.request)
+		assert.Equal(t, test.status, w.Code, name)
+		assert.Equal(t, test.code, errorCode(t, w), name)
+	}
+}
+
+func TestSegmentAPIWithJSON(t *testing.T) {
+	w := serve(apiSegmentHandler, jsonRequest("/api/v1/segment",
+		map[string]interface{}{"algorithm": "hmsf", "sigma": 0}, pngImage(20, 10)))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response segmentResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Segments > 0)
+	assert.Equal(t, "/tmp/"+response.Id+".png", response.Original)
+	for _, path := range []string{response.Original, response.Result} {
+		_, err := os.Stat(path[1:])
+		assert.Nil(t, err, path)
+	}
+}
+
+func TestSegmentAPIStoresTheFormatOfTheImage(t *testing.T) {
+	/* The name of the uploaded file doesn't choose the extension */
+	for _, filename := range []string{"img.png", "img.jpg", "img.html", "img"} {
+		w := serve(apiSegmentHandler, multipartRequest("/api/v1/segment",
+			map[string]string{"algorithm": "gbs", "sigma": "0"}, filename, pngImage(20, 10)))
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response segmentResponse
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "/tmp/"+response.Id+".png", response.Original, filename)
+	}
+}
+
+func TestSegmentAPICanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := jsonRequest("/api/v1/segment", nil, pngImage(20, 10)).WithContext(ctx)
+	w := serve(apiSegmentHandler, r)
+	assert.Equal(t, STATUS_CLIENT_CLOSED_REQUEST, w.Code)
+	assert.Equal(t, "canceled", errorCode(t, w))
+}
+
+func TestSegmentErrorStatuses(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{&segmentation.CanceledError{Phase: segmentation.PHASE_GRAPH, Err: context.Canceled},
+			STATUS_CLIENT_CLOSED_REQUEST, "canceled"},
+		{&segmentation.CanceledError{Phase: segmentation.PHASE_SEGMENT, Err: context.DeadlineExceeded},
+			http.StatusGatewayTimeout, "timeout"},
+		{&segmentation.InvalidArgumentError{Argument: "superpixels", Message: "must be positive"},
+			http.StatusBadRequest, "invalid_parameter"},
+		{errors.New("out of memory"), http.StatusInternalServerError, "internal_error"},
+		/* A deadline that isn't the one of a segmentation is an internal error */
+		{context.DeadlineExceeded, http.StatusInternalServerError, "internal_error"},
+	} {
+		apiErr := segmentError(test.err)
+		assert.Equal(t, test.status, apiErr.Status, "%v", test.err)
+		assert.Equal(t, test.code, apiErr.Code, "%v", test.err)
+	}
+}
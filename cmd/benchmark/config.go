@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/miguelfrde/image-segmentation/colorspace"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/miguelfrde/image-segmentation/segmentation"
+	"image"
+	"strconv"
+	"strings"
+)
+
+/**
+ * A point of the parameter grid: an algorithm and the values of its
+ * parameters. Parameters that the algorithm doesn't use are left empty.
+ */
+type config struct {
+	Algorithm   string  `json:"algorithm"`
+	Sigma       float64 `json:"sigma,omitempty"`
+	K           float64 `json:"k,omitempty"`
+	MinSize     int     `json:"minSize,omitempty"`
+	MinWeight   float64 `json:"minWeight,omitempty"`
+	Superpixels int     `json:"superpixels,omitempty"`
+	Compactness float64 `json:"compactness,omitempty"`
+	Graph       string  `json:"graph"`
+	WeightFn    string  `json:"weightfn,omitempty"`
+}
+
+/**
+ * Returns a short description of the configuration that identifies it in
+ * the result tables
+ */
+func (c config) String() string {
+	var params []string
+	switch c.Algorithm {
+	case "gbs":
+		params = []string{fmt.Sprintf("sigma=%g k=%g minsize=%d", c.Sigma, c.K, c.MinSize)}
+	case "hmsf", "phmsf":
+		params = []string{fmt.Sprintf("sigma=%g minweight=%g", c.Sigma, c.MinWeight)}
+	case "slic":
+		params = []string{fmt.Sprintf("superpixels=%d compactness=%g", c.Superpixels, c.Compactness)}
+	}
+	if c.Algorithm != "slic" {
+		params = append(params, "graph="+c.Graph, "weightfn="+c.WeightFn)
+	}
+	return c.Algorithm + " " + strings.Join(params, " ")
+}
+
+/**
+ * Values of every parameter of the grid, from the comma separated flags
+ */
+type grid struct {
+	algorithms  []string
+	sigmas      []float64
+	ks          []float64
+	minSizes    []int
+	minWeights  []float64
+	superpixels []int
+	compactness []float64
+	graphs      []string
+	weightfns   []string
+}
+
+/**
+ * Returns all the combinations of the values of the grid that each
+ * algorithm uses, in the order of the algorithms
+ */
+func (g grid) configs() []config {
+	var configs []config
+	for _, algorithm := range g.algorithms {
+		if algorithm == "slic" {
+			for _, superpixels := range g.superpixels {
+				for _, compactness := range g.compactness {
+					configs = append(configs, config{Algorithm: algorithm, Superpixels: superpixels,
+						Compactness: compactness, Graph: g.graphs[0]})
+				}
+			}
+			continue
+		}
+		for _, graphName := range g.graphs {
+			for _, weightName := range g.weightfns {
+				for _, sigma := range g.sigmas {
+					base := config{Algorithm: algorithm, Sigma: sigma, Graph: graphName,
+						WeightFn: weightName}
+					if algorithm == "gbs" {
+						for _, k := range g.ks {
+							for _, minSize := range g.minSizes {
+								c := base
+								c.K, c.MinSize = k, minSize
+								configs = append(configs, c)
+							}
+						}
+						continue
+					}
+					for _, minWeight := range g.minWeights {
+						c := base
+						c.MinWeight = minWeight
+						configs = append(configs, c)
+					}
+				}
+			}
+		}
+	}
+	return configs
+}
+
+/**
+ * Runs the segmentation of the configuration on the image img and returns
+ * its label map
+ */
+func (c config) segment(ctx context.Context, img image.Image) (*segmentation.Labels, error) {
+	graphType, err := parseGraphType(c.Graph)
+	if err != nil {
+		return nil, err
+	}
+	weightfn, err := parseWeightFn(c.WeightFn)
+	if err != nil {
+		return nil, err
+	}
+	segmenter := segmentation.New(img, graphType, weightfn)
+	if c.WeightFn == "ciede2000" {
+		segmenter.SetColorSpace(colorspace.LAB)
+	}
+	switch c.Algorithm {
+	case "gbs":
+		return segmenter.SegmentGBSContext(ctx, c.Sigma, c.K, c.MinSize)
+	case "hmsf":
+		return segmenter.SegmentHMSFContext(ctx, c.Sigma, c.MinWeight)
+	case "phmsf":
+		return segmenter.SegmentPHMSFContext(ctx, c.Sigma, c.MinWeight)
+	case "slic":
+		return segmenter.SegmentSLICContext(ctx, c.Superpixels, c.Compactness)
+	}
+	return nil, fmt.Errorf("unknown algorithm %q", c.Algorithm)
+}
+
+func parseGraphType(name string) (graph.GraphType, error) {
+	switch name {
+	case "kings":
+		return graph.KINGSGRAPH, nil
+	case "grid":
+		return graph.GRIDGRAPH, nil
+	case "nn":
+		return graph.NNGRAPH, nil
+	case "24":
+		return graph.GRAPH24, nil
+	}
+	return 0, fmt.Errorf("unknown graph type %q", name)
+}
+
+func parseWeightFn(name string) (graph.WeightFn, error) {
+	switch name {
+	case "", "euclidean":
+		return segmentation.ColorDistance, nil
+	case "intensity":
+		return segmentation.IntensityDifference, nil
+	case "ciede2000":
+		return segmentation.CIEDE2000Weight, nil
+	}
+	return nil, fmt.Errorf("unknown weight function %q", name)
+}
+
+/**
+ * Splits a comma separated list of values, ignoring the empty ones
+ */
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func parseFloats(name, list string) ([]float64, error) {
+	var values []float64
+	for _, s := range splitList(list) {
+		value, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("-%s: invalid value %q", name, s)
+		}
+		values = append(values, value)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("-%s: no values", name)
+	}
+	return values, nil
+}
+
+func parseInts(name, list string) ([]int, error) {
+	var values []int
+	for _, s := range splitList(list) {
+		value, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("-%s: invalid value %q", name, s)
+		}
+		values = append(values, value)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("-%s: no values", name)
+	}
+	return values, nil
+}
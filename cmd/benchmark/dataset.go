@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"github.com/miguelfrde/image-segmentation/evaluation"
+	"github.com/miguelfrde/image-segmentation/segmentation"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var imageExtensions = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true}
+
+/**
+ * An image of the dataset and the paths of its ground truth segmentations
+ */
+type sample struct {
+	id           string
+	image        string
+	groundTruths []string
+}
+
+/**
+ * Finds the images under imagesDir and their ground truths under gtDir, both
+ * searched recursively. The ground truths of the image <id>.jpg are the files
+ * <id>.seg (BSDS format) and <id>.png or <id>_<n>.png (label images). Images
+ * without ground truth are left out. Samples are sorted by id.
+ */
+func loadDataset(imagesDir, gtDir string) ([]sample, error) {
+	samples := make(map[string]*sample)
+	err := filepath.Walk(imagesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !imageExtensions[strings.ToLower(filepath.Ext(path))] {
+			return err
+		}
+		id := fileId(path)
+		if other, ok := samples[id]; ok {
+			return fmt.Errorf("%s and %s have the same id", other.image, path)
+		}
+		samples[id] = &sample{id: id, image: path}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.Walk(gtDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext != ".seg" && ext != ".png" {
+			return nil
+		}
+		id := fileId(path)
+		s, ok := samples[id]
+		if !ok && ext == ".png" {
+			if i := strings.LastIndex(id, "_"); i > 0 {
+				s, ok = samples[id[:i]]
+			}
+		}
+		if ok {
+			s.groundTruths = append(s.groundTruths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]sample, 0, len(samples))
+	for _, s := range samples {
+		if len(s.groundTruths) == 0 {
+			fmt.Fprintln(os.Stderr, s.image+": no ground truth, skipped")
+			continue
+		}
+		sort.Strings(s.groundTruths)
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].id < result[j].id })
+	return result, nil
+}
+
+/**
+ * Returns the name of a file without its directory and extension
+ */
+func fileId(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func readImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+/**
+ * Reads a ground truth segmentation in the BSDS .seg format or as a PNG
+ * label image
+ */
+func readGroundTruth(path string) (*segmentation.Labels, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if strings.ToLower(filepath.Ext(path)) == ".seg" {
+		return evaluation.ReadSeg(f)
+	}
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return evaluation.LabelsFromImage(img), nil
+}
+
+/**
+ * Reads the image of the sample and its ground truths. Returns an error if
+ * some ground truth doesn't have the size of the image.
+ */
+func (s sample) load() (image.Image, []*segmentation.Labels, error) {
+	img, err := readImage(s.image)
+	if err != nil {
+		return nil, nil, err
+	}
+	groundTruths := make([]*segmentation.Labels, 0, len(s.groundTruths))
+	for _, path := range s.groundTruths {
+		gt, err := readGroundTruth(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if gt.Width != img.Bounds().Dx() || gt.Height != img.Bounds().Dy() {
+			return nil, nil, fmt.Errorf("%s: %v", path, evaluation.ErrSizeMismatch)
+		}
+		groundTruths = append(groundTruths, gt)
+	}
+	return img, groundTruths, nil
+}
@@ -0,0 +1,250 @@
+/**
+ * benchmark runs segmentation algorithms over a dataset of images with human
+ * segmentations, like the Berkeley Segmentation Dataset, and scores the
+ * results with the evaluation package. Every parameter flag takes a comma
+ * separated list of values and every combination of them is run. It writes
+ * the scores, time and memory of every image (runs.csv) and their means for
+ * every configuration (summary.csv), and both in results.json. Memory is only
+ * measured when images are segmented one at a time. If it's interrupted, the
+ * tables of the runs that finished are written before it exits.
+ *
+ * Usage:
+ *   benchmark [flags] dataset
+ */
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/miguelfrde/image-segmentation/evaluation"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+func main() {
+	var algorithms, sigmas, ks, minSizes, minWeights, superpixels, compactness string
+	var graphs, weightfns, imagesDir, gtDir, outDir string
+	var tolerance float64
+	var workers, limit int
+	flag.StringVar(&algorithms, "algorithms", "gbs", "segmentation algorithms: gbs, hmsf, phmsf and slic")
+	flag.StringVar(&sigmas, "sigma", "0.8", "sigmas of the gaussian filter used to smooth the image")
+	flag.StringVar(&ks, "k", "300", "k parameters of GBS")
+	flag.StringVar(&minSizes, "minsize", "50", "minimum region sizes of GBS")
+	flag.StringVar(&minWeights, "minweight", "5", "minimum weights of HMSF")
+	flag.StringVar(&superpixels, "superpixels", "400", "numbers of superpixels of SLIC")
+	flag.StringVar(&compactness, "compactness", "10", "compactness values of SLIC")
+	flag.StringVar(&graphs, "graph", "kings", "graph types: kings, grid, 24 or nn")
+	flag.StringVar(&weightfns, "weightfn", "euclidean",
+		"weight functions: euclidean, intensity or ciede2000")
+	flag.StringVar(&imagesDir, "images", "images", "directory of the images, relative to the dataset")
+	flag.StringVar(&gtDir, "groundtruth", "groundTruth",
+		"directory of the .seg and PNG ground truths, relative to the dataset")
+	flag.Float64Var(&tolerance, "tolerance", -1,
+		"maximum distance in pixels of matching boundaries, 0.75% of the diagonal by default")
+	flag.StringVar(&outDir, "out", "benchmark", "directory where the result tables are written")
+	flag.IntVar(&workers, "workers", 1, "number of images segmented concurrently")
+	flag.IntVar(&limit, "limit", 0, "only use the first images of the dataset")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		exit(fmt.Errorf("expected a dataset directory"))
+	}
+	var g grid
+	var err error
+	g.algorithms = splitList(algorithms)
+	g.graphs = splitList(graphs)
+	g.weightfns = splitList(weightfns)
+	if g.sigmas, err = parseFloats("sigma", sigmas); err != nil {
+		exit(err)
+	}
+	if g.ks, err = parseFloats("k", ks); err != nil {
+		exit(err)
+	}
+	if g.minSizes, err = parseInts("minsize", minSizes); err != nil {
+		exit(err)
+	}
+	if g.minWeights, err = parseFloats("minweight", minWeights); err != nil {
+		exit(err)
+	}
+	if g.superpixels, err = parseInts("superpixels", superpixels); err != nil {
+		exit(err)
+	}
+	for _, n := range g.superpixels {
+		if n < 1 {
+			exit(fmt.Errorf("-superpixels: %d is not positive", n))
+		}
+	}
+	if g.compactness, err = parseFloats("compactness", compactness); err != nil {
+		exit(err)
+	}
+	for _, algorithm := range g.algorithms {
+		switch algorithm {
+		case "gbs", "hmsf", "phmsf", "slic":
+		default:
+			exit(fmt.Errorf("unknown algorithm %q", algorithm))
+		}
+	}
+	for _, name := range g.graphs {
+		if _, err := parseGraphType(name); err != nil {
+			exit(err)
+		}
+	}
+	for _, name := range g.weightfns {
+		if _, err := parseWeightFn(name); err != nil {
+			exit(err)
+		}
+	}
+	configs := g.configs()
+	if len(configs) == 0 {
+		exit(fmt.Errorf("no configurations to run"))
+	}
+
+	dataset := flag.Arg(0)
+	samples, err := loadDataset(filepath.Join(dataset, imagesDir), filepath.Join(dataset, gtDir))
+	if err != nil {
+		exit(err)
+	}
+	if limit > 0 && limit < len(samples) {
+		samples = samples[:limit]
+	}
+	if len(samples) == 0 {
+		exit(fmt.Errorf("no images with ground truth in %s", dataset))
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		exit(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "%d images, %d configurations\n", len(samples), len(configs))
+	runs, failed := benchmarkAll(ctx, samples, configs, tolerance, workers)
+	interrupted := ctx.Err() != nil
+	stop()
+	if interrupted {
+		fmt.Fprintf(os.Stderr, "interrupted, writing the %d finished runs\n", len(runs))
+	}
+
+	summaries := summarize(configs, runs)
+	if err := writeRunsCSV(filepath.Join(outDir, "runs.csv"), runs); err != nil {
+		exit(err)
+	}
+	if err := writeSummaryCSV(filepath.Join(outDir, "summary.csv"), summaries); err != nil {
+		exit(err)
+	}
+	if err := writeJSON(filepath.Join(outDir, "results.json"), summaries, runs); err != nil {
+		exit(err)
+	}
+	printSummaries(os.Stdout, summaries)
+	if failed || interrupted {
+		os.Exit(1)
+	}
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, "benchmark:", err)
+	os.Exit(2)
+}
+
+/**
+ * Runs every configuration on every sample using the given number of
+ * workers, each of them loading a sample and running all the configurations
+ * on it. Returns the runs sorted by configuration and image, and true if
+ * some sample failed. Once ctx is done no more samples are started and the
+ * runs that finished are returned. Memory is only measured with one worker,
+ * since the allocations of a goroutine can't be told apart from the ones of
+ * the others.
+ */
+func benchmarkAll(ctx context.Context, samples []sample, configs []config,
+	tolerance float64, workers int) ([]run, bool) {
+	if workers < 1 {
+		workers = 1
+	}
+	inputs := make(chan sample)
+	var mu sync.Mutex
+	var runs []run
+	failed := false
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range inputs {
+				sampleRuns, err := benchmarkSample(ctx, s, configs, tolerance, workers == 1)
+				mu.Lock()
+				if err != nil {
+					failed = true
+					fmt.Fprintln(os.Stderr, s.image+":", err)
+				} else {
+					fmt.Fprintln(os.Stderr, s.image)
+				}
+				runs = append(runs, sampleRuns...)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, s := range samples {
+		if ctx.Err() != nil {
+			break
+		}
+		inputs <- s
+	}
+	close(inputs)
+	wg.Wait()
+
+	sort.Slice(runs, func(i, j int) bool {
+		if runs[i].config != runs[j].config {
+			return runs[i].config < runs[j].config
+		}
+		return runs[i].Image < runs[j].Image
+	})
+	return runs, failed
+}
+
+/**
+ * Runs every configuration on the sample and scores the results against
+ * its ground truths. The memory allocated by every run is measured if
+ * measureMemory is true. Returns the runs that finished if one fails.
+ */
+func benchmarkSample(ctx context.Context, s sample, configs []config,
+	tolerance float64, measureMemory bool) ([]run, error) {
+	img, groundTruths, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]run, 0, len(configs))
+	for i, c := range configs {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		labels, err := c.segment(ctx, img)
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+		if err != nil {
+			return runs, fmt.Errorf("%s: %v", c, err)
+		}
+		scores, err := evaluation.Evaluate(labels, groundTruths, tolerance)
+		if err != nil {
+			return runs, fmt.Errorf("%s: %v", c, err)
+		}
+		r := run{
+			Config:   c.String(),
+			Image:    s.id,
+			Segments: labels.Count,
+			TimeMs:   float64(elapsed.Nanoseconds()) / 1e6,
+			Scores:   scores,
+			config:   i,
+		}
+		if measureMemory {
+			allocMB := float64(after.TotalAlloc-before.TotalAlloc) / (1 << 20)
+			r.AllocMB = &allocMB
+		}
+		runs = append(runs, r)
+	}
+	return runs, nil
+}
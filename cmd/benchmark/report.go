@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/miguelfrde/image-segmentation/evaluation"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+/**
+ * Result of a configuration on a single image. AllocMB is the memory
+ * allocated while segmenting it, nil if it wasn't measured.
+ */
+type run struct {
+	Config   string   `json:"config"`
+	Image    string   `json:"image"`
+	Segments int      `json:"segments"`
+	TimeMs   float64  `json:"timeMs"`
+	AllocMB  *float64 `json:"allocMB,omitempty"`
+	evaluation.Scores
+	config int
+}
+
+/**
+ * Mean scores, time and memory of a configuration over all the images. The
+ * memory figures are nil if it wasn't measured.
+ */
+type summary struct {
+	Config      string   `json:"config"`
+	Parameters  config   `json:"parameters"`
+	Images      int      `json:"images"`
+	Segments    float64  `json:"segments"`
+	TimeMs      float64  `json:"timeMs"`
+	TotalTimeMs float64  `json:"totalTimeMs"`
+	AllocMB     *float64 `json:"allocMB,omitempty"`
+	MaxAllocMB  *float64 `json:"maxAllocMB,omitempty"`
+	evaluation.Scores
+}
+
+/**
+ * Returns the summary of every configuration from the runs, which are
+ * sorted by configuration
+ */
+func summarize(configs []config, runs []run) []summary {
+	summaries := make([]summary, len(configs), len(configs))
+	for i, c := range configs {
+		summaries[i] = summary{Config: c.String(), Parameters: c}
+	}
+	for _, r := range runs {
+		s := &summaries[r.config]
+		s.Images++
+		s.Segments += float64(r.Segments)
+		s.TotalTimeMs += r.TimeMs
+		if r.AllocMB != nil {
+			if s.AllocMB == nil {
+				s.AllocMB, s.MaxAllocMB = new(float64), new(float64)
+			}
+			*s.AllocMB += *r.AllocMB
+			*s.MaxAllocMB = math.Max(*s.MaxAllocMB, *r.AllocMB)
+		}
+		s.PRI += r.PRI
+		s.VOI += r.VOI
+		s.GCE += r.GCE
+		s.Covering += r.Covering
+		s.Precision += r.Precision
+		s.Recall += r.Recall
+		s.F += r.F
+	}
+	for i := range summaries {
+		s := &summaries[i]
+		if s.Images == 0 {
+			continue
+		}
+		n := float64(s.Images)
+		s.Segments /= n
+		s.TimeMs = s.TotalTimeMs / n
+		if s.AllocMB != nil {
+			*s.AllocMB /= n
+		}
+		s.PRI /= n
+		s.VOI /= n
+		s.GCE /= n
+		s.Covering /= n
+		s.Precision /= n
+		s.Recall /= n
+		s.F /= n
+	}
+	return summaries
+}
+
+var scoreHeader = []string{"pri", "voi", "gce", "covering", "precision", "recall", "f"}
+
+func scoreFields(scores evaluation.Scores) []string {
+	return formatFloats(scores.PRI, scores.VOI, scores.GCE, scores.Covering,
+		scores.Precision, scores.Recall, scores.F)
+}
+
+func formatFloats(values ...float64) []string {
+	fields := make([]string, len(values), len(values))
+	for i, value := range values {
+		fields[i] = strconv.FormatFloat(value, 'f', 4, 64)
+	}
+	return fields
+}
+
+/**
+ * Formats a value that may not have been measured, nil values are empty
+ */
+func formatOptional(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'f', 4, 64)
+}
+
+/**
+ * Writes a row per run to the file path in the CSV format
+ */
+func writeRunsCSV(path string, runs []run) error {
+	return writeCSV(path, func(w *csv.Writer) {
+		w.Write(append([]string{"config", "image", "segments", "timeMs", "allocMB"}, scoreHeader...))
+		for _, r := range runs {
+			row := []string{r.Config, r.Image, strconv.Itoa(r.Segments),
+				strconv.FormatFloat(r.TimeMs, 'f', 4, 64), formatOptional(r.AllocMB)}
+			w.Write(append(row, scoreFields(r.Scores)...))
+		}
+	})
+}
+
+/**
+ * Writes a row per configuration to the file path in the CSV format
+ */
+func writeSummaryCSV(path string, summaries []summary) error {
+	return writeCSV(path, func(w *csv.Writer) {
+		w.Write(append([]string{"config", "images", "segments", "timeMs", "totalTimeMs",
+			"allocMB", "maxAllocMB"}, scoreHeader...))
+		for _, s := range summaries {
+			row := append([]string{s.Config, strconv.Itoa(s.Images)},
+				formatFloats(s.Segments, s.TimeMs, s.TotalTimeMs)...)
+			row = append(row, formatOptional(s.AllocMB), formatOptional(s.MaxAllocMB))
+			w.Write(append(row, scoreFields(s.Scores)...))
+		}
+	})
+}
+
+func writeCSV(path string, write func(*csv.Writer)) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(out)
+	write(w)
+	w.Flush()
+	if err := w.Error(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+/**
+ * Writes the summaries and the runs to the file path as a JSON object
+ */
+func writeJSON(path string, summaries []summary, runs []run) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(struct {
+		Summaries []summary `json:"summaries"`
+		Runs      []run     `json:"runs"`
+	}{summaries, runs})
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+/**
+ * Prints the summaries as a table. Memory that wasn't measured is printed
+ * as a dash.
+ */
+func printSummaries(w io.Writer, summaries []summary) {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "PRI\tVOI\tGCE\tCOV\tF\tSEGMENTS\tMS\tMB\t")
+	for _, s := range summaries {
+		allocMB := "-"
+		if s.AllocMB != nil {
+			allocMB = fmt.Sprintf("%.1f", *s.AllocMB)
+		}
+		fmt.Fprintf(table, "%.4f\t%.4f\t%.4f\t%.4f\t%.4f\t%.1f\t%.1f\t%s\t  %s\n", s.PRI, s.VOI,
+			s.GCE, s.Covering, s.F, s.Segments, s.TimeMs, allocMB, s.Config)
+	}
+	table.Flush()
+}
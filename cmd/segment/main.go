@@ -0,0 +1,551 @@
+/**
+ * segment is a command line tool to segment many images at once using any of
+ * the algorithms of the segmentation package. It accepts files, directories
+ * and glob patterns and writes the result images to an output directory.
+ *
+ * Usage:
+ *   segment [flags] files|dirs|globs...
+ */
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/miguelfrde/image-segmentation/colorspace"
+	"github.com/miguelfrde/image-segmentation/features"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/miguelfrde/image-segmentation/palette"
+	"github.com/miguelfrde/image-segmentation/segmentation"
+	"github.com/miguelfrde/image-segmentation/sweep"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+/**
+ * Parameters of a segmentation, they're the same ones that the web form takes
+ */
+type options struct {
+	algorithm   string
+	sigma       float64
+	k           float64
+	minSize     int
+	minWeight   float64
+	superpixels int
+	compactness float64
+	segments    int
+	maxSegments int
+	graphType   graph.GraphType
+	weightfn    graph.WeightFn
+	colorSpace  colorspace.Space
+	extractors  []features.Extractor
+	merge       *segmentation.MergeCriterion
+	renderer    segmentation.Renderer
+	rag         bool
+	levels      []float64
+	counts      []int
+	contours    bool
+	outDir      string
+	logger      *slog.Logger
+}
+
+/**
+ * Returns true if the results of the merge hierarchy are written
+ */
+func (opts options) hierarchy() bool {
+	return len(opts.levels) > 0 || len(opts.counts) > 0 || opts.contours
+}
+
+var imageExtensions = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true}
+
+func main() {
+	opts := options{}
+	var graphName, weightName, spaceName, featureNames string
+	var featureWeight, radius, mergeThreshold float64
+	var mergeName string
+	var mergeSegments int
+	var renderName, boundaryColor, paletteName, paletteColors string
+	var levels, counts string
+	var randomColors bool
+	var workers int
+	var verbose bool
+	flag.StringVar(&opts.algorithm, "algorithm", "gbs", "segmentation algorithm: gbs, hmsf, phmsf or slic")
+	flag.Float64Var(&opts.sigma, "sigma", 0.8, "sigma of the gaussian filter used to smooth the image")
+	flag.Float64Var(&opts.k, "k", 300, "k parameter of GBS")
+	flag.IntVar(&opts.minSize, "minsize", 50, "minimum region size of GBS")
+	flag.Float64Var(&opts.minWeight, "minweight", 5, "minimum weight of HMSF")
+	flag.IntVar(&opts.superpixels, "superpixels", 400, "number of superpixels of SLIC")
+	flag.Float64Var(&opts.compactness, "compactness", 10, "compactness of SLIC")
+	flag.IntVar(&opts.segments, "segments", 0,
+		"search the k of GBS or the minweight of HMSF that gives this number of segments")
+	flag.IntVar(&opts.maxSegments, "maxsegments", 0,
+		"accept up to this number of segments in the search, -segments by default")
+	flag.StringVar(&graphName, "graph", "kings", "graph type: kings, grid, 24, disk or nn")
+	flag.Float64Var(&radius, "radius", 2, "radius of the neighborhood of the disk graph")
+	flag.StringVar(&weightName, "weightfn", "euclidean",
+		"weight function: euclidean, intensity or ciede2000")
+	flag.StringVar(&spaceName, "colorspace", "rgb",
+		"color space of the euclidean distance: rgb, lab, luv, hsv, ycbcr or nrgb")
+	flag.StringVar(&featureNames, "features", "",
+		"comma separated texture features: sobel, variance, lbp and gabor")
+	flag.Float64Var(&featureWeight, "featureweight", 0.5,
+		"weight of the texture features against the color, between 0 and 1")
+	flag.StringVar(&mergeName, "merge", "",
+		"merge the resulting regions by color, boundary or count, nothing by default")
+	flag.Float64Var(&mergeThreshold, "mergethreshold", 20,
+		"maximum color distance or boundary weight of the merged regions")
+	flag.IntVar(&mergeSegments, "mergesegments", 10, "number of segments to merge to")
+	flag.BoolVar(&randomColors, "random", false, "use random colors in the result images")
+	flag.StringVar(&paletteName, "palette", "distinct",
+		"how the random colors are chosen: distinct, random or graph (adjacent segments get distant colors)")
+	flag.Int64Var(&opts.renderer.Palette.Seed, "seed", 0, "seed of the random colors")
+	flag.StringVar(&paletteColors, "colors", "",
+		"comma separated hexadecimal colors used as random colors, assigned like the graph palette")
+	flag.StringVar(&renderName, "render", "fill",
+		"how the segments are drawn: fill, boundaries, blend or mask")
+	flag.StringVar(&boundaryColor, "boundarycolor", "#ff0000", "color of the drawn boundaries")
+	flag.IntVar(&opts.renderer.BoundaryWidth, "boundarywidth", 1, "width of the drawn boundaries")
+	flag.Float64Var(&opts.renderer.Opacity, "opacity", 0.5,
+		"opacity of the segment colors blended with the image, between 0 and 1")
+	flag.BoolVar(&opts.rag, "rag", false,
+		"also write the region adjacency graph of every result in the DOT format")
+	flag.StringVar(&levels, "levels", "",
+		"also write the results of the merge hierarchy cut at these levels, like 5,10 or 5:50:5")
+	flag.StringVar(&counts, "counts", "",
+		"also write the results of the merge hierarchy with these numbers of segments")
+	flag.BoolVar(&opts.contours, "contours", false,
+		"also write the ultrametric contour map of the merge hierarchy of every result")
+	flag.StringVar(&opts.outDir, "out", ".", "directory where the result images are written")
+	flag.IntVar(&workers, "workers", runtime.NumCPU(), "number of images segmented concurrently")
+	flag.BoolVar(&verbose, "verbose", false, "log the phases of every segmentation to stderr")
+	flag.Parse()
+
+	opts.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	if verbose {
+		opts.logger = slog.New(slog.NewTextHandler(os.Stderr,
+			&slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+
+	var err error
+	if opts.graphType, err = parseGraphType(graphName, radius); err != nil {
+		exit(err)
+	}
+	if opts.colorSpace, err = colorspace.Parse(spaceName); err != nil {
+		exit(err)
+	}
+	if opts.weightfn, err = parseWeightFn(weightName); err != nil {
+		exit(err)
+	}
+	if weightName == "ciede2000" {
+		opts.colorSpace = colorspace.LAB
+	}
+	if opts.extractors, err = parseFeatures(featureNames); err != nil {
+		exit(err)
+	}
+	if opts.merge, err = parseMerge(mergeName, mergeThreshold, mergeSegments); err != nil {
+		exit(err)
+	}
+	if opts.renderer.Mode, err = segmentation.ParseRenderMode(renderName); err != nil {
+		exit(err)
+	}
+	if opts.renderer.BoundaryColor, err = colorspace.ParseHex(boundaryColor); err != nil {
+		exit(err)
+	}
+	if width := opts.renderer.BoundaryWidth; width < 1 || width > segmentation.MAX_BOUNDARY_WIDTH {
+		exit(fmt.Errorf("-boundarywidth must be between 1 and %d", segmentation.MAX_BOUNDARY_WIDTH))
+	}
+	if opts.renderer.Opacity < 0 || opts.renderer.Opacity > 1 {
+		exit(fmt.Errorf("-opacity must be between 0 and 1"))
+	}
+	if opts.renderer.Palette.Mode, err = palette.Parse(paletteName); err != nil {
+		exit(err)
+	}
+	if paletteColors != "" {
+		if opts.renderer.Palette.Colors, err = palette.ParseColors(paletteColors); err != nil {
+			exit(err)
+		}
+	}
+	opts.renderer.RandomColors = randomColors
+	if len(opts.extractors) > 0 {
+		opts.weightfn = segmentation.TextureWeight(opts.weightfn, featureWeight)
+	}
+	switch opts.algorithm {
+	case "gbs", "hmsf", "phmsf", "slic":
+	default:
+		exit(fmt.Errorf("unknown algorithm %q", opts.algorithm))
+	}
+	if opts.segments < 0 || (opts.segments > 0 && opts.algorithm == "slic") {
+		exit(fmt.Errorf("-segments must be positive and can only be used with gbs, hmsf and phmsf"))
+	}
+	if opts.algorithm == "slic" && opts.superpixels < 1 {
+		exit(fmt.Errorf("-superpixels must be positive"))
+	}
+	if levels != "" {
+		if opts.levels, err = sweep.ParseValues(levels); err != nil {
+			exit(fmt.Errorf("-levels: %v", err))
+		}
+	}
+	if counts != "" {
+		if opts.counts, err = sweep.ParseInts(counts); err != nil {
+			exit(fmt.Errorf("-counts: %v", err))
+		}
+		for _, count := range opts.counts {
+			if count < 1 {
+				exit(fmt.Errorf("-counts: %d is not positive", count))
+			}
+		}
+	}
+	if opts.hierarchy() && opts.algorithm == "slic" {
+		exit(fmt.Errorf("-levels, -counts and -contours need a merge hierarchy, which slic doesn't build"))
+	}
+	files, err := collectFiles(flag.Args())
+	if err != nil {
+		exit(err)
+	}
+	if len(files) == 0 {
+		exit(fmt.Errorf("no input images"))
+	}
+	outputs, err := outputPaths(files, opts)
+	if err != nil {
+		exit(err)
+	}
+	if err := os.MkdirAll(opts.outDir, 0755); err != nil {
+		exit(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	failed := false
+	for result := range segmentAll(ctx, files, outputs, opts, workers) {
+		if result.err != nil {
+			failed = true
+			fmt.Fprintln(os.Stderr, result.input+":", result.err)
+		} else {
+			fmt.Println(result.input, "->", result.output)
+		}
+	}
+	if failed || ctx.Err() != nil {
+		stop()
+		os.Exit(1)
+	}
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, "segment:", err)
+	os.Exit(2)
+}
+
+func parseGraphType(name string, radius float64) (graph.GraphType, error) {
+	switch name {
+	case "kings":
+		return graph.KINGSGRAPH, nil
+	case "grid":
+		return graph.GRIDGRAPH, nil
+	case "nn":
+		return graph.NNGRAPH, nil
+	case "24":
+		return graph.GRAPH24, nil
+	case "disk":
+		if radius < 1 {
+			return 0, fmt.Errorf("the radius must be at least 1")
+		}
+		return graph.DiskGraph(radius), nil
+	}
+	return 0, fmt.Errorf("unknown graph type %q", name)
+}
+
+func parseWeightFn(name string) (graph.WeightFn, error) {
+	switch name {
+	case "euclidean":
+		return segmentation.ColorDistance, nil
+	case "intensity":
+		return segmentation.IntensityDifference, nil
+	case "ciede2000":
+		return segmentation.CIEDE2000Weight, nil
+	}
+	return nil, fmt.Errorf("unknown weight function %q", name)
+}
+
+func parseMerge(name string, threshold float64, segments int) (*segmentation.MergeCriterion, error) {
+	var criterion segmentation.MergeCriterion
+	switch name {
+	case "":
+		return nil, nil
+	case "color":
+		criterion = segmentation.MergeByColor(threshold)
+	case "boundary":
+		criterion = segmentation.MergeByBoundary(threshold)
+	case "count":
+		if segments < 1 {
+			return nil, fmt.Errorf("the number of segments must be positive")
+		}
+		criterion = segmentation.MergeToCount(segments)
+	default:
+		return nil, fmt.Errorf("unknown merge criterion %q", name)
+	}
+	return &criterion, nil
+}
+
+func parseFeatures(names string) ([]features.Extractor, error) {
+	var extractors []features.Extractor
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		extractor, err := features.Parse(name)
+		if err != nil {
+			return nil, err
+		}
+		extractors = append(extractors, extractor)
+	}
+	return extractors, nil
+}
+
+/**
+ * Expands the arguments into a sorted list of image files. Arguments can be
+ * files, directories (all the images directly inside them) or glob patterns.
+ */
+func collectFiles(args []string) ([]string, error) {
+	seen := make(map[string]bool)
+	files := make([]string, 0, len(args))
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: no such file", arg)
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(match)
+				continue
+			}
+			entries, err := filepath.Glob(filepath.Join(match, "*"))
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if imageExtensions[strings.ToLower(filepath.Ext(entry))] {
+					add(entry)
+				}
+			}
+		}
+	}
+	return files, nil
+}
+
+type result struct {
+	input, output string
+	err           error
+}
+
+/**
+ * Segments all the files using the given number of workers and writes their
+ * results to the paths that outputs maps them to. Results are sent through
+ * the returned channel as soon as they're ready. Once ctx is done the
+ * running segmentations are stopped and no more files are started.
+ */
+func segmentAll(ctx context.Context, files []string, outputs map[string]string, opts options,
+	workers int) <-chan result {
+	if workers < 1 {
+		workers = 1
+	}
+	inputs := make(chan string)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for input := range inputs {
+				err := segmentFile(ctx, input, outputs[input], opts)
+				results <- result{input: input, output: outputs[input], err: err}
+			}
+		}()
+	}
+	go func() {
+		for _, file := range files {
+			if ctx.Err() != nil {
+				break
+			}
+			inputs <- file
+		}
+		close(inputs)
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+/**
+ * Returns the path of the result image of the given input. It only depends
+ * on the input name and the algorithm, so running the tool twice overwrites
+ * the previous results.
+ */
+func outputPath(input string, opts options) string {
+	base := filepath.Base(input)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	return filepath.Join(opts.outDir, base+"_"+opts.algorithm+".png")
+}
+
+/**
+ * Returns the path of the result image of every file indexed by the file,
+ * or an error if two files would write the same result image, like
+ * a/img.png and b/img.png or img.png and img.jpg do
+ */
+func outputPaths(files []string, opts options) (map[string]string, error) {
+	outputs := make(map[string]string, len(files))
+	inputs := make(map[string]string, len(files))
+	for _, file := range files {
+		output := outputPath(file, opts)
+		if other, ok := inputs[output]; ok {
+			return nil, fmt.Errorf("%s and %s would both be written to %s, segment them separately",
+				other, file, output)
+		}
+		inputs[output] = file
+		outputs[file] = output
+	}
+	return outputs, nil
+}
+
+/**
+ * Segments a single image and writes the result image to the path output
+ */
+func segmentFile(ctx context.Context, input, output string, opts options) error {
+	f, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	segmenter := segmentation.New(img, opts.graphType, opts.weightfn,
+		segmentation.WithLogger(opts.logger.With("input", input)))
+	segmenter.SetRenderer(opts.renderer)
+	segmenter.SetColorSpace(opts.colorSpace)
+	segmenter.SetFeatures(opts.extractors...)
+	segmenter.SetRecordHierarchy(opts.hierarchy())
+	switch opts.algorithm {
+	case "gbs":
+		if opts.segments > 0 {
+			_, _, err = segmenter.SegmentGBSToCountContext(ctx, opts.sigma, opts.minSize,
+				opts.segments, opts.maxSegments)
+		} else {
+			_, err = segmenter.SegmentGBSContext(ctx, opts.sigma, opts.k, opts.minSize)
+		}
+	case "hmsf":
+		if opts.segments > 0 {
+			_, _, err = segmenter.SegmentHMSFToCountContext(ctx, opts.sigma, opts.segments,
+				opts.maxSegments)
+		} else {
+			_, err = segmenter.SegmentHMSFContext(ctx, opts.sigma, opts.minWeight)
+		}
+	case "phmsf":
+		if opts.segments > 0 {
+			_, _, err = segmenter.SegmentPHMSFToCountContext(ctx, opts.sigma, opts.segments,
+				opts.maxSegments)
+		} else {
+			_, err = segmenter.SegmentPHMSFContext(ctx, opts.sigma, opts.minWeight)
+		}
+	case "slic":
+		_, err = segmenter.SegmentSLICContext(ctx, opts.superpixels, opts.compactness)
+	}
+	if err == nil && opts.merge != nil {
+		_, err = segmenter.MergeRegionsContext(ctx, *opts.merge)
+	}
+	if err != nil {
+		return err
+	}
+
+	base := strings.TrimSuffix(output, ".png")
+	if opts.rag {
+		if err := writeRAG(base+".dot", segmenter.GetRAG()); err != nil {
+			return err
+		}
+	}
+	if hierarchy := segmenter.GetHierarchy(); hierarchy != nil {
+		for _, level := range opts.levels {
+			path := fmt.Sprintf("%s_level%g.png", base, level)
+			if err := writeLabels(path, hierarchy.LabelsAtLevel(level), img, opts.renderer); err != nil {
+				return err
+			}
+		}
+		for _, count := range opts.counts {
+			path := fmt.Sprintf("%s_count%d.png", base, count)
+			if err := writeLabels(path, hierarchy.LabelsForCount(count), img, opts.renderer); err != nil {
+				return err
+			}
+		}
+		if opts.contours {
+			if err := writePNG(base+"_contours.png", hierarchy.ContourMap()); err != nil {
+				return err
+			}
+		}
+	}
+	return writePNG(output, segmenter.GetResultImage())
+}
+
+/**
+ * Writes the segments of labels drawn over the image img by the renderer to
+ * the file path in the PNG format
+ */
+func writeLabels(path string, labels *segmentation.Labels, img image.Image,
+	renderer segmentation.Renderer) error {
+	rendered, err := renderer.Render(labels, img)
+	if err != nil {
+		return err
+	}
+	return writePNG(path, rendered)
+}
+
+/**
+ * Writes the image img to the file path in the PNG format
+ */
+func writePNG(path string, img image.Image) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(out, img); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+/**
+ * Writes the region adjacency graph rag to the file path in the DOT format
+ */
+func writeRAG(path string, rag *segmentation.RAG) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := rag.WriteDOT(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,263 @@
+/**
+ * sweep segments an image with every combination of ranges of parameter
+ * values and writes a contact sheet with the result of every setting and a
+ * JSON index with their parameters and segment counts. Parameters take comma
+ * separated values and start:stop:step ranges, like -sigma 0.5:1.5:0.5.
+ *
+ * Usage:
+ *   sweep [flags] images...
+ */
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/miguelfrde/image-segmentation/colorspace"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/miguelfrde/image-segmentation/palette"
+	"github.com/miguelfrde/image-segmentation/segmentation"
+	"github.com/miguelfrde/image-segmentation/sweep"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+/**
+ * Parameters of a sweep, the ranges are already expanded
+ */
+type options struct {
+	algorithm    string
+	sigmas       []float64
+	ks           []float64
+	minSizes     []int
+	minWeights   []float64
+	superpixels  []int
+	compactness  []float64
+	graphType    graph.GraphType
+	weightfn     graph.WeightFn
+	colorSpace   colorspace.Space
+	randomColors bool
+	palette      palette.Palette
+	columns      int
+	thumbWidth   int
+	outDir       string
+}
+
+func main() {
+	opts := options{}
+	var sigmas, ks, minSizes, minWeights, superpixels, compactness string
+	var graphName, weightName, spaceName, paletteName string
+	var radius float64
+	flag.StringVar(&opts.algorithm, "algorithm", "gbs", "segmentation algorithm: gbs, hmsf, phmsf or slic")
+	flag.StringVar(&sigmas, "sigma", "0.8", "sigmas of the gaussian filter used to smooth the image")
+	flag.StringVar(&ks, "k", "300", "k parameters of GBS")
+	flag.StringVar(&minSizes, "minsize", "50", "minimum region sizes of GBS")
+	flag.StringVar(&minWeights, "minweight", "5", "minimum weights of HMSF")
+	flag.StringVar(&superpixels, "superpixels", "400", "numbers of superpixels of SLIC")
+	flag.StringVar(&compactness, "compactness", "10", "compactness values of SLIC")
+	flag.StringVar(&graphName, "graph", "kings", "graph type: kings, grid, 24, disk or nn")
+	flag.Float64Var(&radius, "radius", 2, "radius of the neighborhood of the disk graph")
+	flag.StringVar(&weightName, "weightfn", "euclidean",
+		"weight function: euclidean, intensity or ciede2000")
+	flag.StringVar(&spaceName, "colorspace", "rgb",
+		"color space of the euclidean distance: rgb, lab, luv, hsv, ycbcr or nrgb")
+	flag.BoolVar(&opts.randomColors, "random", false, "use random colors in the result images")
+	flag.StringVar(&paletteName, "palette", "distinct",
+		"how the random colors are chosen: distinct, random or graph")
+	flag.Int64Var(&opts.palette.Seed, "seed", 0, "seed of the random colors")
+	flag.IntVar(&opts.columns, "columns", 0, "columns of the contact sheet, a square grid by default")
+	flag.IntVar(&opts.thumbWidth, "width", sweep.THUMB_WIDTH, "width of the thumbnails")
+	flag.StringVar(&opts.outDir, "out", ".", "directory where the contact sheets are written")
+	flag.Parse()
+
+	var err error
+	if opts.sigmas, err = parseValues("sigma", sigmas); err != nil {
+		exit(err)
+	}
+	if opts.ks, err = parseValues("k", ks); err != nil {
+		exit(err)
+	}
+	if opts.minSizes, err = parseInts("minsize", minSizes); err != nil {
+		exit(err)
+	}
+	if opts.minWeights, err = parseValues("minweight", minWeights); err != nil {
+		exit(err)
+	}
+	if opts.superpixels, err = parseInts("superpixels", superpixels); err != nil {
+		exit(err)
+	}
+	for _, n := range opts.superpixels {
+		if n < 1 {
+			exit(fmt.Errorf("-superpixels: %d is not positive", n))
+		}
+	}
+	if opts.compactness, err = parseValues("compactness", compactness); err != nil {
+		exit(err)
+	}
+	if opts.graphType, err = parseGraphType(graphName, radius); err != nil {
+		exit(err)
+	}
+	if opts.colorSpace, err = colorspace.Parse(spaceName); err != nil {
+		exit(err)
+	}
+	if opts.weightfn, err = parseWeightFn(weightName); err != nil {
+		exit(err)
+	}
+	if opts.palette.Mode, err = palette.Parse(paletteName); err != nil {
+		exit(err)
+	}
+	if weightName == "ciede2000" {
+		opts.colorSpace = colorspace.LAB
+	}
+	switch opts.algorithm {
+	case "gbs", "hmsf", "phmsf", "slic":
+	default:
+		exit(fmt.Errorf("unknown algorithm %q", opts.algorithm))
+	}
+	if flag.NArg() == 0 {
+		exit(fmt.Errorf("no input images"))
+	}
+	if err := os.MkdirAll(opts.outDir, 0755); err != nil {
+		exit(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	failed := false
+	for _, input := range flag.Args() {
+		sheet, err := sweepFile(ctx, input, opts)
+		if ctx.Err() != nil {
+			stop()
+			os.Exit(1)
+		}
+		if err != nil {
+			failed = true
+			fmt.Fprintln(os.Stderr, input+":", err)
+			continue
+		}
+		fmt.Println(input, "->", sheet)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, "sweep:", err)
+	os.Exit(2)
+}
+
+func parseValues(name, spec string) ([]float64, error) {
+	values, err := sweep.ParseValues(spec)
+	if err != nil {
+		return nil, fmt.Errorf("-%s: %v", name, err)
+	}
+	return values, nil
+}
+
+func parseInts(name, spec string) ([]int, error) {
+	values, err := sweep.ParseInts(spec)
+	if err != nil {
+		return nil, fmt.Errorf("-%s: %v", name, err)
+	}
+	return values, nil
+}
+
+func parseGraphType(name string, radius float64) (graph.GraphType, error) {
+	switch name {
+	case "kings":
+		return graph.KINGSGRAPH, nil
+	case "grid":
+		return graph.GRIDGRAPH, nil
+	case "nn":
+		return graph.NNGRAPH, nil
+	case "24":
+		return graph.GRAPH24, nil
+	case "disk":
+		if radius < 1 {
+			return 0, fmt.Errorf("the radius must be at least 1")
+		}
+		return graph.DiskGraph(radius), nil
+	}
+	return 0, fmt.Errorf("unknown graph type %q", name)
+}
+
+func parseWeightFn(name string) (graph.WeightFn, error) {
+	switch name {
+	case "euclidean":
+		return segmentation.ColorDistance, nil
+	case "intensity":
+		return segmentation.IntensityDifference, nil
+	case "ciede2000":
+		return segmentation.CIEDE2000Weight, nil
+	}
+	return nil, fmt.Errorf("unknown weight function %q", name)
+}
+
+/**
+ * Runs the sweep on a single image and writes its contact sheet and index.
+ * Returns the path of the contact sheet.
+ */
+func sweepFile(ctx context.Context, input string, opts options) (string, error) {
+	f, err := os.Open(input)
+	if err != nil {
+		return "", err
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return "", err
+	}
+
+	segmenter := segmentation.New(img, opts.graphType, opts.weightfn)
+	segmenter.SetRandomColors(opts.randomColors)
+	segmenter.SetPalette(opts.palette)
+	segmenter.SetColorSpace(opts.colorSpace)
+	var results []segmentation.SweepResult
+	switch opts.algorithm {
+	case "gbs":
+		results, err = segmenter.SweepGBSContext(ctx, opts.sigmas, opts.ks, opts.minSizes)
+	case "hmsf":
+		results, err = segmenter.SweepHMSFContext(ctx, opts.sigmas, opts.minWeights)
+	case "phmsf":
+		results, err = segmenter.SweepPHMSFContext(ctx, opts.sigmas, opts.minWeights)
+	case "slic":
+		results, err = segmenter.SweepSLICContext(ctx, opts.superpixels, opts.compactness)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	sheet := sweep.NewSheet(results, opts.columns, opts.thumbWidth)
+	base := filepath.Base(input)
+	base = filepath.Join(opts.outDir, strings.TrimSuffix(base, filepath.Ext(base))+"_sweep")
+	if err := writeFile(base+".json", sheet.WriteIndex); err != nil {
+		return "", err
+	}
+	err = writeFile(base+".png", func(out io.Writer) error {
+		return png.Encode(out, sheet.Image)
+	})
+	return base + ".png", err
+}
+
+/**
+ * Creates the file path and writes it with the function write
+ */
+func writeFile(path string, write func(io.Writer) error) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,84 @@
+package colorspace
+
+import (
+	"math"
+)
+
+/**
+ * Returns the CIEDE2000 color difference between two colors given by their
+ * CIELAB values, with the parametric weighting factors kL, kC and kH set to 1.
+ * Based on: "The CIEDE2000 Color-Difference Formula: Implementation Notes,
+ * Supplementary Test Data, and Mathematical Observations" by Sharma et al.
+ */
+func CIEDE2000(lab1, lab2 [3]float64) float64 {
+	l1, a1, b1 := lab1[0], lab1[1], lab1[2]
+	l2, a2, b2 := lab2[0], lab2[1], lab2[2]
+
+	meanC := (math.Hypot(a1, b1) + math.Hypot(a2, b2)) / 2
+	g := 0.5 * (1 - math.Sqrt(pow7(meanC)/(pow7(meanC)+pow7(25))))
+	a1p, a2p := (1+g)*a1, (1+g)*a2
+	c1p, c2p := math.Hypot(a1p, b1), math.Hypot(a2p, b2)
+	h1p, h2p := hueAngle(b1, a1p), hueAngle(b2, a2p)
+
+	dLp := l2 - l1
+	dCp := c2p - c1p
+	dhp := 0.0
+	if c1p*c2p != 0 {
+		dhp = h2p - h1p
+		if dhp > 180 {
+			dhp -= 360
+		} else if dhp < -180 {
+			dhp += 360
+		}
+	}
+	dHp := 2 * math.Sqrt(c1p*c2p) * math.Sin(radians(dhp/2))
+
+	meanL := (l1 + l2) / 2
+	meanCp := (c1p + c2p) / 2
+	meanHp := h1p + h2p
+	if c1p*c2p != 0 {
+		if math.Abs(h1p-h2p) <= 180 {
+			meanHp = (h1p + h2p) / 2
+		} else if h1p+h2p < 360 {
+			meanHp = (h1p + h2p + 360) / 2
+		} else {
+			meanHp = (h1p + h2p - 360) / 2
+		}
+	}
+
+	t := 1 - 0.17*math.Cos(radians(meanHp-30)) + 0.24*math.Cos(radians(2*meanHp)) +
+		0.32*math.Cos(radians(3*meanHp+6)) - 0.20*math.Cos(radians(4*meanHp-63))
+	dTheta := 30 * math.Exp(-math.Pow((meanHp-275)/25, 2))
+	rc := 2 * math.Sqrt(pow7(meanCp)/(pow7(meanCp)+pow7(25)))
+	lm := (meanL - 50) * (meanL - 50)
+	sl := 1 + 0.015*lm/math.Sqrt(20+lm)
+	sc := 1 + 0.045*meanCp
+	sh := 1 + 0.015*meanCp*t
+	rt := -math.Sin(radians(2*dTheta)) * rc
+
+	dl, dc, dh := dLp/sl, dCp/sc, dHp/sh
+	return math.Sqrt(dl*dl + dc*dc + dh*dh + rt*dc*dh)
+}
+
+func pow7(x float64) float64 {
+	x2 := x * x
+	return x2 * x2 * x2 * x
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+/**
+ * Returns the hue angle in degrees between 0 and 360 of the point (a, b)
+ */
+func hueAngle(b, a float64) float64 {
+	if a == 0 && b == 0 {
+		return 0
+	}
+	h := math.Atan2(b, a) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
@@ -0,0 +1,367 @@
+/**
+ * Package colorspace converts colors and images from RGB to other color
+ * spaces and computes distances between colors in those spaces. Images are
+ * converted once so that the weight functions don't need to convert every
+ * pixel for each one of its edges.
+ */
+package colorspace
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Color space of the values of a Color
+ */
+type Space int
+
+const (
+	RGB Space = iota
+	LAB
+	LUV
+	HSV
+	YCBCR
+	NRGB
+)
+
+var spaceNames = map[Space]string{
+	RGB:   "rgb",
+	LAB:   "lab",
+	LUV:   "luv",
+	HSV:   "hsv",
+	YCBCR: "ycbcr",
+	NRGB:  "nrgb",
+}
+
+/**
+ * D65 reference white in the XYZ space
+ */
+const (
+	WHITE_X = 0.95047
+	WHITE_Y = 1.0
+	WHITE_Z = 1.08883
+)
+
+func (space Space) String() string {
+	if name, ok := spaceNames[space]; ok {
+		return name
+	}
+	return fmt.Sprintf("Space(%d)", int(space))
+}
+
+/**
+ * Returns the color space with the given name: rgb, lab, luv, hsv, ycbcr or
+ * nrgb (normalized rgb)
+ */
+func Parse(name string) (Space, error) {
+	for space, spaceName := range spaceNames {
+		if spaceName == name {
+			return space, nil
+		}
+	}
+	return RGB, fmt.Errorf("unknown color space %q", name)
+}
+
+/**
+ * Returns the opaque color written in hexadecimal as #rrggbb or #rgb, the #
+ * being optional
+ */
+func ParseHex(hex string) (color.RGBA, error) {
+	digits := strings.TrimPrefix(hex, "#")
+	if len(digits) == 3 {
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	}
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if len(digits) != 6 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", hex)
+	}
+	return color.RGBA{uint8(value >> 16), uint8(value >> 8), uint8(value), 255}, nil
+}
+
+/**
+ * A color together with its values in some color space. It still behaves
+ * as the original color.Color, so it can be used wherever the original one
+ * was used.
+ */
+type Color struct {
+	color.Color
+	Space  Space
+	Values [3]float64
+}
+
+/**
+ * Returns the values of the color clr in the given space:
+ *  - RGB: r, g and b between 0 and 255
+ *  - LAB: CIELAB L*, a* and b* using the D65 white point
+ *  - LUV: CIELUV L*, u* and v* using the D65 white point
+ *  - HSV: hue in degrees, saturation and value between 0 and 1
+ *  - YCBCR: full range (JPEG) Y, Cb and Cr between 0 and 255
+ *  - NRGB: r, g and b divided by r + g + b
+ */
+func Convert(clr color.Color, space Space) [3]float64 {
+	switch space {
+	case LAB:
+		l, a, b := ToLab(clr)
+		return [3]float64{l, a, b}
+	case LUV:
+		l, u, v := ToLuv(clr)
+		return [3]float64{l, u, v}
+	case HSV:
+		h, s, v := ToHSV(clr)
+		return [3]float64{h, s, v}
+	case YCBCR:
+		y, cb, cr := ToYCbCr(clr)
+		return [3]float64{y, cb, cr}
+	case NRGB:
+		r, g, b := ToNormalizedRGB(clr)
+		return [3]float64{r, g, b}
+	}
+	r, g, b := rgb(clr)
+	return [3]float64{r * 255, g * 255, b * 255}
+}
+
+/**
+ * Returns the r, g and b components of clr between 0 and 1
+ */
+func rgb(clr color.Color) (float64, float64, float64) {
+	r, g, b, _ := clr.RGBA()
+	return float64(r>>8) / 255, float64(g>>8) / 255, float64(b>>8) / 255
+}
+
+/**
+ * Converts the color clr to the XYZ space, assuming that it's sRGB
+ */
+func toXYZ(clr color.Color) (float64, float64, float64) {
+	linear := func(v float64) float64 {
+		if v <= 0.04045 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	r, g, b := rgb(clr)
+	lr, lg, lb := linear(r), linear(g), linear(b)
+	x := 0.4124564*lr + 0.3575761*lg + 0.1804375*lb
+	y := 0.2126729*lr + 0.7151522*lg + 0.0721750*lb
+	z := 0.0193339*lr + 0.1191920*lg + 0.9503041*lb
+	return x, y, z
+}
+
+/**
+ * Nonlinear function used by CIELAB and CIELUV to compute the lightness
+ */
+func labF(t float64) float64 {
+	if t > 216.0/24389.0 {
+		return math.Cbrt(t)
+	}
+	return (24389.0/27.0*t + 16) / 116
+}
+
+/**
+ * Converts the color clr to the CIELAB color space using the D65 white
+ * point. Returns the L, a and b components in that order.
+ */
+func ToLab(clr color.Color) (float64, float64, float64) {
+	x, y, z := toXYZ(clr)
+	fx, fy, fz := labF(x/WHITE_X), labF(y/WHITE_Y), labF(z/WHITE_Z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+/**
+ * Converts the CIELAB color with the components l, a and b, using the D65
+ * white point, to sRGB. Colors outside of the sRGB gamut are clamped to it,
+ * and in that case it also returns false.
+ */
+func FromLab(l, a, b float64) (color.RGBA, bool) {
+	inverseF := func(t float64) float64 {
+		if t > 6.0/29.0 {
+			return t * t * t
+		}
+		return (116*t - 16) * 27 / 24389
+	}
+	fy := (l + 16) / 116
+	x := WHITE_X * inverseF(fy+a/500)
+	y := WHITE_Y * inverseF(fy)
+	z := WHITE_Z * inverseF(fy-b/200)
+	inGamut := true
+	gamma := func(v float64) uint8 {
+		if v < 0 || v > 1 {
+			/* Tolerates the rounding errors of the conversion */
+			inGamut = inGamut && v > -1e-6 && v < 1+1e-6
+			v = math.Max(0, math.Min(1, v))
+		}
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		return uint8(math.Round(v * 255))
+	}
+	clr := color.RGBA{
+		gamma(3.2404542*x - 1.5371385*y - 0.4985314*z),
+		gamma(-0.9692660*x + 1.8760108*y + 0.0415560*z),
+		gamma(0.0556434*x - 0.2040259*y + 1.0572252*z),
+		255,
+	}
+	return clr, inGamut
+}
+
+/**
+ * Converts the color clr to the CIELUV color space using the D65 white
+ * point. Returns the L, u and v components in that order.
+ */
+func ToLuv(clr color.Color) (float64, float64, float64) {
+	x, y, z := toXYZ(clr)
+	l := 116*labF(y/WHITE_Y) - 16
+	denominator := x + 15*y + 3*z
+	if denominator == 0 {
+		return l, 0, 0
+	}
+	whiteDenominator := WHITE_X + 15*WHITE_Y + 3*WHITE_Z
+	du := 4*x/denominator - 4*WHITE_X/whiteDenominator
+	dv := 9*y/denominator - 9*WHITE_Y/whiteDenominator
+	return l, 13 * l * du, 13 * l * dv
+}
+
+/**
+ * Converts the color clr to the HSV color space. Returns the hue in degrees
+ * and the saturation and value between 0 and 1.
+ */
+func ToHSV(clr color.Color) (float64, float64, float64) {
+	r, g, b := rgb(clr)
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	delta := max - min
+	if max == 0 {
+		return 0, 0, 0
+	}
+	if delta == 0 {
+		return 0, 0, max
+	}
+	var h float64
+	switch max {
+	case r:
+		h = math.Mod((g-b)/delta, 6)
+	case g:
+		h = (b-r)/delta + 2
+	default:
+		h = (r-g)/delta + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+	return h, delta / max, max
+}
+
+/**
+ * Converts the color clr to the full range YCbCr color space used by JPEG.
+ * Returns the Y, Cb and Cr components between 0 and 255.
+ */
+func ToYCbCr(clr color.Color) (float64, float64, float64) {
+	r, g, b := rgb(clr)
+	r, g, b = r*255, g*255, b*255
+	y := 0.299*r + 0.587*g + 0.114*b
+	cb := 128 - 0.168736*r - 0.331264*g + 0.5*b
+	cr := 128 + 0.5*r - 0.418688*g - 0.081312*b
+	return y, cb, cr
+}
+
+/**
+ * Converts the color clr to normalized rgb, where every component is divided
+ * by their sum so that the result doesn't depend on the lighting. Black is
+ * converted to gray.
+ */
+func ToNormalizedRGB(clr color.Color) (float64, float64, float64) {
+	r, g, b := rgb(clr)
+	sum := r + g + b
+	if sum == 0 {
+		return 1.0 / 3, 1.0 / 3, 1.0 / 3
+	}
+	return r / sum, g / sum, b / sum
+}
+
+/**
+ * Returns the distance between the values c1 and c2 of two colors in the
+ * given space. It's the Euclidean distance except in HSV, where it's the
+ * distance in the HSV cone. HSV and NRGB distances are multiplied by 255 so
+ * that they're in a range similar to the RGB ones.
+ */
+func Distance(c1, c2 [3]float64, space Space) float64 {
+	switch space {
+	case HSV:
+		return 255 * euclidean(hsvCone(c1), hsvCone(c2))
+	case NRGB:
+		return 255 * euclidean(c1, c2)
+	}
+	return euclidean(c1, c2)
+}
+
+func euclidean(c1, c2 [3]float64) float64 {
+	d0, d1, d2 := c1[0]-c2[0], c1[1]-c2[1], c1[2]-c2[2]
+	return math.Sqrt(d0*d0 + d1*d1 + d2*d2)
+}
+
+/**
+ * Returns the cartesian coordinates of an HSV color in the HSV cone
+ */
+func hsvCone(hsv [3]float64) [3]float64 {
+	h := hsv[0] * math.Pi / 180
+	return [3]float64{hsv[1] * hsv[2] * math.Cos(h), hsv[1] * hsv[2] * math.Sin(h), hsv[2]}
+}
+
+/**
+ * Image whose colors have been converted to some color space. At returns
+ * a Color.
+ */
+type Image struct {
+	Space    Space
+	Values   [][3]float64
+	original image.Image
+}
+
+/**
+ * Converts all the pixels of the image img to the given space
+ */
+func ConvertImage(img image.Image, space Space) *Image {
+	bounds := img.Bounds()
+	converted := &Image{Space: space, original: img,
+		Values: make([][3]float64, bounds.Dx()*bounds.Dy(), bounds.Dx()*bounds.Dy())}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			converted.Values[converted.index(x, y)] = Convert(img.At(x, y), space)
+		}
+	}
+	return converted
+}
+
+func (img *Image) index(x, y int) int {
+	bounds := img.original.Bounds()
+	return (x - bounds.Min.X) + (y-bounds.Min.Y)*bounds.Dx()
+}
+
+func (img *Image) ColorModel() color.Model {
+	return img.original.ColorModel()
+}
+
+func (img *Image) Bounds() image.Rectangle {
+	return img.original.Bounds()
+}
+
+func (img *Image) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(img.Bounds())) {
+		return img.original.At(x, y)
+	}
+	return Color{Color: img.original.At(x, y), Space: img.Space, Values: img.Values[img.index(x, y)]}
+}
+
+/**
+ * Returns the values of the pixel (x, y) in the space of the image
+ */
+func (img *Image) ValuesAt(x, y int) [3]float64 {
+	return img.Values[img.index(x, y)]
+}
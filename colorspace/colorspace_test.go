@@ -0,0 +1,148 @@
+package colorspace
+
+import (
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"testing"
+)
+
+var red = color.RGBA{255, 0, 0, 255}
+
+func TestParseSpaceNames(t *testing.T) {
+	for _, space := range []Space{RGB, LAB, LUV, HSV, YCBCR, NRGB} {
+		parsed, err := Parse(space.String())
+		assert.Nil(t, err)
+		assert.Equal(t, space, parsed)
+	}
+	_, err := Parse("cmyk")
+	assert.NotNil(t, err)
+}
+
+func TestParseHex(t *testing.T) {
+	clr, err := ParseHex("#ff8000")
+	assert.Nil(t, err)
+	assert.Equal(t, color.RGBA{255, 128, 0, 255}, clr)
+	clr, err = ParseHex("0af")
+	assert.Nil(t, err)
+	assert.Equal(t, color.RGBA{0, 170, 255, 255}, clr)
+	for _, hex := range []string{"", "#ff80", "#gg0000", "#ff00000", "+ff000"} {
+		_, err = ParseHex(hex)
+		assert.NotNil(t, err, hex)
+	}
+}
+
+func TestLabOfWhite(t *testing.T) {
+	l, a, b := ToLab(color.White)
+	assert.InDelta(t, 100.0, l, 0.01)
+	assert.InDelta(t, 0.0, a, 0.01)
+	assert.InDelta(t, 0.0, b, 0.01)
+}
+
+func TestLabOfRed(t *testing.T) {
+	l, a, b := ToLab(red)
+	assert.InDelta(t, 53.24, l, 0.01)
+	assert.InDelta(t, 80.09, a, 0.01)
+	assert.InDelta(t, 67.20, b, 0.01)
+}
+
+func TestFromLab(t *testing.T) {
+	for _, clr := range []color.RGBA{red, {0, 0, 0, 255}, {255, 255, 255, 255}, {30, 144, 200, 255}} {
+		l, a, b := ToLab(clr)
+		converted, inGamut := FromLab(l, a, b)
+		assert.True(t, inGamut)
+		assert.Equal(t, clr, converted)
+	}
+	_, inGamut := FromLab(50, 120, 0)
+	assert.False(t, inGamut)
+}
+
+func TestLuvOfWhite(t *testing.T) {
+	l, u, v := ToLuv(color.White)
+	assert.InDelta(t, 100.0, l, 0.01)
+	assert.InDelta(t, 0.0, u, 0.01)
+	assert.InDelta(t, 0.0, v, 0.01)
+}
+
+func TestLuvOfRed(t *testing.T) {
+	l, u, v := ToLuv(red)
+	assert.InDelta(t, 53.24, l, 0.01)
+	assert.InDelta(t, 175.01, u, 0.05)
+	assert.InDelta(t, 37.76, v, 0.05)
+}
+
+func TestLuvOfBlack(t *testing.T) {
+	l, u, v := ToLuv(color.Black)
+	assert.Equal(t, 0.0, l)
+	assert.Equal(t, 0.0, u)
+	assert.Equal(t, 0.0, v)
+}
+
+func TestHSV(t *testing.T) {
+	h, s, v := ToHSV(red)
+	assert.Equal(t, []float64{0, 1, 1}, []float64{h, s, v})
+	h, s, v = ToHSV(color.RGBA{0, 0, 255, 255})
+	assert.Equal(t, []float64{240, 1, 1}, []float64{h, s, v})
+	h, s, v = ToHSV(color.RGBA{255, 0, 255, 255})
+	assert.Equal(t, []float64{300, 1, 1}, []float64{h, s, v})
+	h, s, v = ToHSV(color.Gray{51})
+	assert.Equal(t, []float64{0, 0, 0.2}, []float64{h, s, v})
+}
+
+func TestYCbCrOfWhite(t *testing.T) {
+	y, cb, cr := ToYCbCr(color.White)
+	assert.InDelta(t, 255.0, y, 0.01)
+	assert.InDelta(t, 128.0, cb, 0.01)
+	assert.InDelta(t, 128.0, cr, 0.01)
+}
+
+func TestNormalizedRGBDoesNotDependOnLighting(t *testing.T) {
+	r1, g1, b1 := ToNormalizedRGB(color.RGBA{200, 100, 50, 255})
+	r2, g2, b2 := ToNormalizedRGB(color.RGBA{100, 50, 25, 255})
+	assert.InDelta(t, r1, r2, 1e-9)
+	assert.InDelta(t, g1, g2, 1e-9)
+	assert.InDelta(t, b1, b2, 1e-9)
+	assert.InDelta(t, 1.0, r1+g1+b1, 1e-9)
+}
+
+func TestHSVDistanceWrapsAroundHue(t *testing.T) {
+	d := Distance([3]float64{359, 1, 1}, [3]float64{1, 1, 1}, HSV)
+	assert.InDelta(t, 255*2*0.01745, d, 0.1)
+}
+
+func TestRGBDistance(t *testing.T) {
+	assert.Equal(t, 5.0, Distance([3]float64{0, 3, 0}, [3]float64{4, 0, 0}, RGB))
+}
+
+func TestCIEDE2000(t *testing.T) {
+	/* Test data from Sharma et al. */
+	pairs := []struct {
+		lab1, lab2 [3]float64
+		expected   float64
+	}{
+		{[3]float64{50, 2.6772, -79.7751}, [3]float64{50, 0, -82.7485}, 2.0425},
+		{[3]float64{50, 0, 0}, [3]float64{50, -1, 2}, 2.3669},
+		{[3]float64{50, 2.49, -0.001}, [3]float64{50, -2.49, 0.0009}, 7.1792},
+		{[3]float64{50, 2.5, 0}, [3]float64{73, 25, -18}, 27.1492},
+		{[3]float64{60.2574, -34.0099, 36.2677}, [3]float64{60.4626, -34.1751, 39.4387}, 1.2644},
+		{[3]float64{2.0776, 0.0795, -1.135}, [3]float64{0.9033, -0.0636, -0.5514}, 0.9082},
+	}
+	for _, pair := range pairs {
+		assert.InDelta(t, pair.expected, CIEDE2000(pair.lab1, pair.lab2), 0.0001)
+		assert.InDelta(t, pair.expected, CIEDE2000(pair.lab2, pair.lab1), 0.0001)
+	}
+}
+
+func TestConvertImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(2, 3, 4, 5))
+	img.Set(3, 4, red)
+	converted := ConvertImage(img, HSV)
+	assert.Equal(t, img.Bounds(), converted.Bounds())
+	assert.Equal(t, [3]float64{0, 1, 1}, converted.ValuesAt(3, 4))
+
+	clr := converted.At(3, 4).(Color)
+	assert.Equal(t, HSV, clr.Space)
+	assert.Equal(t, [3]float64{0, 1, 1}, clr.Values)
+	r, g, b, a := clr.RGBA()
+	assert.Equal(t, []uint32{0xffff, 0, 0, 0xffff}, []uint32{r, g, b, a})
+}
@@ -0,0 +1,79 @@
+package evaluation
+
+import (
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/miguelfrde/image-segmentation/segmentation"
+)
+
+/**
+ * Returns the boundary map of the segmentation labels: a pixel is a boundary
+ * pixel if its right or bottom neighbor belongs to another segment. UNLABELED
+ * pixels are never boundaries.
+ */
+func Boundaries(labels *segmentation.Labels) []bool {
+	return labels.Boundaries()
+}
+
+/**
+ * Returns the number of boundary pixels of a and how many of them are at
+ * most as far from a boundary pixel of b as the offsets of the disk reach
+ */
+func matchBoundaries(a, b []bool, width, height int, disk []graph.Offset) (matched, total int) {
+	for p, boundary := range a {
+		if !boundary {
+			continue
+		}
+		total++
+		x, y := p%width, p/width
+		for _, o := range disk {
+			nx, ny := x+o.DX, y+o.DY
+			if nx >= 0 && nx < width && ny >= 0 && ny < height && b[nx+ny*width] {
+				matched++
+				break
+			}
+		}
+	}
+	return matched, total
+}
+
+/**
+ * Returns the boundary precision, recall and F-measure of the segmentation
+ * seg against the ground truths. A boundary pixel matches if there is a
+ * boundary pixel of the other segmentation at most tolerance pixels away,
+ * without requiring the matching to be one to one. A boundary pixel of seg
+ * is correct if it matches the boundaries of any ground truth and recall is
+ * computed over the boundary pixels of all the ground truths. It panics if
+ * there are no ground truths or their size isn't the one of seg.
+ */
+func BoundaryScores(seg *segmentation.Labels, groundTruths []*segmentation.Labels,
+	tolerance float64) (precision, recall, f float64) {
+	mustCheck(seg, groundTruths)
+	width, height := seg.Width, seg.Height
+	disk := graph.Disk(tolerance)
+	segBoundaries := Boundaries(seg)
+
+	anyBoundaries := make([]bool, len(segBoundaries), len(segBoundaries))
+	matchedGT, totalGT := 0, 0
+	for _, gt := range groundTruths {
+		gtBoundaries := Boundaries(gt)
+		for p, boundary := range gtBoundaries {
+			anyBoundaries[p] = anyBoundaries[p] || boundary
+		}
+		matched, total := matchBoundaries(gtBoundaries, segBoundaries, width, height, disk)
+		matchedGT += matched
+		totalGT += total
+	}
+	matchedSeg, totalSeg := matchBoundaries(segBoundaries, anyBoundaries, width, height, disk)
+
+	precision, recall = 1, 1
+	if totalSeg > 0 {
+		precision = float64(matchedSeg) / float64(totalSeg)
+	}
+	if totalGT > 0 {
+		recall = float64(matchedGT) / float64(totalGT)
+	}
+	if precision+recall > 0 {
+		f = 2 * precision * recall / (precision + recall)
+	}
+	return precision, recall, f
+}
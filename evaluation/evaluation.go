@@ -0,0 +1,96 @@
+/**
+ * Package evaluation scores a segmentation against one or more human
+ * segmentations of the same image (ground truths) with the standard metrics
+ * of the Berkeley Segmentation Dataset benchmark: Probabilistic Rand Index,
+ * Variation of Information, Global Consistency Error, segmentation covering
+ * and boundary precision, recall and F-measure.
+ */
+package evaluation
+
+import (
+	"errors"
+	"github.com/miguelfrde/image-segmentation/segmentation"
+	"math"
+)
+
+/**
+ * Fraction of the diagonal of the image used as the default distance
+ * tolerance of the boundary matching, the same as the BSDS benchmark
+ */
+const BOUNDARY_TOLERANCE = 0.0075
+
+var ErrNoGroundTruth = errors.New("evaluation: no ground truth segmentations")
+var ErrSizeMismatch = errors.New("evaluation: the segmentations have different sizes")
+
+/**
+ * Scores of a segmentation against a set of ground truths. PRI and Covering
+ * go from 0 to 1 and greater is better, VOI (in nats) and GCE (from 0 to 1)
+ * are better the smaller they are. Precision, Recall and F measure how well
+ * the boundaries of the segmentation match the ones of the ground truths.
+ */
+type Scores struct {
+	PRI       float64 `json:"pri"`
+	VOI       float64 `json:"voi"`
+	GCE       float64 `json:"gce"`
+	Covering  float64 `json:"covering"`
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F         float64 `json:"f"`
+}
+
+/**
+ * Computes all the scores of the segmentation seg against the ground truths.
+ * Boundary pixels match if they are at most tolerance pixels apart, a
+ * negative tolerance uses DefaultTolerance. Returns an error if there are no
+ * ground truths or if they don't have the size of seg.
+ */
+func Evaluate(seg *segmentation.Labels, groundTruths []*segmentation.Labels,
+	tolerance float64) (Scores, error) {
+	if err := check(seg, groundTruths); err != nil {
+		return Scores{}, err
+	}
+	if tolerance < 0 {
+		tolerance = DefaultTolerance(seg.Width, seg.Height)
+	}
+	var scores Scores
+	scores.PRI = ProbabilisticRandIndex(seg, groundTruths)
+	scores.VOI = VariationOfInformation(seg, groundTruths)
+	scores.GCE = GlobalConsistencyError(seg, groundTruths)
+	scores.Covering = Covering(seg, groundTruths)
+	scores.Precision, scores.Recall, scores.F = BoundaryScores(seg, groundTruths, tolerance)
+	return scores, nil
+}
+
+/**
+ * Returns the distance tolerance used by the BSDS benchmark for an image of
+ * size width x height
+ */
+func DefaultTolerance(width, height int) float64 {
+	return BOUNDARY_TOLERANCE * math.Hypot(float64(width), float64(height))
+}
+
+/**
+ * Returns an error if there are no ground truths or if some of them doesn't
+ * have the size of seg
+ */
+func check(seg *segmentation.Labels, groundTruths []*segmentation.Labels) error {
+	if len(groundTruths) == 0 {
+		return ErrNoGroundTruth
+	}
+	for _, gt := range groundTruths {
+		if gt.Width != seg.Width || gt.Height != seg.Height {
+			return ErrSizeMismatch
+		}
+	}
+	return nil
+}
+
+/**
+ * Panics with the error of check. Used by the metrics, which are only
+ * defined for a non empty set of ground truths of the size of seg.
+ */
+func mustCheck(seg *segmentation.Labels, groundTruths []*segmentation.Labels) {
+	if err := check(seg, groundTruths); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,114 @@
+package evaluation
+
+import (
+	"github.com/miguelfrde/image-segmentation/segmentation"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+/* Label map of a single row with the given ids */
+func row(ids ...int) *segmentation.Labels {
+	labels := segmentation.NewLabels(len(ids), 1)
+	copy(labels.Ids, ids)
+	labels.Count = 0
+	for _, id := range ids {
+		if id+1 > labels.Count {
+			labels.Count = id + 1
+		}
+	}
+	return labels
+}
+
+/*
+ * Tests
+ */
+
+func TestEvaluateIdentical(t *testing.T) {
+	seg := row(0, 0, 1, 1, 2)
+	scores, err := Evaluate(seg, []*segmentation.Labels{row(0, 0, 1, 1, 2)}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, Scores{PRI: 1, VOI: 0, GCE: 0, Covering: 1, Precision: 1, Recall: 1, F: 1}, scores)
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	_, err := Evaluate(row(0, 0), nil, 0)
+	assert.Equal(t, ErrNoGroundTruth, err)
+	_, err = Evaluate(row(0, 0), []*segmentation.Labels{row(0, 0, 0)}, 0)
+	assert.Equal(t, ErrSizeMismatch, err)
+	assert.Panics(t, func() { ProbabilisticRandIndex(row(0, 0), []*segmentation.Labels{row(0)}) })
+}
+
+func TestUnderSegmentation(t *testing.T) {
+	seg := row(0, 0, 0, 0)
+	gts := []*segmentation.Labels{row(0, 0, 1, 1)}
+	assert.InDelta(t, 1.0/3, ProbabilisticRandIndex(seg, gts), 1e-9)
+	assert.InDelta(t, math.Log(2), VariationOfInformation(seg, gts), 1e-9)
+	assert.InDelta(t, 0, GlobalConsistencyError(seg, gts), 1e-9)
+	assert.InDelta(t, 0.5, Covering(seg, gts), 1e-9)
+	precision, recall, f := BoundaryScores(seg, gts, 1)
+	assert.Equal(t, 1.0, precision)
+	assert.Equal(t, 0.0, recall)
+	assert.Equal(t, 0.0, f)
+}
+
+func TestOverSegmentation(t *testing.T) {
+	seg := row(0, 1, 2, 3)
+	gts := []*segmentation.Labels{row(0, 0, 1, 1)}
+	assert.InDelta(t, 0, GlobalConsistencyError(seg, gts), 1e-9)
+	assert.InDelta(t, math.Log(2), VariationOfInformation(seg, gts), 1e-9)
+	assert.InDelta(t, 0.5, Covering(seg, gts), 1e-9)
+	precision, recall, _ := BoundaryScores(seg, gts, 0)
+	assert.InDelta(t, 1.0/3, precision, 1e-9)
+	assert.Equal(t, 1.0, recall)
+}
+
+func TestGlobalConsistencyError(t *testing.T) {
+	/* Neither is a refinement of the other */
+	seg := row(0, 0, 1, 1)
+	gts := []*segmentation.Labels{row(0, 1, 1, 2)}
+	/* Every pixel of seg loses half of its region: 4 * 1/2, gt: 1/2 + 1/2 */
+	assert.InDelta(t, 1.0/4, GlobalConsistencyError(seg, gts), 1e-9)
+}
+
+func TestMultipleGroundTruths(t *testing.T) {
+	seg := row(0, 0, 0, 0)
+	gts := []*segmentation.Labels{row(0, 0, 0, 0), row(0, 0, 1, 1)}
+	assert.InDelta(t, 2.0/3, ProbabilisticRandIndex(seg, gts), 1e-9)
+	assert.InDelta(t, 0.75, Covering(seg, gts), 1e-9)
+}
+
+func TestBoundaryTolerance(t *testing.T) {
+	seg := row(0, 0, 0, 1)
+	gts := []*segmentation.Labels{row(0, 0, 1, 1)}
+	precision, recall, f := BoundaryScores(seg, gts, 0)
+	assert.Equal(t, []float64{0, 0, 0}, []float64{precision, recall, f})
+	precision, recall, f = BoundaryScores(seg, gts, 1)
+	assert.Equal(t, []float64{1, 1, 1}, []float64{precision, recall, f})
+}
+
+func TestBoundaries(t *testing.T) {
+	labels := segmentation.NewLabels(3, 2)
+	copy(labels.Ids, []int{0, 0, 1, 0, 0, 0})
+	labels.Count = 2
+	assert.Equal(t, []bool{false, true, true, false, false, false}, Boundaries(labels))
+}
+
+func TestUnlabeledPixels(t *testing.T) {
+	seg := row(0, 0, 1, 1)
+	gt := row(0, 0, 1, 1)
+	gt.Ids[1] = segmentation.UNLABELED
+	scores, err := Evaluate(seg, []*segmentation.Labels{gt}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.0, scores.PRI)
+	assert.Equal(t, 0.0, scores.VOI)
+	assert.Equal(t, 1.0, scores.Covering)
+}
+
+func TestDefaultTolerance(t *testing.T) {
+	assert.InDelta(t, 3.75, DefaultTolerance(300, 400), 1e-9)
+}
@@ -0,0 +1,124 @@
+package evaluation
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/miguelfrde/image-segmentation/segmentation"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Reads a human segmentation in the .seg format of the Berkeley Segmentation
+ * Dataset: a header with the width and height of the image followed, after a
+ * "data" line, by lines "segment row firstColumn lastColumn". Pixels that no
+ * line covers are UNLABELED.
+ */
+func ReadSeg(r io.Reader) (*segmentation.Labels, error) {
+	scanner := bufio.NewScanner(r)
+	width, height := -1, -1
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "data" {
+			break
+		}
+		if len(fields) < 2 || (fields[0] != "width" && fields[0] != "height") {
+			continue
+		}
+		value, err := strconv.Atoi(fields[1])
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("seg: invalid %s %q", fields[0], fields[1])
+		}
+		if fields[0] == "width" {
+			width = value
+		} else {
+			height = value
+		}
+	}
+	if width < 0 || height < 0 {
+		return nil, fmt.Errorf("seg: missing width or height")
+	}
+
+	labels := segmentation.NewLabels(width, height)
+	for p := range labels.Ids {
+		labels.Ids[p] = segmentation.UNLABELED
+	}
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("seg: data line %d: expected 4 values", line)
+		}
+		var values [4]int
+		for i, field := range fields {
+			value, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("seg: data line %d: %v", line, err)
+			}
+			values[i] = value
+		}
+		segment, row, first, last := values[0], values[1], values[2], values[3]
+		if segment < 0 || row < 0 || row >= height || first < 0 || first > last || last >= width {
+			return nil, fmt.Errorf("seg: data line %d: out of bounds", line)
+		}
+		for x := first; x <= last; x++ {
+			labels.Ids[x+row*width] = segment
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	compactLabels(labels)
+	return labels, nil
+}
+
+/**
+ * Returns the label map of an image where every segment is painted with a
+ * different color or gray level, like the PNG ground truths of many datasets
+ */
+func LabelsFromImage(img image.Image) *segmentation.Labels {
+	bounds := img.Bounds()
+	labels := segmentation.NewLabels(bounds.Dx(), bounds.Dy())
+	ids := make(map[color.RGBA64]int)
+	for y := 0; y < labels.Height; y++ {
+		for x := 0; x < labels.Width; x++ {
+			c := color.RGBA64Model.Convert(img.At(x+bounds.Min.X, y+bounds.Min.Y)).(color.RGBA64)
+			id, ok := ids[c]
+			if !ok {
+				id = len(ids)
+				ids[c] = id
+			}
+			labels.Ids[x+y*labels.Width] = id
+		}
+	}
+	labels.Count = len(ids)
+	return labels
+}
+
+/**
+ * Renumbers the segments of labels in order of first appearance, leaving
+ * the UNLABELED pixels as they are, and updates its count
+ */
+func compactLabels(labels *segmentation.Labels) {
+	compact := make(map[int]int)
+	for p, id := range labels.Ids {
+		if id < 0 {
+			continue
+		}
+		newId, ok := compact[id]
+		if !ok {
+			newId = len(compact)
+			compact[id] = newId
+		}
+		labels.Ids[p] = newId
+	}
+	labels.Count = len(compact)
+}
@@ -0,0 +1,60 @@
+package evaluation
+
+import (
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+const testSeg = `format ascii cr
+date Thu Feb 14 11:04:51 2002
+image 12003
+user 1130
+width 4
+height 2
+segments 2
+gray 0
+invert 0
+flipflop 0
+data
+5 0 0 1
+2 0 2 3
+5 1 0 3
+`
+
+func TestReadSeg(t *testing.T) {
+	labels, err := ReadSeg(strings.NewReader(testSeg))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, labels.Width)
+	assert.Equal(t, 2, labels.Height)
+	assert.Equal(t, 2, labels.Count)
+	assert.Equal(t, []int{0, 0, 1, 1, 0, 0, 0, 0}, labels.Ids)
+}
+
+func TestReadSegUncovered(t *testing.T) {
+	labels, err := ReadSeg(strings.NewReader("width 2\nheight 1\ndata\n0 0 1 1\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{-1, 0}, labels.Ids)
+	assert.Equal(t, 1, labels.Count)
+}
+
+func TestReadSegErrors(t *testing.T) {
+	_, err := ReadSeg(strings.NewReader("data\n0 0 0 0\n"))
+	assert.NotNil(t, err)
+	_, err = ReadSeg(strings.NewReader("width 2\nheight 1\ndata\n0 0 0 2\n"))
+	assert.NotNil(t, err)
+	_, err = ReadSeg(strings.NewReader("width 2\nheight 1\ndata\n0 0 x 1\n"))
+	assert.NotNil(t, err)
+}
+
+func TestLabelsFromImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	img.Set(1, 0, color.RGBA{255, 0, 0, 255})
+	img.Set(2, 0, color.RGBA{0, 0, 255, 255})
+	labels := LabelsFromImage(img)
+	assert.Equal(t, 3, labels.Count)
+	assert.Equal(t, []int{0, 0, 1, 2, 2, 2}, labels.Ids)
+}
@@ -0,0 +1,170 @@
+package evaluation
+
+import (
+	"github.com/miguelfrde/image-segmentation/segmentation"
+	"math"
+)
+
+/**
+ * Contingency table of two segmentations a and b: the number of pixels that
+ * belong to every pair of segments, one of each, and to every segment.
+ * Pixels that are UNLABELED in either of them are ignored.
+ */
+type contingency struct {
+	joint  map[[2]int]int
+	sizesA []int
+	sizesB []int
+	total  int
+}
+
+func newContingency(a, b *segmentation.Labels) *contingency {
+	c := &contingency{joint: make(map[[2]int]int)}
+	c.sizesA = make([]int, a.Count, a.Count)
+	c.sizesB = make([]int, b.Count, b.Count)
+	for p, i := range a.Ids {
+		j := b.Ids[p]
+		if i < 0 || j < 0 {
+			continue
+		}
+		c.joint[[2]int{i, j}]++
+		c.sizesA[i]++
+		c.sizesB[j]++
+		c.total++
+	}
+	return c
+}
+
+/**
+ * Returns the number of unordered pairs of n elements
+ */
+func pairs(n int) float64 {
+	return float64(n) * float64(n-1) / 2
+}
+
+/**
+ * Returns the fraction of pairs of pixels on whose grouping a and b agree:
+ * both place them in the same segment or both in different ones
+ */
+func (c *contingency) randIndex() float64 {
+	if c.total < 2 {
+		return 1
+	}
+	sameA, sameB, sameBoth := 0.0, 0.0, 0.0
+	for _, n := range c.sizesA {
+		sameA += pairs(n)
+	}
+	for _, n := range c.sizesB {
+		sameB += pairs(n)
+	}
+	for _, n := range c.joint {
+		sameBoth += pairs(n)
+	}
+	return 1 - (sameA+sameB-2*sameBoth)/pairs(c.total)
+}
+
+/**
+ * Returns H(a) + H(b) - 2I(a, b) in nats
+ */
+func (c *contingency) variationOfInformation() float64 {
+	if c.total == 0 {
+		return 0
+	}
+	n := float64(c.total)
+	voi := 0.0
+	for pair, nij := range c.joint {
+		pij := float64(nij) / n
+		pi := float64(c.sizesA[pair[0]]) / n
+		pj := float64(c.sizesB[pair[1]]) / n
+		voi -= pij * (math.Log(pij/pi) + math.Log(pij/pj))
+	}
+	return voi
+}
+
+/**
+ * Returns the global consistency error: the local refinement error of a
+ * with respect to b or of b with respect to a, whichever is smaller,
+ * averaged over all the pixels
+ */
+func (c *contingency) globalConsistencyError() float64 {
+	if c.total == 0 {
+		return 0
+	}
+	errA, errB := 0.0, 0.0
+	for pair, nij := range c.joint {
+		sizeA, sizeB := float64(c.sizesA[pair[0]]), float64(c.sizesB[pair[1]])
+		errA += float64(nij) * (sizeA - float64(nij)) / sizeA
+		errB += float64(nij) * (sizeB - float64(nij)) / sizeB
+	}
+	return math.Min(errA, errB) / float64(c.total)
+}
+
+/**
+ * Returns how well the segments of a cover the ones of b: the intersection
+ * over union of every segment of b with its best overlapping segment of a,
+ * weighted by the size of the segment of b
+ */
+func (c *contingency) covering() float64 {
+	if c.total == 0 {
+		return 0
+	}
+	best := make([]float64, len(c.sizesB), len(c.sizesB))
+	for pair, nij := range c.joint {
+		union := c.sizesA[pair[0]] + c.sizesB[pair[1]] - nij
+		best[pair[1]] = math.Max(best[pair[1]], float64(nij)/float64(union))
+	}
+	covering := 0.0
+	for j, overlap := range best {
+		covering += float64(c.sizesB[j]) * overlap
+	}
+	return covering / float64(c.total)
+}
+
+/**
+ * Returns the mean of the given metric of the contingency tables of seg with
+ * every ground truth
+ */
+func mean(seg *segmentation.Labels, groundTruths []*segmentation.Labels,
+	metric func(*contingency) float64) float64 {
+	mustCheck(seg, groundTruths)
+	sum := 0.0
+	for _, gt := range groundTruths {
+		sum += metric(newContingency(seg, gt))
+	}
+	return sum / float64(len(groundTruths))
+}
+
+/**
+ * Returns the Probabilistic Rand Index of the segmentation seg: the fraction
+ * of pairs of pixels on whose grouping seg agrees with the ground truths,
+ * weighted by how many of the ground truths agree on it. It panics if there
+ * are no ground truths or their size isn't the one of seg.
+ */
+func ProbabilisticRandIndex(seg *segmentation.Labels, groundTruths []*segmentation.Labels) float64 {
+	return mean(seg, groundTruths, (*contingency).randIndex)
+}
+
+/**
+ * Returns the mean Variation of Information, in nats, between the
+ * segmentation seg and every ground truth. It panics if there are no ground
+ * truths or their size isn't the one of seg.
+ */
+func VariationOfInformation(seg *segmentation.Labels, groundTruths []*segmentation.Labels) float64 {
+	return mean(seg, groundTruths, (*contingency).variationOfInformation)
+}
+
+/**
+ * Returns the mean Global Consistency Error between the segmentation seg
+ * and every ground truth. It panics if there are no ground truths or their
+ * size isn't the one of seg.
+ */
+func GlobalConsistencyError(seg *segmentation.Labels, groundTruths []*segmentation.Labels) float64 {
+	return mean(seg, groundTruths, (*contingency).globalConsistencyError)
+}
+
+/**
+ * Returns the mean covering of every ground truth by the segmentation seg.
+ * It panics if there are no ground truths or their size isn't the one of seg.
+ */
+func Covering(seg *segmentation.Labels, groundTruths []*segmentation.Labels) float64 {
+	return mean(seg, groundTruths, (*contingency).covering)
+}
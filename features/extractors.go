@@ -0,0 +1,176 @@
+package features
+
+import (
+	"math"
+	"sync"
+)
+
+/**
+ * Gradient magnitude of the Sobel operator. One channel.
+ */
+func Sobel() Extractor {
+	return func(gray *Gray) [][]float64 {
+		magnitudes := make([]float64, len(gray.Pix), len(gray.Pix))
+		for y := 0; y < gray.Height; y++ {
+			for x := 0; x < gray.Width; x++ {
+				gx := gray.At(x+1, y-1) + 2*gray.At(x+1, y) + gray.At(x+1, y+1) -
+					gray.At(x-1, y-1) - 2*gray.At(x-1, y) - gray.At(x-1, y+1)
+				gy := gray.At(x-1, y+1) + 2*gray.At(x, y+1) + gray.At(x+1, y+1) -
+					gray.At(x-1, y-1) - 2*gray.At(x, y-1) - gray.At(x+1, y-1)
+				magnitudes[x+y*gray.Width] = math.Hypot(gx, gy)
+			}
+		}
+		return [][]float64{magnitudes}
+	}
+}
+
+/**
+ * Standard deviation of the intensities in the (2 * radius + 1)^2 window
+ * around every pixel, that is, the square root of the local variance, so
+ * that it grows linearly with the contrast. One channel.
+ */
+func LocalVariance(radius int) Extractor {
+	return func(gray *Gray) [][]float64 {
+		squares := make([]float64, len(gray.Pix), len(gray.Pix))
+		for p, v := range gray.Pix {
+			squares[p] = v * v
+		}
+		means := boxMean(gray.Pix, gray.Width, gray.Height, radius)
+		squareMeans := boxMean(squares, gray.Width, gray.Height, radius)
+		stdevs := make([]float64, len(gray.Pix), len(gray.Pix))
+		for p := range stdevs {
+			stdevs[p] = math.Sqrt(math.Max(squareMeans[p]-means[p]*means[p], 0))
+		}
+		return [][]float64{stdevs}
+	}
+}
+
+/**
+ * Number of different rotation invariant uniform LBP codes for 8 neighbors
+ */
+const LBP_BINS = 10
+
+/**
+ * Histogram of the rotation invariant uniform local binary patterns of the
+ * 8 neighbors of every pixel in the (2 * radius + 1)^2 window around it.
+ * Patterns with at most two 0/1 transitions are coded by their number of
+ * ones (0 to 8) and the rest share the last bin. LBP_BINS channels, each one
+ * is the fraction of the window with that code.
+ * Based on: "Multiresolution Gray-Scale and Rotation Invariant Texture
+ * Classification with Local Binary Patterns" by Ojala et al.
+ */
+func LBP(radius int) Extractor {
+	dx := []int{1, 1, 0, -1, -1, -1, 0, 1}
+	dy := []int{0, 1, 1, 1, 0, -1, -1, -1}
+	return func(gray *Gray) [][]float64 {
+		bins := make([][]float64, LBP_BINS, LBP_BINS)
+		for b := range bins {
+			bins[b] = make([]float64, len(gray.Pix), len(gray.Pix))
+		}
+		for y := 0; y < gray.Height; y++ {
+			for x := 0; x < gray.Width; x++ {
+				center := gray.At(x, y)
+				ones, transitions := 0, 0
+				for i := range dx {
+					j := (i + 1) % len(dx)
+					bit := gray.At(x+dx[i], y+dy[i]) >= center
+					next := gray.At(x+dx[j], y+dy[j]) >= center
+					if bit {
+						ones++
+					}
+					if bit != next {
+						transitions++
+					}
+				}
+				code := LBP_BINS - 1
+				if transitions <= 2 {
+					code = ones
+				}
+				bins[code][x+y*gray.Width] = 1
+			}
+		}
+		for b := range bins {
+			bins[b] = boxMean(bins[b], gray.Width, gray.Height, radius)
+		}
+		return bins
+	}
+}
+
+/**
+ * Local energy of a bank of Gabor filters with the given wavelengths (in
+ * pixels) and number of orientations evenly spaced between 0 and pi. The
+ * magnitude of the complex response of every filter is averaged in a window
+ * as big as its wavelength. len(wavelengths) * orientations channels.
+ */
+func Gabor(wavelengths []float64, orientations int) Extractor {
+	return func(gray *Gray) [][]float64 {
+		channels := make([][]float64, len(wavelengths)*orientations,
+			len(wavelengths)*orientations)
+		var wg sync.WaitGroup
+		for i, wavelength := range wavelengths {
+			for o := 0; o < orientations; o++ {
+				wg.Add(1)
+				go func(c int, wavelength, theta float64) {
+					defer wg.Done()
+					magnitudes := gaborMagnitude(gray, wavelength, theta)
+					channels[c] = boxMean(magnitudes, gray.Width, gray.Height,
+						int(math.Ceil(wavelength/2)))
+				}(i*orientations+o, wavelength, math.Pi*float64(o)/float64(orientations))
+			}
+		}
+		wg.Wait()
+		return channels
+	}
+}
+
+/**
+ * Returns the magnitude of the response of every pixel to the Gabor filter
+ * with the given wavelength and orientation. The bandwidth is one octave and
+ * the aspect ratio 0.5. The real part of the kernel has zero mean so that
+ * flat regions don't respond.
+ */
+func gaborMagnitude(gray *Gray, wavelength, theta float64) []float64 {
+	sigma := 0.56 * wavelength
+	half := int(math.Ceil(2.5 * sigma))
+	size := 2*half + 1
+	real := make([]float64, size*size, size*size)
+	imag := make([]float64, size*size, size*size)
+	mean, envelopes := 0.0, 0.0
+	for ky := -half; ky <= half; ky++ {
+		for kx := -half; kx <= half; kx++ {
+			xr := float64(kx)*math.Cos(theta) + float64(ky)*math.Sin(theta)
+			yr := -float64(kx)*math.Sin(theta) + float64(ky)*math.Cos(theta)
+			envelope := math.Exp(-(xr*xr + 0.25*yr*yr) / (2 * sigma * sigma))
+			k := (kx + half) + (ky+half)*size
+			real[k] = envelope * math.Cos(2*math.Pi*xr/wavelength)
+			imag[k] = envelope * math.Sin(2*math.Pi*xr/wavelength)
+			mean += real[k]
+			envelopes += envelope
+		}
+	}
+	for ky := -half; ky <= half; ky++ {
+		for kx := -half; kx <= half; kx++ {
+			xr := float64(kx)*math.Cos(theta) + float64(ky)*math.Sin(theta)
+			yr := -float64(kx)*math.Sin(theta) + float64(ky)*math.Cos(theta)
+			envelope := math.Exp(-(xr*xr + 0.25*yr*yr) / (2 * sigma * sigma))
+			real[(kx+half)+(ky+half)*size] -= mean * envelope / envelopes
+		}
+	}
+
+	magnitudes := make([]float64, len(gray.Pix), len(gray.Pix))
+	for y := 0; y < gray.Height; y++ {
+		for x := 0; x < gray.Width; x++ {
+			re, im := 0.0, 0.0
+			for ky := -half; ky <= half; ky++ {
+				for kx := -half; kx <= half; kx++ {
+					v := gray.At(x+kx, y+ky)
+					k := (kx + half) + (ky+half)*size
+					re += v * real[k]
+					im += v * imag[k]
+				}
+			}
+			magnitudes[x+y*gray.Width] = math.Hypot(re, im)
+		}
+	}
+	return magnitudes
+}
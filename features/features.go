@@ -0,0 +1,204 @@
+/**
+ * Package features computes per pixel feature vectors that describe the
+ * texture and the gradient around every pixel: Sobel gradient magnitude,
+ * local variance, local binary pattern histograms and Gabor filter energies.
+ * Feature maps are computed once and attached to an image so that weight
+ * functions can compare the feature vectors of the two pixels of an edge.
+ */
+package features
+
+import (
+	"fmt"
+	"github.com/miguelfrde/image-segmentation/utils"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+/**
+ * Intensities of an image between 0 and 255 stored row by row
+ */
+type Gray struct {
+	Width, Height int
+	Pix           []float64
+}
+
+/**
+ * Returns the intensities of the image img
+ */
+func GrayFromImage(img image.Image) *Gray {
+	bounds := img.Bounds()
+	gray := &Gray{Width: bounds.Dx(), Height: bounds.Dy(),
+		Pix: make([]float64, bounds.Dx()*bounds.Dy(), bounds.Dx()*bounds.Dy())}
+	for y := 0; y < gray.Height; y++ {
+		for x := 0; x < gray.Width; x++ {
+			gray.Pix[x+y*gray.Width] = utils.Intensity(img.At(x+bounds.Min.X, y+bounds.Min.Y))
+		}
+	}
+	return gray
+}
+
+/**
+ * Returns the intensity of the pixel (x, y). Coordinates outside the image
+ * are clamped to its border.
+ */
+func (gray *Gray) At(x, y int) float64 {
+	x = utils.MaxI(0, utils.MinI(x, gray.Width-1))
+	y = utils.MaxI(0, utils.MinI(y, gray.Height-1))
+	return gray.Pix[x+y*gray.Width]
+}
+
+/**
+ * Computes one or more feature channels from the intensities of an image.
+ * Every channel has one value per pixel stored row by row.
+ */
+type Extractor func(gray *Gray) [][]float64
+
+/**
+ * Returns the extractor with the given name using its default parameters:
+ * sobel, variance (radius 2), lbp (radius 3) or gabor (wavelengths 4 and 8,
+ * 4 orientations).
+ */
+func Parse(name string) (Extractor, error) {
+	switch strings.ToLower(name) {
+	case "sobel":
+		return Sobel(), nil
+	case "variance":
+		return LocalVariance(2), nil
+	case "lbp":
+		return LBP(3), nil
+	case "gabor":
+		return Gabor([]float64{4, 8}, 4), nil
+	}
+	return nil, fmt.Errorf("unknown feature %q", name)
+}
+
+/**
+ * Feature vectors of all the pixels of an image. Values stores the Dims
+ * values of every pixel one after the other, row by row.
+ */
+type Map struct {
+	Width, Height, Dims int
+	Values              []float64
+}
+
+/**
+ * Computes the feature map of the image img with the given extractors.
+ * Every channel is divided by its maximum and then the channels of each
+ * extractor are scaled so that every extractor has the same influence on
+ * the distances, no matter how many channels it has. Distances between
+ * the resulting vectors are between 0 and about 1.
+ */
+func Compute(img image.Image, extractors ...Extractor) *Map {
+	gray := GrayFromImage(img)
+	groups := make([][][]float64, len(extractors), len(extractors))
+	dims := 0
+	for i, extract := range extractors {
+		groups[i] = extract(gray)
+		dims += len(groups[i])
+	}
+
+	total := gray.Width * gray.Height
+	m := &Map{Width: gray.Width, Height: gray.Height, Dims: dims,
+		Values: make([]float64, total*dims, total*dims)}
+	d := 0
+	for _, channels := range groups {
+		scale := 1 / math.Sqrt(float64(len(channels)*len(groups)))
+		for _, channel := range channels {
+			max := 0.0
+			for _, v := range channel {
+				max = math.Max(max, math.Abs(v))
+			}
+			if max > 0 {
+				for p, v := range channel {
+					m.Values[p*dims+d] = v / max * scale
+				}
+			}
+			d++
+		}
+	}
+	return m
+}
+
+/**
+ * Returns the feature vector of the pixel (x, y)
+ */
+func (m *Map) Vector(x, y int) []float64 {
+	p := x + y*m.Width
+	return m.Values[p*m.Dims : (p+1)*m.Dims]
+}
+
+/**
+ * Returns an image with the same colors as img whose pixels also carry
+ * their feature vector. img must have the same size as the image from
+ * which the map was computed.
+ */
+func (m *Map) Attach(img image.Image) *Image {
+	return &Image{Image: img, features: m}
+}
+
+/**
+ * Image whose At returns a Color with the feature vector of the pixel
+ */
+type Image struct {
+	image.Image
+	features *Map
+}
+
+func (img *Image) At(x, y int) color.Color {
+	clr := img.Image.At(x, y)
+	bounds := img.Bounds()
+	if !(image.Point{x, y}.In(bounds)) {
+		return clr
+	}
+	return Color{Color: clr, Vector: img.features.Vector(x-bounds.Min.X, y-bounds.Min.Y)}
+}
+
+/**
+ * A color together with the feature vector of its pixel. It still behaves as
+ * the original color.Color.
+ */
+type Color struct {
+	color.Color
+	Vector []float64
+}
+
+/**
+ * Returns the Euclidean distance between two feature vectors of a Map
+ * multiplied by 255 so that it's in a range similar to RGB distances
+ */
+func Distance(v1, v2 []float64) float64 {
+	sum := 0.0
+	for i := range v1 {
+		d := v1[i] - v2[i]
+		sum += d * d
+	}
+	return 255 * math.Sqrt(sum)
+}
+
+/**
+ * Returns the mean of the values in the (2 * radius + 1)^2 window around every
+ * pixel. Uses an integral image so the cost doesn't depend on the radius.
+ */
+func boxMean(values []float64, width, height, radius int) []float64 {
+	integral := make([]float64, (width+1)*(height+1), (width+1)*(height+1))
+	for y := 0; y < height; y++ {
+		row := 0.0
+		for x := 0; x < width; x++ {
+			row += values[x+y*width]
+			integral[(x+1)+(y+1)*(width+1)] = integral[(x+1)+y*(width+1)] + row
+		}
+	}
+	means := make([]float64, width*height, width*height)
+	for y := 0; y < height; y++ {
+		minY, maxY := utils.MaxI(y-radius, 0), utils.MinI(y+radius+1, height)
+		for x := 0; x < width; x++ {
+			minX, maxX := utils.MaxI(x-radius, 0), utils.MinI(x+radius+1, width)
+			sum := integral[maxX+maxY*(width+1)] - integral[minX+maxY*(width+1)] -
+				integral[maxX+minY*(width+1)] + integral[minX+minY*(width+1)]
+			means[x+y*width] = sum / float64((maxX-minX)*(maxY-minY))
+		}
+	}
+	return means
+}
@@ -0,0 +1,118 @@
+package features
+
+import (
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+func flatGray(width, height int, value float64) *Gray {
+	gray := &Gray{Width: width, Height: height, Pix: make([]float64, width*height)}
+	for p := range gray.Pix {
+		gray.Pix[p] = value
+	}
+	return gray
+}
+
+/* Vertical stripes with the given period */
+func stripes(width, height, period int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if (x/(period/2))%2 == 0 {
+				img.SetGray(x, y, color.Gray{255})
+			}
+		}
+	}
+	return img
+}
+
+/*
+ * Tests
+ */
+
+func TestParseExtractorNames(t *testing.T) {
+	for _, name := range []string{"sobel", "variance", "lbp", "gabor"} {
+		extractor, err := Parse(name)
+		assert.Nil(t, err)
+		assert.NotNil(t, extractor)
+	}
+	_, err := Parse("sift")
+	assert.NotNil(t, err)
+}
+
+func TestBoxMean(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	means := boxMean(values, 3, 3, 1)
+	assert.Equal(t, 5.0, means[4])
+	assert.Equal(t, 3.0, means[0])
+	assert.Equal(t, 7.0, means[8])
+}
+
+func TestSobelOfFlatImageIsZero(t *testing.T) {
+	channels := Sobel()(flatGray(5, 5, 100))
+	assert.Equal(t, 1, len(channels))
+	for _, v := range channels[0] {
+		assert.Equal(t, 0.0, v)
+	}
+}
+
+func TestSobelRespondsToEdges(t *testing.T) {
+	gray := GrayFromImage(stripes(8, 4, 8))
+	magnitudes := Sobel()(gray)[0]
+	assert.True(t, magnitudes[3+gray.Width] > 0)
+	assert.InDelta(t, 0.0, magnitudes[1+gray.Width], 1e-9)
+}
+
+func TestLocalVariance(t *testing.T) {
+	assert.Equal(t, 0.0, LocalVariance(1)(flatGray(4, 4, 50))[0][5])
+	gray := GrayFromImage(stripes(8, 8, 2))
+	assert.InDelta(t, 127.5, LocalVariance(2)(gray)[0][3+3*8], 15)
+}
+
+func TestLBPOfFlatImage(t *testing.T) {
+	bins := LBP(1)(flatGray(4, 4, 50))
+	assert.Equal(t, LBP_BINS, len(bins))
+	/* All the neighbors are >= the center, so every pixel has eight ones */
+	assert.Equal(t, 1.0, bins[8][5])
+	assert.Equal(t, 0.0, bins[0][5])
+}
+
+func TestGaborPrefersTheOrientationOfTheStripes(t *testing.T) {
+	gray := GrayFromImage(stripes(32, 32, 4))
+	channels := Gabor([]float64{4}, 2)(gray)
+	assert.Equal(t, 2, len(channels))
+	center := 16 + 16*32
+	assert.True(t, channels[0][center] > 10*channels[1][center])
+	assert.InDelta(t, 0.0, Gabor([]float64{4}, 2)(flatGray(16, 16, 80))[0][8+8*16], 1e-6)
+}
+
+func TestComputeNormalizesEveryExtractor(t *testing.T) {
+	img := stripes(16, 16, 4)
+	m := Compute(img, Sobel(), LBP(1))
+	assert.Equal(t, 1+LBP_BINS, m.Dims)
+	assert.Equal(t, 16*16*m.Dims, len(m.Values))
+	for _, v := range m.Values {
+		assert.True(t, v >= 0 && v <= 1/math.Sqrt(2)+1e-9)
+	}
+}
+
+func TestAttachedImageCarriesFeatures(t *testing.T) {
+	img := stripes(8, 8, 4)
+	m := Compute(img, Sobel())
+	clr := m.Attach(img).At(1, 2).(Color)
+	assert.Equal(t, m.Vector(1, 2), clr.Vector)
+	r, _, _, _ := clr.RGBA()
+	assert.Equal(t, uint32(0xffff), r)
+}
+
+func TestDistance(t *testing.T) {
+	assert.Equal(t, 0.0, Distance([]float64{0.1, 0.2}, []float64{0.1, 0.2}))
+	assert.InDelta(t, 255.0, Distance([]float64{0, 0}, []float64{0.6, 0.8}), 1e-9)
+}
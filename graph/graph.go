@@ -1,10 +1,12 @@
 /**
- * Package graph implements a Graph that can be either a King's graph
- * or a Grid graph. It can generate a graph from a given image.
+ * Package graph implements a Graph that can be either a King's graph,
+ * a Grid graph, a graph of any other registered neighborhood or a nearest
+ * neighbors graph. It can generate a graph from a given image.
  */
 package graph
 
 import (
+	"context"
 	"github.com/miguelfrde/image-segmentation/utils"
 	"image"
 	"image/color"
@@ -56,6 +58,21 @@ func (e *Edge) Weight() float64 {
 	return e.weight
 }
 
+/**
+ * Returns true if Edge e is lighter than Edge other. Edges with the same
+ * weight are ordered by their vertices, so that sorting an edge list always
+ * gives the same order whatever the initial one is.
+ */
+func (e *Edge) Less(other *Edge) bool {
+	if e.weight != other.weight {
+		return e.weight < other.weight
+	}
+	if e.u != other.u {
+		return e.u < other.u
+	}
+	return e.v < other.v
+}
+
 /**
  * Used to store all the edges that the graph contains.
  * It can be used with sort.Sort
@@ -70,11 +87,10 @@ func (edges EdgeList) Len() int {
 }
 
 /**
- * Returns true if the weight of the edge i is less than the weight
- * of the edge j
+ * Returns true if the edge i goes before the edge j, see Edge.Less
  */
 func (edges EdgeList) Less(i, j int) bool {
-	return edges[i].weight < edges[j].weight
+	return edges[i].Less(&edges[j])
 }
 
 /**
@@ -85,105 +101,140 @@ func (edges EdgeList) Swap(i, j int) {
 }
 
 /**
- * Used to recongise which type of graph to generate
+ * Used to recongise which type of graph to generate. Graph types of other
+ * neighborhoods can be created with RegisterStencil or DiskGraph.
  */
 type GraphType int
 
 const (
 	GRIDGRAPH  GraphType = iota
 	KINGSGRAPH GraphType = iota
+	NNGRAPH    GraphType = iota
+	GRAPH24    GraphType = iota
 )
 
 /**
  * Graph datatype. Contains a list of edges, the graph width and height and
- * if it's a King's graph or a Grid graph
+ * its type, the stencil of its neighborhood or, for nearest neighbors graphs,
+ * the neighbors of every vertex.
  */
 type Graph struct {
 	edges         EdgeList
 	width, height int
 	graphType     GraphType
+	stencil       *stencil
 	weights       [][]float64
+	neighbors     [][]int
 }
 
 /**
- * Returns a new width x height King's or Grid graph. It assigns a weight of Infinity
- * to all edges
+ * Returns a new width x height graph of the given type. It assigns a weight of
+ * Infinity to all edges. A nearest neighbors graph has no edges since they
+ * depend on the colors of an image.
  */
 func New(width, height int, graphType GraphType) *Graph {
 	g := new(Graph)
 	g.width = width
 	g.height = height
 	g.graphType = graphType
-	g.edges = make(EdgeList, 0, g.TotalEdges())
-	size := 4
-	if graphType == KINGSGRAPH {
-		size = 8
+	if graphType == NNGRAPH {
+		g.weights = make([][]float64, g.TotalVertices())
+		g.neighbors = make([][]int, g.TotalVertices())
+		return g
 	}
+	g.stencil = lookupStencil(graphType)
+	g.edges = make(EdgeList, 0, g.TotalEdges())
+	size := len(g.stencil.offsets)
 	g.weights = make([][]float64, g.TotalVertices(), g.TotalVertices())
 	for y := 0; y < g.height; y++ {
 		for x := 0; x < g.width; x++ {
 			p := x + y*g.width
-			g.weights[p] = make([]float64, size/2, size/2)
+			g.weights[p] = make([]float64, size, size)
 			for n := range g.Neighbors(p) {
+				i, _ := g.weightIndex(p, n)
 				g.edges = append(g.edges, Edge{u: p, v: n, weight: math.Inf(1)})
-				g.weights[p][g.weightIndex(p, n)] = math.Inf(1)
+				g.weights[p][i] = math.Inf(1)
 			}
 		}
 	}
 	return g
 }
 
-func (g *Graph) weightIndex(from, to int) int {
-	if to == from+1 {
-		return 0
-	} else if to == from+g.width {
-		return 1
-	} else if to == from-g.width+1 {
-		return 2
-	} else {
-		return 3
-	}
+/**
+ * Returns the position of the weight of the edge between from and to in the
+ * weights of from and true, or false if that edge isn't stored in from
+ */
+func (g *Graph) weightIndex(from, to int) (int, bool) {
+	o := Offset{DX: to%g.width - from%g.width, DY: to/g.width - from/g.width}
+	i, ok := g.stencil.index[o]
+	return i, ok
 }
 
 /**
  * Returns a new graph that represents the image img. The graph will be either
- * a King's grph or a Grid graph. It will compute the edge weights using the
- * provided function weight.
+ * a King's grph, a Grid graph, a graph of a registered stencil or a graph that
+ * connects every pixel to its nearest neighbors in the (x, y, r, g, b) space.
+ * It will compute the edge weights using the provided function weight.
  */
 func FromImage(img image.Image, weight WeightFn, graphType GraphType) *Graph {
+	g, _ := FromImageContext(context.Background(), img, weight, graphType)
+	return g
+}
+
+/**
+ * Same as FromImage but it stops as soon as ctx is done, in which case it
+ * returns the error of ctx.
+ */
+func FromImageContext(ctx context.Context, img image.Image, weight WeightFn,
+	graphType GraphType) (*Graph, error) {
+	if graphType == NNGRAPH {
+		return fromImageNN(ctx, img, weight)
+	}
 	g := new(Graph)
 	g.height = img.Bounds().Max.Y
 	g.width = img.Bounds().Max.X
 	g.graphType = graphType
+	g.stencil = lookupStencil(graphType)
 	g.edges = make(EdgeList, 0, g.TotalEdges())
-	size := 4
-	if graphType == KINGSGRAPH {
-		size = 8
-	}
+	size := len(g.stencil.offsets)
 	g.weights = make([][]float64, g.TotalVertices(), g.TotalVertices())
 
 	for y := 0; y < g.height; y++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		for x := 0; x < g.width; x++ {
 			p := x + y*g.width
 			pixel := Pixel{X: x, Y: y, Color: img.At(x, y)}
-			g.weights[p] = make([]float64, size/2, size/2)
+			g.weights[p] = make([]float64, size, size)
 			for n := range g.Neighbors(p) {
 				x2, y2 := n%g.width, n/g.width
-				pixel2 := Pixel{X: x2, Y: x2, Color: img.At(x2, y2)}
+				pixel2 := Pixel{X: x2, Y: y2, Color: img.At(x2, y2)}
 				w := weight(pixel, pixel2)
+				i, _ := g.weightIndex(p, n)
 				g.edges = append(g.edges, Edge{u: p, v: n, weight: w})
-				g.weights[p][g.weightIndex(p, n)] = w
+				g.weights[p][i] = w
 			}
 		}
 	}
-	return g
+	return g, nil
 }
 
+/**
+ * Returns the weight of the edge between the vertices u and v or Infinity if
+ * they aren't adjacent
+ */
 func (g *Graph) Weight(u, v int) float64 {
-	if u == utils.MinI(u, v) || v == u-g.width+1 {
-		return g.weights[u][g.weightIndex(u, v)]
+	if g.graphType == NNGRAPH {
+		return g.nnWeight(u, v)
+	}
+	if i, ok := g.weightIndex(u, v); ok {
+		return g.weights[u][i]
+	}
+	if i, ok := g.weightIndex(v, u); ok {
+		return g.weights[v][i]
 	}
-	return g.weights[v][g.weightIndex(v, u)]
+	return math.Inf(1)
 }
 
 /**
@@ -192,19 +243,18 @@ func (g *Graph) Weight(u, v int) float64 {
 func (g *Graph) Neighbors(v int) <-chan int {
 	ch := make(chan int, 4)
 	go func() {
-		x, y := v%g.width, v/g.width
-		if x+1 < g.width {
-			ch <- v + 1
-		}
-		if y+1 < g.height {
-			ch <- v + g.width
-		}
-		if g.graphType == KINGSGRAPH {
-			if y-1 >= 0 && x+1 < g.width {
-				ch <- v - g.width + 1
+		if g.graphType == NNGRAPH {
+			for _, n := range g.neighbors[v] {
+				ch <- n
 			}
-			if y+1 < g.height && x+1 < g.width {
-				ch <- v + g.width + 1
+			close(ch)
+			return
+		}
+		x, y := v%g.width, v/g.width
+		for _, o := range g.stencil.offsets {
+			x2, y2 := x+o.DX, y+o.DY
+			if x2 >= 0 && x2 < g.width && y2 >= 0 && y2 < g.height {
+				ch <- x2 + y2*g.width
 			}
 		}
 		close(ch)
@@ -230,10 +280,17 @@ func (g *Graph) Height() int {
  * Returns the total number of edges that the graph has
  */
 func (g *Graph) TotalEdges() int {
-	if g.graphType == KINGSGRAPH {
-		return 4*g.width*g.height - 3*(g.width+g.height) + 2
+	if g.graphType == NNGRAPH {
+		return len(g.edges)
+	}
+	total := 0
+	for _, o := range g.stencil.offsets {
+		w, h := g.width-utils.AbsI(o.DX), g.height-utils.AbsI(o.DY)
+		if w > 0 && h > 0 {
+			total += w * h
+		}
 	}
-	return (g.width-1)*g.height + g.width*(g.height-1)
+	return total
 }
 
 /**
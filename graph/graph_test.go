@@ -1,9 +1,11 @@
 package graph
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"image"
 	_ "image/png"
+	"math"
 	"os"
 	"testing"
 )
@@ -66,3 +68,89 @@ func TestKingsGraphsFromImageInitialization(t *testing.T) {
 	assert.Equal(t, 10000, graph.TotalVertices())
 	assert.Equal(t, len(graph.Edges()), graph.TotalEdges())
 }
+
+func TestFromImageContextStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	img := image.NewGray(image.Rect(0, 0, 5, 6))
+	g, err := FromImageContext(ctx, img, func(p, q Pixel) float64 {
+		return 1.0
+	}, GRIDGRAPH)
+	assert.Nil(t, g)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestFromImageContextBuildsGraph(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 5, 6))
+	g, err := FromImageContext(context.Background(), img, func(p, q Pixel) float64 {
+		return 1.0
+	}, GRIDGRAPH)
+	assert.Nil(t, err)
+	assert.Equal(t, 49, len(g.Edges()))
+}
+
+func TestWeightFnReceivesPixelCoordinates(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 5, 6))
+	FromImage(img, func(p, q Pixel) float64 {
+		assert.True(t, q.X-p.X <= 1 && p.X <= q.X)
+		assert.True(t, q.Y-p.Y <= 1 && p.Y-q.Y <= 1)
+		return 1.0
+	}, KINGSGRAPH)
+}
+
+func TestNNGraphFromImageInitialization(t *testing.T) {
+	graph := loadGraphFromImage("../test/test.png", NNGRAPH)
+	assert.Equal(t, 100, graph.Width())
+	assert.Equal(t, 100, graph.Height())
+	assert.Equal(t, 10000, graph.TotalVertices())
+	assert.Equal(t, len(graph.Edges()), graph.TotalEdges())
+	assert.True(t, graph.TotalEdges() >= 10000*NN_NEIGHBORS/2)
+	assert.True(t, graph.TotalEdges() <= 10000*NN_NEIGHBORS)
+}
+
+func TestNNGraphHasNoRepeatedEdges(t *testing.T) {
+	graph := loadGraphFromImage("../test/test.png", NNGRAPH)
+	seen := make(map[[2]int]bool)
+	for _, edge := range graph.Edges() {
+		u, v := edge.U(), edge.V()
+		assert.NotEqual(t, u, v)
+		assert.False(t, seen[[2]int{u, v}] || seen[[2]int{v, u}])
+		seen[[2]int{u, v}] = true
+	}
+}
+
+func TestNNGraphConnectsPixelsWithTheSameColor(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 20, 1))
+	for x := 10; x < 20; x++ {
+		img.Pix[x] = 255
+	}
+	img.Pix[15] = 0
+	g := FromImage(img, func(p, q Pixel) float64 {
+		return 1.0
+	}, NNGRAPH)
+	isolated := 15
+	for n := range g.Neighbors(isolated) {
+		assert.True(t, n < 10)
+	}
+	assert.Equal(t, 1.0, g.Weight(isolated, 9))
+	assert.Equal(t, 1.0, g.Weight(9, isolated))
+}
+
+func TestNNGraphWeightOfNonAdjacentVertices(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 30, 1))
+	g := FromImage(img, func(p, q Pixel) float64 {
+		return 1.0
+	}, NNGRAPH)
+	assert.True(t, math.IsInf(g.Weight(0, 29), 1))
+}
+
+func TestNNGraphFromImageContextStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	img := image.NewGray(image.Rect(0, 0, 5, 6))
+	g, err := FromImageContext(ctx, img, func(p, q Pixel) float64 {
+		return 1.0
+	}, NNGRAPH)
+	assert.Nil(t, g)
+	assert.Equal(t, context.Canceled, err)
+}
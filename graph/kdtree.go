@@ -0,0 +1,197 @@
+package graph
+
+import (
+	"container/heap"
+	"github.com/miguelfrde/image-segmentation/utils"
+	"math"
+)
+
+/**
+ * Number of coordinates of the points stored in a kdTree
+ */
+const KD_DIMENSIONS = 5
+
+/**
+ * Maximum number of points stored in a leaf of a kdTree
+ */
+const KD_LEAF_SIZE = 8
+
+/**
+ * A point stored in a kdTree
+ */
+type kdPoint [KD_DIMENSIONS]float64
+
+/**
+ * Returns the squared euclidean distance between the points p and q
+ */
+func (p *kdPoint) distance(q *kdPoint) float64 {
+	d := 0.0
+	for i := range p {
+		diff := p[i] - q[i]
+		d += diff * diff
+	}
+	return d
+}
+
+/**
+ * A node of a kdTree. Inner nodes split their points by the value of one
+ * axis, leaves keep a range of the index of the tree.
+ */
+type kdNode struct {
+	axis        int
+	split       float64
+	left, right *kdNode
+	lo, hi      int
+}
+
+/**
+ * Index of points used to answer approximate nearest neighbors queries.
+ * The search of a query can skip the branches whose points are at most
+ * 1+eps times closer than the neighbors already found.
+ */
+type kdTree struct {
+	points []kdPoint
+	index  []int
+	root   *kdNode
+	eps    float64
+}
+
+/**
+ * Returns a new kdTree that indexes the given points
+ */
+func newKDTree(points []kdPoint, eps float64) *kdTree {
+	t := &kdTree{points: points, index: make([]int, len(points)), eps: eps}
+	for i := range t.index {
+		t.index[i] = i
+	}
+	t.root = t.build(0, len(points))
+	return t
+}
+
+func (t *kdTree) build(lo, hi int) *kdNode {
+	if hi-lo <= KD_LEAF_SIZE {
+		return &kdNode{lo: lo, hi: hi}
+	}
+	axis, spread := 0, -1.0
+	for a := 0; a < KD_DIMENSIONS; a++ {
+		min, max := t.points[t.index[lo]][a], t.points[t.index[lo]][a]
+		for _, p := range t.index[lo:hi] {
+			min = utils.MinF(min, t.points[p][a])
+			max = math.Max(max, t.points[p][a])
+		}
+		if max-min > spread {
+			axis, spread = a, max-min
+		}
+	}
+	if spread == 0 {
+		return &kdNode{lo: lo, hi: hi}
+	}
+	mid := (lo + hi) / 2
+	t.selectNth(lo, hi, mid, axis)
+	node := &kdNode{axis: axis, split: t.points[t.index[mid]][axis], lo: lo, hi: hi}
+	node.left = t.build(lo, mid)
+	node.right = t.build(mid, hi)
+	return node
+}
+
+/**
+ * Reorders index[lo:hi] so that the point at position nth is the one that
+ * would be there if the range was sorted by the given axis, the points
+ * before it are not greater and the ones after it are not smaller.
+ */
+func (t *kdTree) selectNth(lo, hi, nth, axis int) {
+	value := func(i int) float64 {
+		return t.points[t.index[i]][axis]
+	}
+	for hi-lo > 1 {
+		pivot := value((lo + hi) / 2)
+		i, j := lo, hi-1
+		for i <= j {
+			for value(i) < pivot {
+				i++
+			}
+			for value(j) > pivot {
+				j--
+			}
+			if i <= j {
+				t.index[i], t.index[j] = t.index[j], t.index[i]
+				i++
+				j--
+			}
+		}
+		if nth <= j {
+			hi = j + 1
+		} else if nth >= i {
+			lo = i
+		} else {
+			return
+		}
+	}
+}
+
+/**
+ * A neighbor found by a query and its squared distance to the query point
+ */
+type kdNeighbor struct {
+	id       int
+	distance float64
+}
+
+/**
+ * Max heap of the closest neighbors found so far
+ */
+type kdNeighbors []kdNeighbor
+
+func (h kdNeighbors) Len() int            { return len(h) }
+func (h kdNeighbors) Less(i, j int) bool  { return h[i].distance > h[j].distance }
+func (h kdNeighbors) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *kdNeighbors) Push(x interface{}) { *h = append(*h, x.(kdNeighbor)) }
+func (h *kdNeighbors) Pop() interface{} {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+/**
+ * Returns the ids of the k points closest to the point with the given id,
+ * without including it, from the closest to the farthest one.
+ */
+func (t *kdTree) nearest(id, k int) []int {
+	found := make(kdNeighbors, 0, k+1)
+	t.search(t.root, id, k, &found)
+	result := make([]int, len(found))
+	for i := len(found) - 1; i >= 0; i-- {
+		result[i] = heap.Pop(&found).(kdNeighbor).id
+	}
+	return result
+}
+
+func (t *kdTree) search(node *kdNode, id, k int, found *kdNeighbors) {
+	query := &t.points[id]
+	if node.left == nil {
+		for _, p := range t.index[node.lo:node.hi] {
+			if p == id {
+				continue
+			}
+			d := query.distance(&t.points[p])
+			if found.Len() < k {
+				heap.Push(found, kdNeighbor{p, d})
+			} else if d < (*found)[0].distance {
+				(*found)[0] = kdNeighbor{p, d}
+				heap.Fix(found, 0)
+			}
+		}
+		return
+	}
+	diff := query[node.axis] - node.split
+	near, far := node.left, node.right
+	if diff >= 0 {
+		near, far = node.right, node.left
+	}
+	t.search(near, id, k, found)
+	bound := diff * diff * (1 + t.eps) * (1 + t.eps)
+	if found.Len() < k || bound < (*found)[0].distance {
+		t.search(far, id, k, found)
+	}
+}
@@ -0,0 +1,78 @@
+package graph
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+func randomPoints(n int) []kdPoint {
+	rng := rand.New(rand.NewSource(1))
+	points := make([]kdPoint, n)
+	for i := range points {
+		for a := range points[i] {
+			points[i][a] = float64(rng.Intn(50))
+		}
+	}
+	return points
+}
+
+func bruteForceNearest(points []kdPoint, id, k int) []float64 {
+	var distances []float64
+	for i := range points {
+		if i != id {
+			distances = append(distances, points[id].distance(&points[i]))
+		}
+	}
+	sort.Float64s(distances)
+	return distances[:k]
+}
+
+/*
+ * Tests
+ */
+
+func TestKDTreeFindsExactNearestNeighbors(t *testing.T) {
+	points := randomPoints(500)
+	tree := newKDTree(points, 0)
+	for id := 0; id < len(points); id += 7 {
+		nearest := tree.nearest(id, 5)
+		expected := bruteForceNearest(points, id, 5)
+		assert.Equal(t, 5, len(nearest))
+		for i, n := range nearest {
+			assert.NotEqual(t, id, n)
+			assert.Equal(t, expected[i], points[id].distance(&points[n]))
+		}
+	}
+}
+
+func TestKDTreeApproximateNeighborsAreCloseEnough(t *testing.T) {
+	points := randomPoints(500)
+	eps := 0.5
+	tree := newKDTree(points, eps)
+	for id := 0; id < len(points); id += 7 {
+		nearest := tree.nearest(id, 5)
+		expected := bruteForceNearest(points, id, 5)
+		farthest := points[id].distance(&points[nearest[len(nearest)-1]])
+		assert.True(t, farthest <= expected[4]*(1+eps)*(1+eps))
+	}
+}
+
+func TestKDTreeWithRepeatedPoints(t *testing.T) {
+	points := make([]kdPoint, 40)
+	tree := newKDTree(points, 0)
+	nearest := tree.nearest(3, 10)
+	assert.Equal(t, 10, len(nearest))
+	assert.NotContains(t, nearest, 3)
+}
+
+func TestKDTreeWithFewerPointsThanNeighbors(t *testing.T) {
+	points := randomPoints(4)
+	tree := newKDTree(points, 0)
+	assert.Equal(t, 3, len(tree.nearest(0, 10)))
+}
@@ -0,0 +1,119 @@
+package graph
+
+import (
+	"context"
+	"image"
+	"math"
+)
+
+/**
+ * Number of nearest neighbors to which every pixel of a NNGRAPH is connected
+ */
+const NN_NEIGHBORS = 10
+
+/**
+ * Scale of the pixel coordinates against the 8-bit color values in the
+ * feature space of a NNGRAPH. Greater values prefer closer neighbors.
+ */
+const NN_SPATIAL_SCALE = 1.0
+
+/**
+ * Error allowed in the nearest neighbors search: the neighbors found can be
+ * up to 1+NN_EPSILON times farther than the real ones.
+ */
+const NN_EPSILON = 0.5
+
+/**
+ * Returns the point (x, y, r, g, b) of the pixel at x, y of the image img
+ */
+func featurePoint(img image.Image, x, y int) kdPoint {
+	r, g, b, _ := img.At(x, y).RGBA()
+	return kdPoint{
+		float64(x) * NN_SPATIAL_SCALE,
+		float64(y) * NN_SPATIAL_SCALE,
+		float64(r >> 8),
+		float64(g >> 8),
+		float64(b >> 8),
+	}
+}
+
+/**
+ * Returns a new graph where every pixel of the image img is connected to its
+ * NN_NEIGHBORS nearest neighbors in the (x, y, r, g, b) feature space. The
+ * edge weights are computed with the function weight. It stops as soon as
+ * ctx is done, in which case it returns the error of ctx.
+ */
+func fromImageNN(ctx context.Context, img image.Image, weight WeightFn) (*Graph, error) {
+	g := new(Graph)
+	g.height = img.Bounds().Max.Y
+	g.width = img.Bounds().Max.X
+	g.graphType = NNGRAPH
+
+	points := make([]kdPoint, g.TotalVertices())
+	for y := 0; y < g.height; y++ {
+		for x := 0; x < g.width; x++ {
+			points[x+y*g.width] = featurePoint(img, x, y)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tree := newKDTree(points, NN_EPSILON)
+
+	nearest := make([][]int, g.TotalVertices())
+	for y := 0; y < g.height; y++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for x := 0; x < g.width; x++ {
+			p := x + y*g.width
+			nearest[p] = tree.nearest(p, NN_NEIGHBORS)
+		}
+	}
+
+	g.edges = make(EdgeList, 0, g.TotalVertices()*NN_NEIGHBORS)
+	g.neighbors = make([][]int, g.TotalVertices())
+	g.weights = make([][]float64, g.TotalVertices())
+	for p, ns := range nearest {
+		pixel := Pixel{X: p % g.width, Y: p / g.width, Color: img.At(p%g.width, p/g.width)}
+		for _, n := range ns {
+			if n < p && contains(nearest[n], p) {
+				continue
+			}
+			x2, y2 := n%g.width, n/g.width
+			pixel2 := Pixel{X: x2, Y: y2, Color: img.At(x2, y2)}
+			w := weight(pixel, pixel2)
+			g.edges = append(g.edges, Edge{u: p, v: n, weight: w})
+			g.neighbors[p] = append(g.neighbors[p], n)
+			g.weights[p] = append(g.weights[p], w)
+		}
+	}
+	return g, nil
+}
+
+/**
+ * Returns the weight of the edge between u and v of a NNGRAPH or Infinity
+ * if they aren't adjacent
+ */
+func (g *Graph) nnWeight(u, v int) float64 {
+	for i, n := range g.neighbors[u] {
+		if n == v {
+			return g.weights[u][i]
+		}
+	}
+	for i, n := range g.neighbors[v] {
+		if n == u {
+			return g.weights[v][i]
+		}
+	}
+	return math.Inf(1)
+}
+
+func contains(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
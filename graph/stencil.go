@@ -0,0 +1,160 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+/**
+ * Position of a neighbor relative to a pixel
+ */
+type Offset struct {
+	DX, DY int
+}
+
+/**
+ * Returns true if the offset o is the one used to store the edge between two
+ * pixels that are o or -o apart: the one that points to the right or, if
+ * they're in the same column, down.
+ */
+func (o Offset) forward() bool {
+	return o.DX > 0 || (o.DX == 0 && o.DY > 0)
+}
+
+/**
+ * Set of offsets that define the neighbors of every pixel of a graph. Only
+ * the forward offsets are kept so every edge is stored once, the weight of
+ * the edge of an offset is stored at its position in offsets.
+ */
+type stencil struct {
+	offsets []Offset
+	index   map[Offset]int
+}
+
+/**
+ * Returns a new stencil with the given offsets, ignoring the repeated ones,
+ * the opposites of other ones and 0, 0
+ */
+func newStencil(offsets []Offset) *stencil {
+	s := &stencil{index: make(map[Offset]int)}
+	for _, o := range offsets {
+		if !o.forward() {
+			o = Offset{-o.DX, -o.DY}
+		}
+		if _, ok := s.index[o]; ok || o == (Offset{}) {
+			continue
+		}
+		s.index[o] = len(s.offsets)
+		s.offsets = append(s.offsets, o)
+	}
+	return s
+}
+
+var (
+	stencilsMu sync.RWMutex
+	stencils   = map[GraphType]*stencil{
+		GRIDGRAPH:  newStencil([]Offset{{1, 0}, {0, 1}}),
+		KINGSGRAPH: newStencil([]Offset{{1, 0}, {0, 1}, {1, -1}, {1, 1}}),
+		GRAPH24:    newStencil(Square(2)),
+	}
+	disks         = make(map[int]GraphType)
+	nextGraphType = GRAPH24 + 1
+)
+
+/**
+ * Registers a new graph type whose pixels are adjacent to the pixels at the
+ * given offsets of them. An offset and its opposite are the same edge.
+ */
+func RegisterStencil(offsets []Offset) GraphType {
+	stencilsMu.Lock()
+	defer stencilsMu.Unlock()
+	return registerStencil(offsets)
+}
+
+func registerStencil(offsets []Offset) GraphType {
+	graphType := nextGraphType
+	nextGraphType++
+	stencils[graphType] = newStencil(offsets)
+	return graphType
+}
+
+/**
+ * Returns the graph type whose pixels are adjacent to all the pixels at most
+ * radius away from them. It's registered the first time it's requested.
+ * Radii whose disks have the same offsets share the graph type, so there's
+ * at most one graph type per disk whatever radii are requested.
+ */
+func DiskGraph(radius float64) GraphType {
+	offsets := Disk(radius)
+	/* The disk is identified by the squared distance of its farthest offset */
+	key := 0
+	for _, o := range offsets {
+		if o.DX*o.DX+o.DY*o.DY > key {
+			key = o.DX*o.DX + o.DY*o.DY
+		}
+	}
+	stencilsMu.Lock()
+	defer stencilsMu.Unlock()
+	if graphType, ok := disks[key]; ok {
+		return graphType
+	}
+	disks[key] = registerStencil(offsets)
+	return disks[key]
+}
+
+/**
+ * Returns the forward offsets of the graph type graphType. Returns nil for a
+ * nearest neighbors graph, whose neighbors depend on the image.
+ */
+func Stencil(graphType GraphType) []Offset {
+	s := lookupStencil(graphType)
+	if s == nil {
+		return nil
+	}
+	return append([]Offset(nil), s.offsets...)
+}
+
+func lookupStencil(graphType GraphType) *stencil {
+	if graphType == NNGRAPH {
+		return nil
+	}
+	stencilsMu.RLock()
+	defer stencilsMu.RUnlock()
+	s, ok := stencils[graphType]
+	if !ok {
+		panic(fmt.Sprintf("graph: unknown graph type %d", graphType))
+	}
+	return s
+}
+
+/**
+ * Returns the offsets of all the pixels at most radius away from a pixel
+ */
+func Disk(radius float64) []Offset {
+	r := int(math.Floor(radius))
+	var offsets []Offset
+	for dy := -r; dy <= r; dy++ {
+		for dx := -r; dx <= r; dx++ {
+			if float64(dx*dx+dy*dy) <= radius*radius {
+				offsets = append(offsets, Offset{dx, dy})
+			}
+		}
+	}
+	return offsets
+}
+
+/**
+ * Returns the offsets of all the pixels in the (2r+1)x(2r+1) square centered
+ * at a pixel. Square(1) is the King's graph neighborhood and Square(2) the
+ * 24-neighborhood.
+ */
+func Square(r int) []Offset {
+	var offsets []Offset
+	for dy := -r; dy <= r; dy++ {
+		for dx := -r; dx <= r; dx++ {
+			offsets = append(offsets, Offset{dx, dy})
+		}
+	}
+	return offsets
+}
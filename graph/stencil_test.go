@@ -0,0 +1,120 @@
+package graph
+
+import (
+	"github.com/stretchr/testify/assert"
+	"image"
+	"math"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+func constantWeight(p, q Pixel) float64 {
+	return 1.0
+}
+
+/*
+ * Tests
+ */
+
+func TestStencilsOfBuiltinGraphs(t *testing.T) {
+	assert.Equal(t, []Offset{{1, 0}, {0, 1}}, Stencil(GRIDGRAPH))
+	assert.Equal(t, []Offset{{1, 0}, {0, 1}, {1, -1}, {1, 1}}, Stencil(KINGSGRAPH))
+	assert.Equal(t, 12, len(Stencil(GRAPH24)))
+	assert.Nil(t, Stencil(NNGRAPH))
+}
+
+func TestRegisterStencilIgnoresOppositeAndRepeatedOffsets(t *testing.T) {
+	graphType := RegisterStencil([]Offset{{0, 0}, {2, 0}, {-2, 0}, {0, -3}, {2, 0}})
+	assert.Equal(t, []Offset{{2, 0}, {0, 3}}, Stencil(graphType))
+}
+
+func TestRegisteredStencilsHaveDifferentTypes(t *testing.T) {
+	a := RegisterStencil([]Offset{{1, 0}})
+	b := RegisterStencil([]Offset{{0, 1}})
+	assert.NotEqual(t, a, b)
+	assert.NotContains(t, []GraphType{GRIDGRAPH, KINGSGRAPH, NNGRAPH, GRAPH24}, a)
+}
+
+func TestDiskOffsets(t *testing.T) {
+	assert.Equal(t, 5, len(Disk(1)))
+	assert.Equal(t, 9, len(Disk(math.Sqrt2)))
+	assert.Equal(t, 13, len(Disk(2)))
+}
+
+func TestDiskGraphIsRegisteredOnce(t *testing.T) {
+	assert.Equal(t, DiskGraph(3), DiskGraph(3))
+	assert.NotEqual(t, DiskGraph(3), DiskGraph(2))
+	assert.Equal(t, 14, len(Stencil(DiskGraph(3))))
+}
+
+func TestDiskGraphsWithTheSameOffsetsAreShared(t *testing.T) {
+	assert.Equal(t, DiskGraph(2), DiskGraph(2.1))
+	assert.Equal(t, DiskGraph(math.Sqrt(5)), DiskGraph(2.5))
+	assert.NotEqual(t, DiskGraph(2), DiskGraph(math.Sqrt(5)))
+
+	/* Any radius up to 5 registers one of the few disks that fit in it */
+	stencilsMu.RLock()
+	before := nextGraphType
+	stencilsMu.RUnlock()
+	for radius := 1.0; radius <= 5; radius += 0.001 {
+		DiskGraph(radius)
+	}
+	stencilsMu.RLock()
+	defer stencilsMu.RUnlock()
+	assert.True(t, nextGraphType-before <= 15, "%d graph types", nextGraphType-before)
+}
+
+func TestTotalEdgesOfGraph24(t *testing.T) {
+	graph := New(5, 6, GRAPH24)
+	assert.Equal(t, 30, graph.TotalVertices())
+	assert.Equal(t, graph.TotalEdges(), len(graph.Edges()))
+	assert.Equal(t, 213, graph.TotalEdges())
+}
+
+func TestTotalEdgesWithOffsetsBiggerThanTheGraph(t *testing.T) {
+	graph := New(3, 3, RegisterStencil([]Offset{{1, 0}, {5, 0}}))
+	assert.Equal(t, 6, graph.TotalEdges())
+	assert.Equal(t, 6, len(graph.Edges()))
+}
+
+func TestGraph24FromImage(t *testing.T) {
+	graph := loadGraphFromImage("../test/test.png", GRAPH24)
+	assert.Equal(t, 10000, graph.TotalVertices())
+	assert.Equal(t, len(graph.Edges()), graph.TotalEdges())
+	for _, edge := range graph.Edges() {
+		assert.Equal(t, 1.0, graph.Weight(edge.U(), edge.V()))
+		assert.Equal(t, 1.0, graph.Weight(edge.V(), edge.U()))
+	}
+}
+
+func TestWeightOfCustomStencil(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 6, 6))
+	graph := FromImage(img, func(p, q Pixel) float64 {
+		return float64(q.X - p.X + 10*(q.Y-p.Y))
+	}, RegisterStencil([]Offset{{-2, 1}, {3, 0}}))
+	p := 2 + 2*6
+	assert.Equal(t, -8.0, graph.Weight(p, p-2+6))
+	assert.Equal(t, -8.0, graph.Weight(p-2+6, p))
+	assert.Equal(t, 3.0, graph.Weight(p, p+3))
+	assert.True(t, math.IsInf(graph.Weight(p, p+1), 1))
+}
+
+func TestNeighborsStayInsideTheGraph(t *testing.T) {
+	graph := New(4, 4, DiskGraph(2))
+	for v := 0; v < graph.TotalVertices(); v++ {
+		for n := range graph.Neighbors(v) {
+			assert.True(t, n >= 0 && n < graph.TotalVertices())
+			x, y, x2, y2 := v%4, v/4, n%4, n/4
+			assert.True(t, (x2-x)*(x2-x)+(y2-y)*(y2-y) <= 4)
+		}
+	}
+}
+
+func TestUnknownGraphTypePanics(t *testing.T) {
+	assert.Panics(t, func() {
+		FromImage(image.NewGray(image.Rect(0, 0, 2, 2)), constantWeight, GraphType(-1))
+	})
+}
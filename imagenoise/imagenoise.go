@@ -1,13 +1,15 @@
 package imagenoise
 
 import (
-	"fmt"
+	"context"
+	"github.com/miguelfrde/image-segmentation/tracing"
 	"github.com/miguelfrde/image-segmentation/utils"
 	"github.com/miguelfrde/imaging"
 	"image"
+	"io"
+	"log/slog"
 	"math"
 	"runtime"
-	"time"
 )
 
 /**
@@ -26,21 +28,71 @@ type indexValuePair struct {
 	value float64
 }
 
+/**
+ * Settings of EstimateStdev that can be changed with options
+ */
+type options struct {
+	logger *slog.Logger
+	tracer tracing.Tracer
+}
+
+/**
+ * Changes a setting of EstimateStdev
+ */
+type Option func(*options)
+
+/**
+ * Logs the estimated standard deviation to the given logger. By default
+ * nothing is logged.
+ */
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+/**
+ * Reports the time spent estimating the noise as a span of the given tracer
+ */
+func WithTracer(tracer tracing.Tracer) Option {
+	return func(o *options) {
+		o.tracer = tracer
+	}
+}
+
 /**
  * Estimates the standard deviation of the additive white gaussian noise
  * in the image.
  * Based on: "Block Based Noise Estimation Using Adaptive Gaussian Filtering"
  */
-func EstimateStdev(img image.Image) float64 {
-	fmt.Printf("estimate noise stdev...")
-	start := time.Now()
+func EstimateStdev(img image.Image, opts ...Option) float64 {
+	sigma, _ := EstimateStdevContext(context.Background(), img, opts...)
+	return sigma
+}
+
+/**
+ * Same as EstimateStdev but it stops as soon as ctx is done, in which case
+ * it returns the error of ctx.
+ */
+func EstimateStdevContext(ctx context.Context, img image.Image, opts ...Option) (float64, error) {
+	o := options{logger: slog.New(slog.NewTextHandler(io.Discard, nil)), tracer: tracing.Nop}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	span := o.tracer.Start("estimate noise")
+	defer span.End()
 	blocks := imageToBlocks(img)
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
 	blocks, minstdev := computeHomogeneousBlocksAndMinStdev(blocks)
-	filteredBlocks := filterBlocks(blocks, minstdev)
+	filteredBlocks, err := filterBlocks(ctx, blocks, minstdev)
+	if err != nil {
+		return 0, err
+	}
 	sigma := stdevOfBlockDiffs(blocks, filteredBlocks)
-	fmt.Println(time.Since(start))
-	fmt.Println("Noise stdev =", sigma)
-	return sigma
+	o.logger.Debug("estimated noise", "stdev", sigma)
+	return sigma, nil
 }
 
 /**
@@ -124,14 +176,18 @@ func computeStdevs(blocks []image.Image) (float64, []float64) {
 }
 
 /**
- * Filter all blocks using a gaussian filter with sigma = stdev
+ * Filter all blocks using a gaussian filter with sigma = stdev. Stops if ctx
+ * is done.
  */
-func filterBlocks(blocks []image.Image, stdev float64) []image.Image {
+func filterBlocks(ctx context.Context, blocks []image.Image, stdev float64) ([]image.Image, error) {
 	filteredBlocks := make([]image.Image, len(blocks), len(blocks))
 	for i, block := range blocks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		filteredBlocks[i] = imaging.Blur(block, stdev, 5)
 	}
-	return filteredBlocks
+	return filteredBlocks, nil
 }
 
 /**
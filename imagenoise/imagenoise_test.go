@@ -0,0 +1,101 @@
+package imagenoise
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/miguelfrde/image-segmentation/tracing"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"log/slog"
+	"math/rand"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+/**
+ * Returns a gray image with uniform noise around 128
+ */
+func noisyImage(width, height int, seed int64) *image.Gray {
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for p := range img.Pix {
+		img.Pix[p] = uint8(118 + rng.Intn(21))
+	}
+	return img
+}
+
+/**
+ * Tracer that records the names of the spans that are started and ended
+ */
+type recordingTracer struct {
+	started, ended []string
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	name   string
+}
+
+func (tracer *recordingTracer) Start(name string) tracing.Span {
+	tracer.started = append(tracer.started, name)
+	return recordingSpan{tracer: tracer, name: name}
+}
+
+func (span recordingSpan) End() {
+	span.tracer.ended = append(span.tracer.ended, span.name)
+}
+
+/*
+ * Tests
+ */
+
+func TestEstimateStdevWithoutOptions(t *testing.T) {
+	img := noisyImage(64, 30, 1)
+	sigma := EstimateStdev(img)
+	assert.True(t, sigma > 0)
+	assert.Equal(t, sigma, EstimateStdev(img, WithLogger(slog.Default()), WithTracer(tracing.Nop)))
+}
+
+func TestEstimateStdevWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	sigma := EstimateStdev(noisyImage(64, 30, 2), WithLogger(logger))
+
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "estimated noise", entry["msg"])
+	assert.Equal(t, sigma, entry["stdev"])
+
+	/* The estimate is logged with the debug level */
+	buf.Reset()
+	EstimateStdev(noisyImage(64, 30, 2), WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))))
+	assert.Equal(t, 0, buf.Len())
+}
+
+func TestEstimateStdevWithTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	EstimateStdev(noisyImage(64, 30, 3), WithTracer(tracer))
+	assert.Equal(t, []string{"estimate noise"}, tracer.started)
+	assert.Equal(t, []string{"estimate noise"}, tracer.ended)
+
+	/* The last option wins */
+	other := &recordingTracer{}
+	EstimateStdev(noisyImage(64, 30, 3), WithTracer(tracer), WithTracer(other))
+	assert.Equal(t, 1, len(tracer.started))
+	assert.Equal(t, 1, len(other.started))
+}
+
+func TestEstimateStdevContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tracer := &recordingTracer{}
+	sigma, err := EstimateStdevContext(ctx, noisyImage(64, 30, 4), WithTracer(tracer))
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0.0, sigma)
+	/* The span still ends */
+	assert.Equal(t, []string{"estimate noise"}, tracer.ended)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/miguelfrde/image-segmentation/jobs"
+	"github.com/miguelfrde/image-segmentation/segmentation"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+/**
+ * Parameters stored with every segmentation job: the segmentation
+ * parameters and the name and extension of the uploaded image
+ */
+type segmentJobParams struct {
+	Params    segmentParams `json:"params"`
+	Filename  string        `json:"filename"`
+	Extension string        `json:"extension"`
+}
+
+var queue *jobs.Queue
+
+/**
+ * Relative cost of each phase of a segmentation, used to turn the progress
+ * of a phase into the progress of the whole job
+ */
+var phaseWeights = map[string]float64{
+	segmentation.PHASE_NOISE:    1,
+	segmentation.PHASE_BLUR:     1,
+	segmentation.PHASE_CONVERT:  1,
+	segmentation.PHASE_FEATURES: 3,
+	segmentation.PHASE_GRAPH:    3,
+	segmentation.PHASE_SEGMENT:  4,
+	segmentation.PHASE_MERGE:    1,
+	segmentation.PHASE_IMAGE:    1,
+}
+
+/**
+ * Phases that each algorithm goes through, in order
+ */
+var algorithmPhases = map[string][]string{
+	"gbs": {segmentation.PHASE_BLUR, segmentation.PHASE_CONVERT, segmentation.PHASE_FEATURES,
+		segmentation.PHASE_GRAPH, segmentation.PHASE_SEGMENT, segmentation.PHASE_MERGE,
+		segmentation.PHASE_IMAGE},
+	"hmsf": {segmentation.PHASE_NOISE, segmentation.PHASE_BLUR, segmentation.PHASE_CONVERT,
+		segmentation.PHASE_FEATURES, segmentation.PHASE_GRAPH, segmentation.PHASE_SEGMENT,
+		segmentation.PHASE_MERGE, segmentation.PHASE_IMAGE},
+	"phmsf": {segmentation.PHASE_NOISE, segmentation.PHASE_BLUR, segmentation.PHASE_CONVERT,
+		segmentation.PHASE_FEATURES, segmentation.PHASE_GRAPH, segmentation.PHASE_SEGMENT,
+		segmentation.PHASE_MERGE, segmentation.PHASE_IMAGE},
+	"slic": {segmentation.PHASE_CONVERT, segmentation.PHASE_SEGMENT, segmentation.PHASE_MERGE,
+		segmentation.PHASE_IMAGE},
+}
+
+/**
+ * Returns the progress of a whole segmentation with the given algorithm
+ * when the given phase has completed the given fraction
+ */
+func totalProgress(algorithm, phase string, fraction float64) float64 {
+	done, total := 0.0, 0.0
+	for _, p := range algorithmPhases[algorithm] {
+		if p == phase {
+			done = total + phaseWeights[p]*fraction
+		}
+		total += phaseWeights[p]
+	}
+	if total == 0 {
+		return 0
+	}
+	return done / total
+}
+
+/**
+ * Runs a segmentation job. Returns the same response as /api/v1/segment.
+ * Jobs keep running after the client that created them disconnects.
+ */
+func runSegmentJob(job jobs.Job, progress func(string, float64)) (interface{}, error) {
+	/* Jobs stored by older versions lack the newer parameters */
+	params := segmentJobParams{Params: defaultSegmentParams()}
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return nil, err
+	}
+	response, apiErr := segmentStoredImage(context.Background(), params.Filename,
+		params.Extension, params.Params, func(phase string, fraction float64) {
+			progress(phase, totalProgress(params.Params.Algorithm, phase, fraction))
+		}, slog.Default().With("job_id", job.Id))
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return response, nil
+}
+
+/**
+ * Handles POST /jobs. Accepts the same requests as /api/v1/segment but
+ * answers immediately with the queued job.
+ */
+func createJobHandler(w http.ResponseWriter, r *http.Request) {
+	params, filename, extension, apiErr := parseSegmentRequest(w, r)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+	job, err := queue.Submit(filename, segmentJobParams{Params: params,
+		Filename: filename, Extension: extension})
+	if err == jobs.ErrQueueFull {
+		writeAPIError(w, newAPIError(http.StatusServiceUnavailable, "queue_full",
+			"there are too many jobs waiting, try again later"))
+		return
+	} else if err != nil {
+		writeAPIError(w, newAPIError(http.StatusInternalServerError, "internal_error", "%v", err))
+		return
+	}
+	requestLogger(r).Info("job submitted", "job_id", job.Id)
+	w.Header().Set("Location", "/jobs/"+job.Id)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+/**
+ * Handles GET /jobs/{id}. Answers with the status, progress and, once it's
+ * done, the result of the job. Requests to /jobs/{id}/events are handled by
+ * jobEventsHandler.
+ */
+func getJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		writeAPIError(w, newAPIError(http.StatusMethodNotAllowed, "method_not_allowed",
+			"only GET is allowed"))
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	if strings.HasSuffix(id, "/events") {
+		jobEventsHandler(w, r, strings.TrimSuffix(id, "/events"))
+		return
+	}
+	job, ok := queue.Get(id)
+	if !ok {
+		writeAPIError(w, newAPIError(http.StatusNotFound, "job_not_found",
+			"there's no job with id %q", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+/**
+ * Handles GET /jobs/{id}/events. Streams the state of the job as Server-Sent
+ * Events every time it changes, until it's done or failed or the client
+ * disconnects. Every event is a "progress" event with the job as JSON.
+ */
+func jobEventsHandler(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, newAPIError(http.StatusInternalServerError, "internal_error",
+			"streaming is not supported"))
+		return
+	}
+	job, updates, unsubscribe, ok := queue.Subscribe(id)
+	if !ok {
+		writeAPIError(w, newAPIError(http.StatusNotFound, "job_not_found",
+			"there's no job with id %q", id))
+		return
+	}
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	send := func(job jobs.Job) {
+		data, _ := json.Marshal(job)
+		fmt.Fprintf(w, "event: progress\ndata: %s\n\n", data)
+		flusher.Flush()
+	}
+	send(job)
+	for {
+		select {
+		case job, open := <-updates:
+			if !open {
+				return
+			}
+			send(job)
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
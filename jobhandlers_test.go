@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/miguelfrde/image-segmentation/jobs"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/*
+ * Helper functions
+ */
+
+/**
+ * Polls GET /jobs/{id} until the job is done or failed and returns the last
+ * response
+ */
+func waitForJob(t *testing.T, id string) (*httptest.ResponseRecorder, jobs.Job) {
+	var w *httptest.ResponseRecorder
+	var job jobs.Job
+	for i := 0; i < 400; i++ {
+		w = serve(getJobHandler, httptest.NewRequest("GET", "/jobs/"+id, nil))
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &job))
+		if job.Status == jobs.DONE || job.Status == jobs.FAILED {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return w, job
+}
+
+/*
+ * Tests
+ */
+
+func TestCreateAndGetJob(t *testing.T) {
+	w := serve(createJobHandler, multipartRequest("/jobs",
+		map[string]string{"algorithm": "phmsf", "sigma": "0"}, "img.png", pngImage(20, 10)))
+	assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var job jobs.Job
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, "/jobs/"+job.Id, w.Header().Get("Location"))
+
+	w, job = waitForJob(t, job.Id)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, jobs.DONE, job.Status)
+	var response segmentResponse
+	assert.Nil(t, json.Unmarshal(job.Result, &response))
+	assert.True(t, response.Segments > 0)
+}
+
+func TestFailedJob(t *testing.T) {
+	/* The graph settings are only checked when the job runs */
+	w := serve(createJobHandler, jsonRequest("/jobs", map[string]interface{}{"graph": "hex"},
+		pngImage(20, 10)))
+	assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var job jobs.Job
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &job))
+
+	w, job = waitForJob(t, job.Id)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, jobs.FAILED, job.Status)
+	assert.Contains(t, job.Error, "invalid_parameter")
+}
+
+func TestJobErrors(t *testing.T) {
+	for name, test := range map[string]struct {
+		handler http.HandlerFunc
+		request *http.Request
+		status  int
+		code    string
+	}{
+		"no image": {createJobHandler, jsonRequest("/jobs", nil, nil), 400, "missing_image"},
+		"create with get": {createJobHandler, httptest.NewRequest("GET", "/jobs", nil), 405,
+			"method_not_allowed"},
+		"get with post": {getJobHandler, httptest.NewRequest("POST", "/jobs/a", nil), 405,
+			"method_not_allowed"},
+		"unknown job": {getJobHandler, httptest.NewRequest("GET", "/jobs/unknown", nil), 404,
+			"job_not_found"},
+		"events of an unknown job": {getJobHandler,
+			httptest.NewRequest("GET", "/jobs/unknown/events", nil), 404, "job_not_found"},
+	} {
+		w := serve(test.handler, test.request)
+		assert.Equal(t, test.status, w.Code, name)
+		assert.Equal(t, test.code, errorCode(t, w), name)
+	}
+}
+
+func TestCreateJobWhenTheQueueIsFull(t *testing.T) {
+	defer func(running *jobs.Queue) { queue = running }(queue)
+	var err error
+	/* Without workers and capacity nothing can be queued */
+	queue, err = jobs.NewQueue(0, 0, filepath.Join(t.TempDir(), "jobs.json"), runSegmentJob)
+	assert.Nil(t, err)
+	w := serve(createJobHandler, jsonRequest("/jobs", nil, pngImage(20, 10)))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "queue_full", errorCode(t, w))
+}
+
+func TestJobEvents(t *testing.T) {
+	w := serve(createJobHandler, jsonRequest("/jobs", map[string]interface{}{"sigma": 0},
+		pngImage(20, 10)))
+	var job jobs.Job
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &job))
+	waitForJob(t, job.Id)
+
+	/* The stream of a finished job ends after its current state */
+	w = serve(getJobHandler, httptest.NewRequest("GET", "/jobs/"+job.Id+"/events", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "event: progress\ndata: ")
+	assert.Contains(t, w.Body.String(), `"status":"done"`)
+}
@@ -0,0 +1,380 @@
+/**
+ * Package jobs implements a queue of jobs that are run asynchronously by a
+ * bounded pool of workers. The state of every job is stored in an index file
+ * so that finished jobs survive a restart.
+ */
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+ * Number of finished jobs that a queue keeps. Once there are more, the oldest
+ * ones are forgotten, so the index file doesn't grow forever.
+ */
+const MAX_FINISHED_JOBS = 1000
+
+/**
+ * Status of a job
+ */
+type Status string
+
+const (
+	QUEUED  Status = "queued"
+	RUNNING Status = "running"
+	DONE    Status = "done"
+	FAILED  Status = "failed"
+)
+
+/**
+ * Returned by Submit when there's no space left in the queue
+ */
+var ErrQueueFull = errors.New("jobs: the queue is full")
+
+/**
+ * Returned by Submit when there's already a job with the same id
+ */
+var ErrDuplicateId = errors.New("jobs: duplicate job id")
+
+/**
+ * A unit of work. Params are the parameters given when it was submitted,
+ * Result is what the runner returned, both encoded as JSON. Progress goes
+ * from 0 to 1 and Phase is the name of the step that is running. Started and
+ * Finished are nil until the job starts and finishes.
+ */
+type Job struct {
+	Id       string          `json:"id"`
+	Status   Status          `json:"status"`
+	Progress float64         `json:"progress"`
+	Phase    string          `json:"phase,omitempty"`
+	Params   json.RawMessage `json:"params,omitempty"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Created  time.Time       `json:"created"`
+	Started  *time.Time      `json:"started,omitempty"`
+	Finished *time.Time      `json:"finished,omitempty"`
+}
+
+/**
+ * Function that performs the work of a job. It receives the job and a
+ * function to report the phase that is running and the total progress of
+ * the job, and returns the result of the job, which must be encodable as JSON.
+ */
+type Runner func(job Job, progress func(phase string, fraction float64)) (interface{}, error)
+
+/**
+ * Queue of jobs. Jobs are run in submission order by a fixed number of
+ * workers. Only the last MAX_FINISHED_JOBS finished jobs are kept.
+ */
+type Queue struct {
+	mutex        sync.Mutex
+	jobs         map[string]*Job
+	pending      chan string
+	runner       Runner
+	indexPath    string
+	listeners    map[string][]chan Job
+	keepFinished int
+}
+
+/**
+ * Returns a new queue that runs jobs with the given runner using the given
+ * number of workers and that holds at most capacity jobs waiting to run.
+ * The state of the jobs is stored in the file indexPath; if it already
+ * exists, its jobs are loaded and the ones that didn't finish are queued
+ * again.
+ */
+func NewQueue(workers, capacity int, indexPath string, runner Runner) (*Queue, error) {
+	q := new(Queue)
+	q.jobs = make(map[string]*Job)
+	q.listeners = make(map[string][]chan Job)
+	q.runner = runner
+	q.indexPath = indexPath
+	q.keepFinished = MAX_FINISHED_JOBS
+
+	unfinished, err := q.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	if capacity < len(unfinished) {
+		capacity = len(unfinished)
+	}
+	q.pending = make(chan string, capacity)
+	for _, job := range unfinished {
+		job.Status = QUEUED
+		job.Progress = 0
+		job.Phase = ""
+		job.Started = nil
+		q.pending <- job.Id
+	}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q, nil
+}
+
+/**
+ * Adds a new job with the given id and parameters to the queue. Returns
+ * a copy of the job. The job isn't queued if it can't be written to the
+ * index file, in which case the error is returned.
+ */
+func (q *Queue) Submit(id string, params interface{}) (Job, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return Job{}, err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if _, ok := q.jobs[id]; ok {
+		return Job{}, ErrDuplicateId
+	}
+	/* Only Submit sends to pending and it holds the mutex, so the send can't block */
+	if len(q.pending) == cap(q.pending) {
+		return Job{}, ErrQueueFull
+	}
+	job := &Job{Id: id, Status: QUEUED, Params: data, Created: time.Now()}
+	q.jobs[id] = job
+	if err := q.saveIndex(); err != nil {
+		delete(q.jobs, id)
+		return Job{}, err
+	}
+	q.pending <- id
+	return *job, nil
+}
+
+/**
+ * Returns a copy of the job with the given id and true, or false if
+ * there's no such job
+ */
+func (q *Queue) Get(id string) (Job, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+/**
+ * Returns a copy of the job with the given id and a channel that receives
+ * a copy of it every time it changes. The channel is closed once the job is
+ * done or failed. Listeners that fall behind only get the latest state.
+ * The returned function must be called to stop listening. Returns false
+ * if there's no such job.
+ */
+func (q *Queue) Subscribe(id string) (Job, <-chan Job, func(), bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, nil, nil, false
+	}
+	ch := make(chan Job, 1)
+	if job.Status == DONE || job.Status == FAILED {
+		close(ch)
+		return *job, ch, func() {}, true
+	}
+	q.listeners[id] = append(q.listeners[id], ch)
+	unsubscribe := func() {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		listeners := q.listeners[id]
+		for i, listener := range listeners {
+			if listener == ch {
+				q.listeners[id] = append(listeners[:i], listeners[i+1:]...)
+				close(ch)
+				break
+			}
+		}
+	}
+	return *job, ch, unsubscribe, true
+}
+
+/**
+ * Sends the current state of the job to its listeners. Once the job is
+ * finished the listeners are closed and removed. The caller must hold the
+ * mutex.
+ */
+func (q *Queue) notify(job *Job) {
+	for _, ch := range q.listeners[job.Id] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- *job
+		if job.Status == DONE || job.Status == FAILED {
+			close(ch)
+		}
+	}
+	if job.Status == DONE || job.Status == FAILED {
+		delete(q.listeners, job.Id)
+	}
+}
+
+/**
+ * Takes jobs from the queue and runs them until the program finishes. Errors
+ * writing the index file are logged to the default logger.
+ */
+func (q *Queue) work() {
+	for id := range q.pending {
+		q.mutex.Lock()
+		job := q.jobs[id]
+		started := time.Now()
+		job.Status = RUNNING
+		job.Started = &started
+		q.saveIndexOrLog(job)
+		q.notify(job)
+		snapshot := *job
+		q.mutex.Unlock()
+
+		result, err := q.run(snapshot)
+		var data []byte
+		if err == nil {
+			data, err = json.Marshal(result)
+		}
+
+		q.mutex.Lock()
+		finished := time.Now()
+		job.Finished = &finished
+		if err != nil {
+			job.Status = FAILED
+			job.Error = err.Error()
+		} else {
+			job.Status = DONE
+			job.Progress = 1
+			job.Result = data
+		}
+		q.saveIndexOrLog(job)
+		q.notify(job)
+		q.mutex.Unlock()
+	}
+}
+
+/**
+ * Writes the index file after the state of the job changed, logging the
+ * error if it can't be written. The caller must hold the mutex.
+ */
+func (q *Queue) saveIndexOrLog(job *Job) {
+	if err := q.saveIndex(); err != nil {
+		slog.Error("could not save the jobs index", "job_id", job.Id, "status", job.Status,
+			"error", err)
+	}
+}
+
+/**
+ * Runs the job with the runner turning a panic into an error, so a single
+ * bad job can't stop a worker. The panic is logged to the default logger
+ * with its stack.
+ */
+func (q *Queue) run(job Job) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("job runner panicked", "job_id", job.Id, "panic", r,
+				"stack", string(debug.Stack()))
+			err = fmt.Errorf("jobs: runner panicked: %v", r)
+		}
+	}()
+	return q.runner(job, func(phase string, progress float64) {
+		q.mutex.Lock()
+		q.jobs[job.Id].Phase = phase
+		q.jobs[job.Id].Progress = progress
+		q.notify(q.jobs[job.Id])
+		q.mutex.Unlock()
+	})
+}
+
+/**
+ * Reads the index file. Returns the jobs that weren't finished sorted by
+ * creation time.
+ */
+func (q *Queue) loadIndex() ([]*Job, error) {
+	data, err := ioutil.ReadFile(q.indexPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var jobs []*Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, err
+	}
+	unfinished := make([]*Job, 0, len(jobs))
+	for _, job := range jobs {
+		q.jobs[job.Id] = job
+		if job.Status == QUEUED || job.Status == RUNNING {
+			unfinished = append(unfinished, job)
+		}
+	}
+	sort.Sort(byCreation(unfinished))
+	return unfinished, nil
+}
+
+/**
+ * Forgets the oldest finished jobs when there are more than the queue keeps.
+ * The caller must hold the mutex.
+ */
+func (q *Queue) prune() {
+	finished := make([]*Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		if job.Status == DONE || job.Status == FAILED {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= q.keepFinished {
+		return
+	}
+	sort.Sort(byCreation(finished))
+	for _, job := range finished[:len(finished)-q.keepFinished] {
+		delete(q.jobs, job.Id)
+	}
+}
+
+/**
+ * Writes all the jobs to the index file after forgetting the oldest finished
+ * ones. It writes a temporary file first and then renames it, so the index
+ * is never left half written. The caller must hold the mutex.
+ */
+func (q *Queue) saveIndex() error {
+	q.prune()
+	jobs := make([]*Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Sort(byCreation(jobs))
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(q.indexPath+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(q.indexPath+".tmp", q.indexPath)
+}
+
+/**
+ * Used to sort jobs by creation time with sort.Sort
+ */
+type byCreation []*Job
+
+func (jobs byCreation) Len() int {
+	return len(jobs)
+}
+
+func (jobs byCreation) Less(i, j int) bool {
+	return jobs[i].Created.Before(jobs[j].Created)
+}
+
+func (jobs byCreation) Swap(i, j int) {
+	jobs[i], jobs[j] = jobs[j], jobs[i]
+}
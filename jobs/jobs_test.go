@@ -0,0 +1,257 @@
+package jobs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/*
+ * Helper functions
+ */
+
+func tempIndex(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "index.json")
+}
+
+func waitFor(q *Queue, id string, status Status) Job {
+	for i := 0; i < 200; i++ {
+		if job, _ := q.Get(id); job.Status == status {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	job, _ := q.Get(id)
+	return job
+}
+
+func echoRunner(job Job, progress func(string, float64)) (interface{}, error) {
+	progress("echo", 0.5)
+	if string(job.Params) == `"fail"` {
+		return nil, errors.New("failed on purpose")
+	}
+	return map[string]string{"params": string(job.Params)}, nil
+}
+
+/*
+ * Tests
+ */
+
+func TestSubmittedJobIsRun(t *testing.T) {
+	index := tempIndex(t)
+	defer os.RemoveAll(filepath.Dir(index))
+	q, err := NewQueue(1, 10, index, echoRunner)
+	assert.Nil(t, err)
+	_, err = q.Submit("a", "hello")
+	assert.Nil(t, err)
+	job := waitFor(q, "a", DONE)
+	assert.Equal(t, DONE, job.Status)
+	assert.Equal(t, 1.0, job.Progress)
+	assert.JSONEq(t, `{"params": "\"hello\""}`, string(job.Result))
+}
+
+func TestFailedJob(t *testing.T) {
+	index := tempIndex(t)
+	defer os.RemoveAll(filepath.Dir(index))
+	q, _ := NewQueue(1, 10, index, echoRunner)
+	q.Submit("a", "fail")
+	job := waitFor(q, "a", FAILED)
+	assert.Equal(t, FAILED, job.Status)
+	assert.Equal(t, "failed on purpose", job.Error)
+}
+
+func TestUnknownJob(t *testing.T) {
+	index := tempIndex(t)
+	defer os.RemoveAll(filepath.Dir(index))
+	q, _ := NewQueue(1, 10, index, echoRunner)
+	_, ok := q.Get("missing")
+	assert.False(t, ok)
+}
+
+func TestDuplicateId(t *testing.T) {
+	index := tempIndex(t)
+	defer os.RemoveAll(filepath.Dir(index))
+	q, _ := NewQueue(1, 10, index, echoRunner)
+	q.Submit("a", 1)
+	_, err := q.Submit("a", 2)
+	assert.Equal(t, ErrDuplicateId, err)
+}
+
+func TestQueueFull(t *testing.T) {
+	index := tempIndex(t)
+	defer os.RemoveAll(filepath.Dir(index))
+	q, _ := NewQueue(0, 1, index, echoRunner)
+	_, err := q.Submit("a", 1)
+	assert.Nil(t, err)
+	_, err = q.Submit("b", 2)
+	assert.Equal(t, ErrQueueFull, err)
+}
+
+func TestFinishedJobsSurviveRestart(t *testing.T) {
+	index := tempIndex(t)
+	defer os.RemoveAll(filepath.Dir(index))
+	q, _ := NewQueue(1, 10, index, echoRunner)
+	q.Submit("a", "hello")
+	waitFor(q, "a", DONE)
+
+	restarted, err := NewQueue(1, 10, index, echoRunner)
+	assert.Nil(t, err)
+	job, ok := restarted.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, DONE, job.Status)
+	assert.JSONEq(t, `{"params": "\"hello\""}`, string(job.Result))
+}
+
+func TestUnfinishedJobsAreQueuedAgainAfterRestart(t *testing.T) {
+	index := tempIndex(t)
+	defer os.RemoveAll(filepath.Dir(index))
+	q, _ := NewQueue(0, 10, index, echoRunner)
+	q.Submit("a", "hello")
+
+	restarted, _ := NewQueue(1, 10, index, echoRunner)
+	job := waitFor(restarted, "a", DONE)
+	assert.Equal(t, DONE, job.Status)
+}
+
+func TestSubscribeReceivesUpdatesUntilDone(t *testing.T) {
+	index := tempIndex(t)
+	defer os.RemoveAll(filepath.Dir(index))
+	q, _ := NewQueue(0, 10, index, echoRunner)
+	q.Submit("a", "hello")
+	job, updates, unsubscribe, ok := q.Subscribe("a")
+	defer unsubscribe()
+	assert.True(t, ok)
+	assert.Equal(t, QUEUED, job.Status)
+
+	go q.work()
+	var last Job
+	for job := range updates {
+		last = job
+	}
+	assert.Equal(t, DONE, last.Status)
+}
+
+func TestSubscribeToFinishedJob(t *testing.T) {
+	index := tempIndex(t)
+	defer os.RemoveAll(filepath.Dir(index))
+	q, _ := NewQueue(1, 10, index, echoRunner)
+	q.Submit("a", "hello")
+	waitFor(q, "a", DONE)
+	job, updates, _, ok := q.Subscribe("a")
+	assert.True(t, ok)
+	assert.Equal(t, DONE, job.Status)
+	_, open := <-updates
+	assert.False(t, open)
+}
+
+func TestJobTimes(t *testing.T) {
+	index := tempIndex(t)
+	defer os.RemoveAll(filepath.Dir(index))
+	q, _ := NewQueue(0, 10, index, echoRunner)
+	job, _ := q.Submit("a", "hello")
+	assert.Nil(t, job.Started)
+	assert.Nil(t, job.Finished)
+	data, err := json.Marshal(job)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "started")
+	assert.NotContains(t, string(data), "finished")
+
+	go q.work()
+	job = waitFor(q, "a", DONE)
+	assert.False(t, job.Started.Before(job.Created))
+	assert.False(t, job.Finished.Before(*job.Started))
+}
+
+func TestSubmitFailsIfTheIndexCantBeWritten(t *testing.T) {
+	index := tempIndex(t)
+	defer os.RemoveAll(filepath.Dir(index))
+	q, _ := NewQueue(0, 10, filepath.Join(index, "missing", "index.json"), echoRunner)
+	_, err := q.Submit("a", "hello")
+	assert.NotNil(t, err)
+	_, ok := q.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, len(q.pending))
+}
+
+func TestWorkerLogsIndexErrors(t *testing.T) {
+	index := tempIndex(t)
+	defer os.RemoveAll(filepath.Dir(index))
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	q, _ := NewQueue(0, 10, index, echoRunner)
+	q.Submit("a", "hello")
+	q.indexPath = filepath.Join(index, "missing", "index.json")
+	go q.work()
+	job := waitFor(q, "a", DONE)
+	assert.Equal(t, DONE, job.Status)
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var entry map[string]interface{}
+	assert.Nil(t, json.NewDecoder(&buf).Decode(&entry))
+	assert.Equal(t, "could not save the jobs index", entry["msg"])
+	assert.Equal(t, "a", entry["job_id"])
+}
+
+func TestRunnerPanicIsLogged(t *testing.T) {
+	index := tempIndex(t)
+	defer os.RemoveAll(filepath.Dir(index))
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	q, _ := NewQueue(1, 10, index, func(job Job, progress func(string, float64)) (interface{}, error) {
+		panic("out of pixels")
+	})
+	q.Submit("a", "hello")
+	job := waitFor(q, "a", FAILED)
+	assert.Equal(t, FAILED, job.Status)
+	assert.Equal(t, "jobs: runner panicked: out of pixels", job.Error)
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var entry map[string]interface{}
+	assert.Nil(t, json.NewDecoder(&buf).Decode(&entry))
+	assert.Equal(t, "job runner panicked", entry["msg"])
+	assert.Equal(t, "a", entry["job_id"])
+	assert.Equal(t, "out of pixels", entry["panic"])
+	assert.Contains(t, entry["stack"], "jobs.(*Queue).run")
+}
+
+func TestOldFinishedJobsArePruned(t *testing.T) {
+	index := tempIndex(t)
+	defer os.RemoveAll(filepath.Dir(index))
+	q, _ := NewQueue(1, 10, index, echoRunner)
+	q.keepFinished = 2
+	for _, id := range []string{"a", "b", "c"} {
+		q.Submit(id, id)
+		waitFor(q, id, DONE)
+	}
+	_, ok := q.Get("a")
+	assert.False(t, ok)
+	for _, id := range []string{"b", "c"} {
+		job, _ := q.Get(id)
+		assert.Equal(t, DONE, job.Status, id)
+	}
+
+	/* The index doesn't keep them either */
+	restarted, err := NewQueue(1, 10, index, echoRunner)
+	assert.Nil(t, err)
+	_, ok = restarted.Get("a")
+	assert.False(t, ok)
+	_, ok = restarted.Get("c")
+	assert.True(t, ok)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+/**
+ * Header used to receive and return the id of every request
+ */
+const REQUEST_ID_HEADER = "X-Request-Id"
+
+type contextKey int
+
+const loggerKey contextKey = iota
+
+/**
+ * Returns the logger of the server: JSON lines on stdout with the level set
+ * by the LOG_LEVEL environment variable, info by default
+ */
+func newLogger() *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+}
+
+/**
+ * Returns the logger of the request, which adds its id to every entry
+ */
+func requestLogger(r *http.Request) *slog.Logger {
+	if logger, ok := r.Context().Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+/**
+ * Keeps the status code written to a response. It also implements
+ * http.Flusher so that event streams keep working.
+ */
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+/**
+ * Gives every request an id, taken from the X-Request-Id header if the
+ * client sent one, returns it in the same header and logs every request
+ * once it has been served.
+ */
+func withRequestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(REQUEST_ID_HEADER)
+		if id == "" {
+			id = randomString()
+		}
+		w.Header().Set(REQUEST_ID_HEADER, id)
+		logger := slog.Default().With("request_id", id)
+		r = r.WithContext(context.WithValue(r.Context(), loggerKey, logger))
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		logger.Info("request served", "method", r.Method, "path", r.URL.Path,
+			"status", recorder.status, "duration", time.Since(start))
+	})
+}
@@ -1,13 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/miguelfrde/image-segmentation/jobs"
 	"github.com/miguelfrde/image-segmentation/segmentation"
 	"html/template"
 	"image"
 	"image/png"
 	"io"
+	"log/slog"
 	"math/rand"
 	"mime/multipart"
 	"net/http"
@@ -20,6 +22,11 @@ import (
 
 const RANDOM_STR_SIZE = 25
 
+/**
+ * Maximum number of segmentation jobs waiting to be run
+ */
+const MAX_QUEUED_JOBS = 100
+
 var templates = template.Must(template.ParseGlob("web/templates/*"))
 var letters = []byte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_0123456789")
 
@@ -56,51 +63,161 @@ func createFileInFS(file multipart.File, extension string) (string, error) {
 	return newfilename, nil
 }
 
+/**
+ * Returns the graph settings selected in the web form
+ */
+func formGraphOptions(r *http.Request) (graphSettings, *apiError) {
+	params := defaultSegmentParams()
+	for name, value := range map[string]*string{"graph": &params.Graph,
+		"weightfn": &params.WeightFn, "colorspace": &params.ColorSpace} {
+		if r.FormValue(name) != "" {
+			*value = r.FormValue(name)
+		}
+	}
+	if weight, err := strconv.ParseFloat(r.FormValue("featureWeight"), 64); err == nil {
+		params.FeatureWeight = weight
+	}
+	if radius, err := strconv.ParseFloat(r.FormValue("radius"), 64); err == nil {
+		params.Radius = radius
+	}
+	params.Features = formFeatures(r)
+	return params.graphOptions()
+}
+
+/**
+ * Returns the renderer of the result images selected in the web form
+ */
+func formRenderer(r *http.Request) (segmentation.Renderer, *apiError) {
+	params := defaultRenderParams()
+	if apiErr := params.readForm(r); apiErr != nil {
+		return segmentation.Renderer{}, apiErr
+	}
+	return params.renderer()
+}
+
 /* Handlers */
 
 func mainHandler(w http.ResponseWriter, r *http.Request) {
 	templates.ExecuteTemplate(w, "main", nil)
 }
 
-func segmentHandler(w http.ResponseWriter, r *http.Request) {
+/**
+ * Segmentation requested from the web form: the uploaded image, which is
+ * stored in the tmp directory, and a segmenter of it with the graph and
+ * render settings of the form
+ */
+type formSegmentation struct {
+	filename  string
+	extension string
+	sigma     float64
+	segmenter *segmentation.Segmenter
+	logger    *slog.Logger
+}
+
+/**
+ * Reads the image, sigma and the graph and render settings that all the web
+ * form requests share and logs the given message. Writes the error to w and
+ * returns nil if any of them is invalid.
+ */
+func parseFormSegmentation(w http.ResponseWriter, r *http.Request,
+	message string) *formSegmentation {
 	file, header, err := r.FormFile("file")
-	extension := filepath.Ext(header.Filename)
 	if err != nil {
 		fmt.Fprintln(w, err)
-		return
+		return nil
 	}
-
+	extension := filepath.Ext(header.Filename)
 	filename, err := createFileInFS(file, extension)
 	if err != nil {
 		fmt.Fprintln(w, err)
-		return
+		return nil
 	}
 
 	sigma, err := strconv.ParseFloat(r.FormValue("sigma"), 64)
 	if err != nil {
 		fmt.Fprintln(w, err)
-		return
+		return nil
+	}
+	settings, apiErr := formGraphOptions(r)
+	if apiErr != nil {
+		fmt.Fprintln(w, apiErr.Message)
+		return nil
+	}
+	renderer, apiErr := formRenderer(r)
+	if apiErr != nil {
+		fmt.Fprintln(w, apiErr.Message)
+		return nil
 	}
 
-	graphType := graph.KINGSGRAPH
-	if r.FormValue("graph") == "2" {
-		graphType = graph.GRIDGRAPH
+	logger := requestLogger(r).With("image", filename)
+	logger.Info(message, "filename", header.Filename)
+	img := loadImageFromFile("tmp/" + filename + extension)
+	if img == nil {
+		fmt.Fprintln(w, "the image could not be decoded")
+		return nil
 	}
+	segmenter := settings.newSegmenter(img, segmentation.WithLogger(logger))
+	segmenter.SetRenderer(renderer)
+	return &formSegmentation{filename: filename, extension: extension, sigma: sigma,
+		segmenter: segmenter, logger: logger}
+}
 
-	weightfn := segmentation.NNWeight
-	if r.FormValue("weightfn") == "2" {
-		weightfn = segmentation.IntensityDifference
+/**
+ * Answers a web form request with the error of the segmentation or, if it
+ * succeeded, writes its result image and answers with the name and extension
+ * of the stored image. Canceled segmentations are only logged and a result
+ * image that can't be drawn or written is an internal server error.
+ */
+func (f *formSegmentation) respond(w http.ResponseWriter, err error) {
+	var canceled *segmentation.CanceledError
+	if errors.As(err, &canceled) {
+		f.logger.Info("segmentation canceled", "error", err)
+		return
+	} else if err != nil {
+		fmt.Fprintln(w, err)
+		return
 	}
 
-	fmt.Println("Segmenting requested image:", header.Filename, "as", filename)
-	img := loadImageFromFile("tmp/" + filename + extension)
-	segmenter := segmentation.New(img, graphType, weightfn)
-	if r.FormValue("color") == "on" {
-		segmenter.SetRandomColors(true)
+	resultimg := f.segmenter.GetResultImage()
+	if resultimg == nil {
+		http.Error(w, "the result image could not be drawn", http.StatusInternalServerError)
+		return
 	}
+	toimg, err := os.Create("tmp/new_" + f.filename + ".png")
+	if err != nil {
+		f.logger.Error("could not write the result image", "error", err)
+		http.Error(w, "the result image could not be written", http.StatusInternalServerError)
+		return
+	}
+	defer toimg.Close()
+	if err := png.Encode(toimg, resultimg); err != nil {
+		f.logger.Error("could not write the result image", "error", err)
+		http.Error(w, "the result image could not be written", http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, f.filename, f.extension)
+}
 
-	if algorithm := r.FormValue("algorithm"); algorithm == "1" {
-		fmt.Println("Using GBS")
+func segmentHandler(w http.ResponseWriter, r *http.Request) {
+	f := parseFormSegmentation(w, r, "segmenting requested image")
+	if f == nil {
+		return
+	}
+
+	var segmentErr error
+	if algorithm := r.FormValue("algorithm"); algorithm == "slic" {
+		superpixels, err := strconv.Atoi(r.FormValue("superpixels"))
+		if err != nil {
+			fmt.Fprintln(w, err)
+			return
+		}
+		compactness, err := strconv.ParseFloat(r.FormValue("compactness"), 64)
+		if err != nil {
+			fmt.Fprintln(w, err)
+			return
+		}
+		_, segmentErr = f.segmenter.SegmentSLICContext(r.Context(), superpixels, compactness)
+	} else if algorithm == "gbs" {
 		k, err := strconv.ParseFloat(r.FormValue("k"), 64)
 		if err != nil {
 			fmt.Fprintln(w, err)
@@ -111,45 +228,89 @@ func segmentHandler(w http.ResponseWriter, r *http.Request) {
 			fmt.Fprintln(w, err)
 			return
 		}
-		segmenter.SegmentGBS(sigma, k, int(minSize))
+		_, segmentErr = f.segmenter.SegmentGBSContext(r.Context(), f.sigma, k, int(minSize))
 	} else {
-		fmt.Println("Using HMSF")
 		minWeight, err := strconv.ParseFloat(r.FormValue("minweight"), 64)
 		if err != nil {
 			fmt.Fprintln(w, err)
 			return
 		}
-		segmenter.SegmentHMSF(sigma, minWeight)
+		if algorithm == "phmsf" {
+			_, segmentErr = f.segmenter.SegmentPHMSFContext(r.Context(), f.sigma, minWeight)
+		} else {
+			_, segmentErr = f.segmenter.SegmentHMSFContext(r.Context(), f.sigma, minWeight)
+		}
 	}
+	f.respond(w, segmentErr)
+}
 
-	toimg, _ := os.Create("tmp/new_" + filename + ".png")
-	defer toimg.Close()
-	png.Encode(toimg, segmenter.GetResultImage())
-	fmt.Fprintln(w, filename, extension)
+func scribbleHandler(w http.ResponseWriter, r *http.Request) {
+	scribbles, _, err := r.FormFile("scribbles")
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return
+	}
+	scribblesImg, _, err := image.Decode(scribbles)
+	scribbles.Close()
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return
+	}
+	k, err := strconv.ParseFloat(r.FormValue("k"), 64)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return
+	}
+	minSize, err := strconv.ParseFloat(r.FormValue("minsize"), 32)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return
+	}
+
+	f := parseFormSegmentation(w, r, "segmenting requested image with scribbles")
+	if f == nil {
+		return
+	}
+	_, err = f.segmenter.SegmentSeededContext(r.Context(), f.sigma, k, int(minSize),
+		segmentation.MarkersFromImage(scribblesImg))
+	f.respond(w, err)
 }
 
 func servePublicFile(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("Received request for public file:", r.URL.Path[1:])
 	http.ServeFile(w, r, "web/public/"+r.URL.Path[1:])
 }
 
 func serveTmpFile(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("Received request for temporal file:", r.URL.Path[1:])
 	http.ServeFile(w, r, r.URL.Path[1:])
 }
 
 func main() {
 	rand.Seed(time.Now().UTC().UnixNano())
 	runtime.GOMAXPROCS(runtime.NumCPU())
+	slog.SetDefault(newLogger())
+
+	var err error
+	queue, err = jobs.NewQueue(runtime.NumCPU(), MAX_QUEUED_JOBS, "tmp/jobs.json", runSegmentJob)
+	if err != nil {
+		slog.Error("could not load the jobs index", "error", err)
+		os.Exit(1)
+	}
+
 	http.HandleFunc("/", mainHandler)
 	http.HandleFunc("/tmp/", serveTmpFile)
 	http.HandleFunc("/segment", segmentHandler)
+	http.HandleFunc("/segment/scribbles", scribbleHandler)
+	http.HandleFunc("/api/v1/segment", apiSegmentHandler)
+	http.HandleFunc("/api/v1/sweep", apiSweepHandler)
+	http.HandleFunc("/jobs", createJobHandler)
+	http.HandleFunc("/jobs/", getJobHandler)
 
 	/* Static files */
 	for _, dir := range []string{"css", "img", "js", "components"} {
 		http.HandleFunc("/"+dir+"/", servePublicFile)
 	}
 
-	fmt.Println("Listening on port " + os.Getenv("PORT") + "...")
-	http.ListenAndServe(":"+os.Getenv("PORT"), nil)
+	slog.Info("listening", "port", os.Getenv("PORT"))
+	err = http.ListenAndServe(":"+os.Getenv("PORT"), withRequestLogging(http.DefaultServeMux))
+	slog.Error("server stopped", "error", err)
 }
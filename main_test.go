@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/miguelfrde/image-segmentation/segmentation"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+func formSegmentationOf(filename string) *formSegmentation {
+	img := image.NewGray(image.Rect(0, 0, 20, 10))
+	return &formSegmentation{filename: filename, extension: ".png",
+		segmenter: segmentation.New(img, graph.GRIDGRAPH, segmentation.IntensityDifference),
+		logger:    slog.Default()}
+}
+
+/*
+ * Tests
+ */
+
+func TestRespondWritesTheResultImage(t *testing.T) {
+	f := formSegmentationOf("respond")
+	f.segmenter.SegmentGBS(0, 300, 5)
+	w := httptest.NewRecorder()
+	f.respond(w, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "respond .png\n", w.Body.String())
+	_, err := os.Stat("tmp/new_respond.png")
+	assert.Nil(t, err)
+}
+
+func TestRespondWithoutAResultImage(t *testing.T) {
+	/* Nothing was segmented, so there's no result image to draw */
+	w := httptest.NewRecorder()
+	formSegmentationOf("missing").respond(w, nil)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	_, err := os.Stat("tmp/new_missing.png")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,243 @@
+/**
+ * Package palette generates the colors of the segments of result images.
+ * Colors are deterministic: the same seed always gives the same colors.
+ * Distinct palettes step the hue by the golden angle in the CIELCh space, so
+ * that consecutive colors are as far apart as possible, and graph palettes
+ * color the segments so that adjacent ones get distant colors.
+ */
+package palette
+
+import (
+	"fmt"
+	"github.com/miguelfrde/image-segmentation/colorspace"
+	"image/color"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+/**
+ * How a Palette chooses the color of every segment
+ */
+type Mode int
+
+const (
+	DISTINCT Mode = iota
+	RANDOM
+	GRAPH
+)
+
+var modeNames = map[Mode]string{
+	DISTINCT: "distinct",
+	RANDOM:   "random",
+	GRAPH:    "graph",
+}
+
+/**
+ * Hue step in degrees of the distinct colors: 360 divided by the golden
+ * ratio squared
+ */
+const GOLDEN_ANGLE = 137.50776405003785
+
+/**
+ * Minimum number of colors that graph palettes generate
+ */
+const GRAPH_COLORS = 12
+
+/**
+ * Lightness levels of the distinct colors, used in turn so that colors with
+ * similar hues differ in lightness
+ */
+var lightnesses = []float64{65, 50, 80}
+
+/**
+ * Chroma of the distinct colors before fitting them in the sRGB gamut
+ */
+const CHROMA = 60
+
+func (mode Mode) String() string {
+	if name, ok := modeNames[mode]; ok {
+		return name
+	}
+	return fmt.Sprintf("Mode(%d)", int(mode))
+}
+
+/**
+ * Returns the mode with the given name: distinct, random or graph
+ */
+func Parse(name string) (Mode, error) {
+	for mode, modeName := range modeNames {
+		if modeName == name {
+			return mode, nil
+		}
+	}
+	return DISTINCT, fmt.Errorf("unknown palette %q", name)
+}
+
+/**
+ * Returns the colors of a comma separated list of hexadecimal colors like
+ * "#e41a1c,#377eb8,#4daf4a"
+ */
+func ParseColors(list string) ([]color.RGBA, error) {
+	var colors []color.RGBA
+	for _, hex := range strings.Split(list, ",") {
+		clr, err := colorspace.ParseHex(strings.TrimSpace(hex))
+		if err != nil {
+			return nil, err
+		}
+		colors = append(colors, clr)
+	}
+	return colors, nil
+}
+
+/**
+ * Chooses the colors of the segments of an image. Depending on its mode:
+ *  - DISTINCT: every segment gets its own color, with the hues spread by
+ *    the golden angle.
+ *  - RANDOM: every segment gets a uniformly random color.
+ *  - GRAPH: adjacent segments get distant colors, out of at least
+ *    GRAPH_COLORS distinct ones.
+ * If Colors isn't empty, they're assigned like GRAPH does whatever the mode
+ * is. The seed changes the generated colors.
+ */
+type Palette struct {
+	Mode   Mode
+	Seed   int64
+	Colors []color.RGBA
+}
+
+/**
+ * Returns true if Assign needs the adjacency of the segments
+ */
+func (palette Palette) UsesAdjacency() bool {
+	return palette.Mode == GRAPH || len(palette.Colors) > 0
+}
+
+/**
+ * Returns the colors of n segments indexed by segment id. adjacency has the
+ * ids of the neighbors of every segment; it's only used if UsesAdjacency
+ * returns true and it can be nil otherwise.
+ */
+func (palette Palette) Assign(n int, adjacency [][]int) []color.RGBA {
+	if !palette.UsesAdjacency() {
+		if palette.Mode == RANDOM {
+			return Random(n, palette.Seed)
+		}
+		return Distinct(n, palette.Seed)
+	}
+	colors := palette.Colors
+	if len(colors) == 0 {
+		maxDegree := 0
+		for _, neighbors := range adjacency {
+			if len(neighbors) > maxDegree {
+				maxDegree = len(neighbors)
+			}
+		}
+		/* Greedy coloring never needs more colors than the maximum degree + 1 */
+		size := GRAPH_COLORS
+		if maxDegree+1 > size {
+			size = maxDegree + 1
+		}
+		colors = Distinct(size, palette.Seed)
+	}
+	assigned := make([]color.RGBA, n, n)
+	for id, index := range ColorGraph(n, adjacency, colors) {
+		assigned[id] = colors[index]
+	}
+	return assigned
+}
+
+/**
+ * Returns n distinct colors. Their hues start at an angle chosen by the
+ * seed and advance by GOLDEN_ANGLE, their lightness cycles through a few
+ * levels and their chroma is the largest one up to CHROMA that is inside of
+ * the sRGB gamut.
+ */
+func Distinct(n int, seed int64) []color.RGBA {
+	start := rand.New(rand.NewSource(seed)).Float64() * 360
+	colors := make([]color.RGBA, n, n)
+	for i := range colors {
+		hue := (start + float64(i)*GOLDEN_ANGLE) * math.Pi / 180
+		lightness := lightnesses[i%len(lightnesses)]
+		for chroma := CHROMA; chroma >= 0; chroma -= 2 {
+			clr, inGamut := colorspace.FromLab(lightness, float64(chroma)*math.Cos(hue),
+				float64(chroma)*math.Sin(hue))
+			colors[i] = clr
+			if inGamut {
+				break
+			}
+		}
+	}
+	return colors
+}
+
+/**
+ * Returns n uniformly random colors generated from the seed
+ */
+func Random(n int, seed int64) []color.RGBA {
+	random := rand.New(rand.NewSource(seed))
+	colors := make([]color.RGBA, n, n)
+	for i := range colors {
+		colors[i] = color.RGBA{uint8(random.Intn(256)), uint8(random.Intn(256)),
+			uint8(random.Intn(256)), 255}
+	}
+	return colors
+}
+
+/**
+ * Colors the graph of n nodes with the given adjacency using the palette
+ * colors. Returns the index in colors of the color of every node.
+ *
+ * Nodes are colored greedily from the one with the most neighbors to the one
+ * with the least. Every node gets the color farthest in CIELAB from the
+ * colors of its already colored neighbors, or the least used one if none of
+ * them is colored yet, so adjacent nodes only share a color if there are
+ * fewer colors than neighbors.
+ */
+func ColorGraph(n int, adjacency [][]int, colors []color.RGBA) []int {
+	labs := make([][3]float64, len(colors), len(colors))
+	for i, clr := range colors {
+		labs[i] = colorspace.Convert(clr, colorspace.LAB)
+	}
+	degree := func(node int) int {
+		if node < len(adjacency) {
+			return len(adjacency[node])
+		}
+		return 0
+	}
+	order := make([]int, n, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return degree(order[i]) > degree(order[j])
+	})
+
+	assigned := make([]int, n, n)
+	for i := range assigned {
+		assigned[i] = -1
+	}
+	uses := make([]int, len(colors), len(colors))
+	for _, node := range order {
+		best, bestDistance := 0, -1.0
+		for c := range colors {
+			/* Without colored neighbors all the colors are equally far */
+			distance := math.Inf(1)
+			if node < len(adjacency) {
+				for _, neighbor := range adjacency[node] {
+					if assigned[neighbor] >= 0 {
+						distance = math.Min(distance, colorspace.Distance(labs[c],
+							labs[assigned[neighbor]], colorspace.LAB))
+					}
+				}
+			}
+			if distance > bestDistance || (distance == bestDistance && uses[c] < uses[best]) {
+				best, bestDistance = c, distance
+			}
+		}
+		assigned[node] = best
+		uses[best]++
+	}
+	return assigned
+}
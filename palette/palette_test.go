@@ -0,0 +1,108 @@
+package palette
+
+import (
+	"github.com/miguelfrde/image-segmentation/colorspace"
+	"github.com/stretchr/testify/assert"
+	"image/color"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+func labDistance(c1, c2 color.Color) float64 {
+	return colorspace.Distance(colorspace.Convert(c1, colorspace.LAB),
+		colorspace.Convert(c2, colorspace.LAB), colorspace.LAB)
+}
+
+/* Adjacency of a path of n nodes */
+func path(n int) [][]int {
+	adjacency := make([][]int, n, n)
+	for i := 0; i+1 < n; i++ {
+		adjacency[i] = append(adjacency[i], i+1)
+		adjacency[i+1] = append(adjacency[i+1], i)
+	}
+	return adjacency
+}
+
+/*
+ * Tests
+ */
+
+func TestParseModeNames(t *testing.T) {
+	for _, mode := range []Mode{DISTINCT, RANDOM, GRAPH} {
+		parsed, err := Parse(mode.String())
+		assert.Nil(t, err)
+		assert.Equal(t, mode, parsed)
+	}
+	_, err := Parse("rainbow")
+	assert.NotNil(t, err)
+}
+
+func TestParseColors(t *testing.T) {
+	colors, err := ParseColors("#ff0000, #00ff00,00f")
+	assert.Nil(t, err)
+	assert.Equal(t, []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}}, colors)
+	_, err = ParseColors("#ff0000,")
+	assert.NotNil(t, err)
+}
+
+func TestDistinctIsDeterministic(t *testing.T) {
+	assert.Equal(t, Distinct(50, 7), Distinct(50, 7))
+	assert.NotEqual(t, Distinct(50, 7), Distinct(50, 8))
+	assert.Equal(t, Random(50, 7), Random(50, 7))
+	assert.NotEqual(t, Random(50, 7), Random(50, 8))
+}
+
+func TestDistinctColorsAreDifferent(t *testing.T) {
+	colors := Distinct(12, 1)
+	for i := range colors {
+		for j := i + 1; j < len(colors); j++ {
+			assert.True(t, labDistance(colors[i], colors[j]) > 10, "%d and %d", i, j)
+		}
+		/* Consecutive colors are the most distant ones */
+		if i > 0 {
+			assert.True(t, labDistance(colors[i-1], colors[i]) > 30, "%d", i)
+		}
+	}
+}
+
+func TestColorGraphSeparatesNeighbors(t *testing.T) {
+	/* A star whose center touches every other node, which also form a path */
+	n := 8
+	adjacency := path(n)
+	for i := 1; i < n; i++ {
+		adjacency[0] = append(adjacency[0], i)
+		adjacency[i] = append(adjacency[i], 0)
+	}
+	colors := []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}}
+	assigned := ColorGraph(n, adjacency, colors)
+	for node, neighbors := range adjacency {
+		for _, neighbor := range neighbors {
+			assert.NotEqual(t, assigned[node], assigned[neighbor], "%d and %d", node, neighbor)
+		}
+	}
+}
+
+func TestColorGraphWithoutNeighborsSpreadsColors(t *testing.T) {
+	colors := []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}}
+	assert.Equal(t, []int{0, 1, 0, 1}, ColorGraph(4, nil, colors))
+}
+
+func TestAssign(t *testing.T) {
+	adjacency := path(30)
+	for _, palette := range []Palette{{Mode: GRAPH}, {Mode: DISTINCT, Colors: Random(4, 3)}} {
+		assert.True(t, palette.UsesAdjacency())
+		colors := palette.Assign(30, adjacency)
+		assert.Equal(t, 30, len(colors))
+		assert.Equal(t, colors, palette.Assign(30, adjacency))
+		for i := 0; i+1 < 30; i++ {
+			assert.NotEqual(t, colors[i], colors[i+1])
+		}
+	}
+	palette := Palette{Mode: RANDOM, Seed: 5}
+	assert.False(t, palette.UsesAdjacency())
+	assert.Equal(t, Random(10, 5), palette.Assign(10, nil))
+	assert.Equal(t, Distinct(10, 0), Palette{}.Assign(10, nil))
+}
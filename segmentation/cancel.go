@@ -0,0 +1,89 @@
+package segmentation
+
+import (
+	"context"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"sort"
+)
+
+/**
+ * Error returned by the Context variants of the segmentation algorithms when
+ * their context is done before they finish. Phase is the phase that was
+ * running and Err the error of the context, so errors.Is(err,
+ * context.Canceled) and errors.Is(err, context.DeadlineExceeded) work.
+ */
+type CanceledError struct {
+	Phase string
+	Err   error
+}
+
+func (err *CanceledError) Error() string {
+	return "segmentation: canceled during phase " + err.Phase + ": " + err.Err.Error()
+}
+
+func (err *CanceledError) Unwrap() error {
+	return err.Err
+}
+
+/**
+ * Makes the segmentation that is about to run use ctx. Returns the function
+ * that must be deferred by the segmentation: it turns the cancellation of
+ * ctx into a *CanceledError stored in err and restores the context of the
+ * Segmenter, so that GetResultImage and friends can still be used.
+ * When a segmentation is canceled its partial result must be discarded.
+ */
+func (s *Segmenter) withContext(ctx context.Context) func(err *error) {
+	s.ctx = ctx
+	return func(err *error) {
+		s.ctx = context.Background()
+		r := recover()
+		if r == nil {
+			return
+		}
+		canceled, ok := r.(*CanceledError)
+		if !ok {
+			panic(r)
+		}
+		if s.running.span != nil {
+			s.running.span.End()
+			s.running = runningPhase{}
+		}
+		*err = canceled
+	}
+}
+
+/**
+ * Stops the running segmentation if its context is done. It can only be
+ * called from the goroutine that runs the segmentation.
+ */
+func (s *Segmenter) checkCanceled(phase string) {
+	if err := s.ctx.Err(); err != nil {
+		panic(&CanceledError{Phase: phase, Err: err})
+	}
+}
+
+/**
+ * EdgeList that checks if the segmentation was canceled every
+ * PROGRESS_INTERVAL comparisons, so that sorting big graphs can be stopped
+ */
+type cancelableEdges struct {
+	graph.EdgeList
+	s           *Segmenter
+	comparisons int
+}
+
+func (edges *cancelableEdges) Less(i, j int) bool {
+	edges.comparisons++
+	if edges.comparisons%PROGRESS_INTERVAL == 0 {
+		edges.s.checkCanceled(PHASE_SEGMENT)
+	}
+	return edges.EdgeList.Less(i, j)
+}
+
+/**
+ * Sorts the edges by increasing weight in place, checking for cancellation
+ * while sorting
+ */
+func (s *Segmenter) sortEdges(edges graph.EdgeList) {
+	sort.Sort(&cancelableEdges{EdgeList: edges, s: s})
+}
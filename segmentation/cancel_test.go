@@ -0,0 +1,140 @@
+package segmentation
+
+import (
+	"context"
+	"errors"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/miguelfrde/image-segmentation/tracing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+/*
+ * Helper functions
+ */
+
+/**
+ * Tracer that counts the spans that are started and ended
+ */
+type countingTracer struct {
+	started, ended int
+}
+
+type countingSpan struct {
+	tracer *countingTracer
+}
+
+func (tracer *countingTracer) Start(name string) tracing.Span {
+	tracer.started++
+	return countingSpan{tracer}
+}
+
+func (span countingSpan) End() {
+	span.tracer.ended++
+}
+
+/**
+ * Runs every Context variant of the segmenter with ctx and returns their
+ * errors by name. Sigma is always 0 because every segmentation smooths the
+ * image left by the previous one and a 0 sigma leaves it as it is.
+ */
+func runAllContext(ctx context.Context, s *Segmenter) map[string]error {
+	width, height := s.img.Bounds().Dx(), s.img.Bounds().Dy()
+	errs := make(map[string]error)
+	_, errs["gbs"] = s.SegmentGBSContext(ctx, 0, 300, 20)
+	_, errs["seeded"] = s.SegmentSeededContext(ctx, 0, 300, 20, randomMarkers(width, height, 4, 1))
+	_, errs["hmsf"] = s.SegmentHMSFContext(ctx, 0, 6)
+	_, errs["phmsf"] = s.SegmentPHMSFContext(ctx, 0, 6)
+	_, errs["slic"] = s.SegmentSLICContext(ctx, 20, 10)
+	_, errs["watershed"] = s.SegmentWatershedContext(ctx, randomMarkers(width, height, 4, 2))
+	_, _, errs["gbs to count"] = s.SegmentGBSToCountContext(ctx, 0, 20, 5, 10)
+	_, _, errs["hmsf to count"] = s.SegmentHMSFToCountContext(ctx, 0, 3, 6)
+	_, _, errs["phmsf to count"] = s.SegmentPHMSFToCountContext(ctx, 0, 3, 6)
+	_, errs["gbs sweep"] = s.SweepGBSContext(ctx, []float64{0}, []float64{300}, []int{20})
+	_, errs["hmsf sweep"] = s.SweepHMSFContext(ctx, []float64{0}, []float64{6})
+	_, errs["phmsf sweep"] = s.SweepPHMSFContext(ctx, []float64{0}, []float64{6})
+	_, errs["slic sweep"] = s.SweepSLICContext(ctx, []int{20}, []float64{10})
+	s.SegmentGBS(0, 300, 20)
+	_, errs["merge"] = s.MergeRegionsContext(ctx, MergeToCount(2))
+	return errs
+}
+
+/**
+ * Asserts that the segmenter gives the same results as a new one
+ */
+func assertUsable(t *testing.T, s *Segmenter, fresh func() *Segmenter) {
+	assert.Equal(t, context.Background(), s.ctx)
+	other := fresh()
+	labels, err := s.SegmentGBSContext(context.Background(), 0, 300, 20)
+	assert.Nil(t, err)
+	assert.Equal(t, other.SegmentGBS(0, 300, 20), labels)
+	assert.Equal(t, other.GetResultImage(), s.GetResultImage())
+	assert.Equal(t, other.SegmentHMSF(0, 6), s.SegmentHMSF(0, 6))
+}
+
+/*
+ * Tests
+ */
+
+func TestCanceledContextReturnsCanceledError(t *testing.T) {
+	fresh := func() *Segmenter {
+		return New(noisyBlocksImage(30, 20, 20), graph.KINGSGRAPH, ColorDistance)
+	}
+	s := fresh()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for name, err := range runAllContext(ctx, s) {
+		var canceled *CanceledError
+		assert.True(t, errors.As(err, &canceled), "%s: %v", name, err)
+		assert.True(t, errors.Is(err, context.Canceled), name)
+		assertUsable(t, s, fresh)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	for name, err := range runAllContext(ctx, s) {
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), name)
+	}
+	assertUsable(t, s, fresh)
+}
+
+func TestCancelDuringAPhase(t *testing.T) {
+	/* The sort of the edges checks the context every PROGRESS_INTERVAL comparisons */
+	fresh := func() *Segmenter {
+		return New(noisyBlocksImage(200, 150, 21), graph.KINGSGRAPH, ColorDistance)
+	}
+	tracer := &countingTracer{}
+	s := New(noisyBlocksImage(200, 150, 21), graph.KINGSGRAPH, ColorDistance, WithTracer(tracer))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.SetProgress(func(phase string, fraction float64) {
+		if phase == PHASE_SEGMENT {
+			cancel()
+		}
+	})
+	labels, err := s.SegmentGBSContext(ctx, 0, 300, 20)
+	assert.Nil(t, labels)
+	canceled, ok := err.(*CanceledError)
+	assert.True(t, ok, "%v", err)
+	assert.Equal(t, PHASE_SEGMENT, canceled.Phase)
+	assert.Equal(t, context.Canceled, canceled.Err)
+	/* The span of the canceled phase is ended too */
+	assert.Equal(t, tracer.started, tracer.ended)
+
+	s.SetProgress(nil)
+	assertUsable(t, s, fresh)
+}
+
+func TestWithContextOnlyRecoversCancellations(t *testing.T) {
+	s := New(noisyBlocksImage(8, 8, 22), graph.GRIDGRAPH, ColorDistance)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.PanicsWithValue(t, "bug", func() {
+		var err error
+		defer s.withContext(ctx)(&err)
+		panic("bug")
+	})
+	/* The context is restored even if the panic goes on */
+	assert.Equal(t, context.Background(), s.ctx)
+}
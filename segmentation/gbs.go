@@ -1,11 +1,9 @@
 package segmentation
 
 import (
-	"fmt"
+	"context"
 	"github.com/miguelfrde/image-segmentation/disjointset"
 	"github.com/miguelfrde/image-segmentation/graph"
-	"sort"
-	"time"
 )
 
 /**
@@ -15,27 +13,46 @@ import (
  * k and minSize are the algorithm parameters. For more information on this
  * algorithm refer to either my report which link is on the repo's README or
  * to: http://cs.brown.edu/~pff/papers/seg-ijcv.pdf
+ * Returns the label map of the resulting segmentation.
  */
-func (s *Segmenter) SegmentGBS(sigma, k float64, minSize int) {
+func (s *Segmenter) SegmentGBS(sigma, k float64, minSize int) *Labels {
+	labels, _ := s.SegmentGBSContext(context.Background(), sigma, k, minSize)
+	return labels
+}
+
+/**
+ * Same as SegmentGBS but it stops as soon as ctx is done, in which case it
+ * returns a *CanceledError.
+ */
+func (s *Segmenter) SegmentGBSContext(ctx context.Context, sigma, k float64,
+	minSize int) (labels *Labels, err error) {
+	defer s.withContext(ctx)(&err)
 	s.smoothImage(sigma)
 	s.buildGraph()
-	fmt.Printf("segment... ")
-	start := time.Now()
-	s.resultset = disjointset.New(s.graph.TotalVertices())
+	start := s.beginPhase(PHASE_SEGMENT)
+	edges := s.graph.Edges()
+	s.sortEdges(edges)
+	s.gbsSegment(edges, k, minSize)
+	s.endPhase(PHASE_SEGMENT, start)
+	s.logResult("gbs")
+	return s.GetLabels(), nil
+}
+
+/**
+ * Runs GBS on the given edges, which must be sorted by weight, and leaves
+ * the result in the result set
+ */
+func (s *Segmenter) gbsSegment(edges graph.EdgeList, k float64, minSize int) {
+	s.newResultSet()
 	threshold_vals := make([]float64, s.graph.TotalVertices(), s.graph.TotalVertices())
 
 	for v := 0; v < s.graph.TotalVertices(); v++ {
 		threshold_vals[v] = k
 	}
 
-	edges := s.graph.Edges()
-	sort.Sort(edges)
-
 	s.gbsMergeFromThreshold(edges, threshold_vals, k)
 	s.gbsMergeSmallRegions(edges, minSize)
-
-	fmt.Println(time.Since(start))
-	fmt.Println("Components:", s.resultset.Components())
+	s.completeHierarchy(edges)
 }
 
 /**
@@ -51,13 +68,14 @@ func threshold(set *disjointset.DisjointSet, k float64, u int) float64 {
  * edge's weight is less than the thresholds of both regions.
  */
 func (s *Segmenter) gbsMergeFromThreshold(edges graph.EdgeList, thresholds []float64, k float64) {
-	for _, edge := range edges {
+	for i, edge := range edges {
+		s.loopProgress(PHASE_SEGMENT, i, len(edges), 0, 0.8)
 		u := s.resultset.Find(edge.U())
 		v := s.resultset.Find(edge.V())
 		uok := edge.Weight() <= thresholds[u]
 		vok := edge.Weight() <= thresholds[v]
 		if !s.resultset.Connected(u, v) && uok && vok {
-			s.resultset.Union(u, v)
+			s.union(u, v, edge.Weight())
 			new_threshold := edge.Weight() + threshold(s.resultset, k, s.resultset.Find(u))
 			thresholds[s.resultset.Find(u)] = new_threshold
 		}
@@ -70,11 +88,104 @@ func (s *Segmenter) gbsMergeFromThreshold(edges graph.EdgeList, thresholds []flo
  * any of these regions is less than the minimum size for all regions.
  */
 func (s *Segmenter) gbsMergeSmallRegions(edges graph.EdgeList, minSize int) {
-	for _, edge := range edges {
+	for i, edge := range edges {
+		s.loopProgress(PHASE_SEGMENT, i, len(edges), 0.8, 1)
+		u := s.resultset.Find(edge.U())
+		v := s.resultset.Find(edge.V())
+		if u != v && (s.resultset.Size(u) < minSize || s.resultset.Size(v) < minSize) {
+			s.union(u, v, edge.Weight())
+		}
+	}
+}
+
+/**
+ * Performs an interactive GBS segmentation constrained by the given seeds.
+ * seeds is a marker map (usually painted by the user as scribbles) where
+ * each marker is a different object. Pixels with different seeds will never
+ * end up in the same segment, the rest of the graph is merged as in
+ * SegmentGBS. If seeds is nil no pixel is seeded and the result is the one
+ * of SegmentGBS. Returns the label map of the resulting segmentation, or nil
+ * if the marker map doesn't have the size of the image.
+ */
+func (s *Segmenter) SegmentSeeded(sigma, k float64, minSize int, seeds *Labels) *Labels {
+	labels, _ := s.SegmentSeededContext(context.Background(), sigma, k, minSize, seeds)
+	return labels
+}
+
+/**
+ * Same as SegmentSeeded but it stops as soon as ctx is done, in which case it
+ * returns a *CanceledError. Returns an error if the marker map doesn't have
+ * the size of the image.
+ */
+func (s *Segmenter) SegmentSeededContext(ctx context.Context, sigma, k float64, minSize int,
+	seeds *Labels) (labels *Labels, err error) {
+	if seeds != nil {
+		bounds := s.img.Bounds()
+		if err := seeds.checkSize("seeds", bounds.Max.X, bounds.Max.Y); err != nil {
+			return nil, err
+		}
+	}
+	defer s.withContext(ctx)(&err)
+	s.smoothImage(sigma)
+	s.buildGraph()
+	start := s.beginPhase(PHASE_SEGMENT)
+	s.newResultSet()
+	threshold_vals := make([]float64, s.graph.TotalVertices(), s.graph.TotalVertices())
+	seed_vals := make([]int, s.graph.TotalVertices(), s.graph.TotalVertices())
+	if seeds != nil {
+		copy(seed_vals, seeds.Ids)
+	} else {
+		for v := range seed_vals {
+			seed_vals[v] = UNLABELED
+		}
+	}
+
+	for v := 0; v < s.graph.TotalVertices(); v++ {
+		threshold_vals[v] = k
+	}
+
+	edges := s.graph.Edges()
+	s.sortEdges(edges)
+
+	s.gbsSeededMergeFromThreshold(edges, threshold_vals, seed_vals, k)
+	s.gbsSeededMergeSmallRegions(edges, seed_vals, minSize)
+	s.completeHierarchy(edges)
+
+	s.endPhase(PHASE_SEGMENT, start)
+	s.logResult("seeded")
+	return s.GetLabels(), nil
+}
+
+/**
+ * Same as gbsMergeFromThreshold but regions that contain different seeds
+ * are never merged.
+ */
+func (s *Segmenter) gbsSeededMergeFromThreshold(edges graph.EdgeList, thresholds []float64,
+	seeds []int, k float64) {
+	for i, edge := range edges {
+		s.loopProgress(PHASE_SEGMENT, i, len(edges), 0, 0.8)
+		u := s.resultset.Find(edge.U())
+		v := s.resultset.Find(edge.V())
+		uok := edge.Weight() <= thresholds[u]
+		vok := edge.Weight() <= thresholds[v]
+		if uok && vok && s.seededUnion(seeds, u, v, edge.Weight()) {
+			new_threshold := edge.Weight() + threshold(s.resultset, k, s.resultset.Find(u))
+			thresholds[s.resultset.Find(u)] = new_threshold
+		}
+	}
+}
+
+/**
+ * Same as gbsMergeSmallRegions but regions that contain different seeds
+ * are never merged.
+ */
+func (s *Segmenter) gbsSeededMergeSmallRegions(edges graph.EdgeList, seeds []int, minSize int) {
+	for i, edge := range edges {
+		s.loopProgress(PHASE_SEGMENT, i, len(edges), 0.8, 1)
 		u := s.resultset.Find(edge.U())
 		v := s.resultset.Find(edge.V())
 		if u != v && (s.resultset.Size(u) < minSize || s.resultset.Size(v) < minSize) {
-			s.resultset.Union(u, v)
+			s.seededUnion(seeds, u, v, edge.Weight())
 		}
 	}
 }
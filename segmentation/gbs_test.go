@@ -0,0 +1,86 @@
+package segmentation
+
+import (
+	"context"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"math/rand"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+/**
+ * Returns a width x height marker map with n markers on random pixels
+ */
+func randomMarkers(width, height, n int, seed int64) *Labels {
+	random := rand.New(rand.NewSource(seed))
+	markers := emptyMarkers(width, height)
+	for id := 0; id < n; id++ {
+		markers.Ids[random.Intn(width*height)] = id
+	}
+	markers.Count = n
+	return markers
+}
+
+/**
+ * Asserts that no segment of labels holds pixels of different markers
+ */
+func assertSeparatesMarkers(t *testing.T, labels, markers *Labels) {
+	markerOf := make(map[int]int)
+	for p, marker := range markers.Ids {
+		if marker == UNLABELED {
+			continue
+		}
+		if other, ok := markerOf[labels.Ids[p]]; ok {
+			assert.Equal(t, other, marker, "segment %d", labels.Ids[p])
+		}
+		markerOf[labels.Ids[p]] = marker
+	}
+}
+
+/*
+ * Tests
+ */
+
+func TestSeededGBSNeverMergesDifferentSeeds(t *testing.T) {
+	/* Huge k and minSize would merge the whole image without the seeds */
+	img := image.NewGray(image.Rect(0, 0, 20, 10))
+	markers := randomMarkers(20, 10, 3, 1)
+	labels := New(img, graph.GRIDGRAPH, IntensityDifference).SegmentSeeded(0, 1e6, 1000, markers)
+	assert.Equal(t, 3, labels.Count)
+	assertSeparatesMarkers(t, labels, markers)
+
+	for seed := int64(0); seed < 5; seed++ {
+		img := noisyBlocksImage(30, 20, seed)
+		markers := randomMarkers(30, 20, 6, seed)
+		for _, k := range []float64{10, 300, 1e6} {
+			labels := New(img, graph.KINGSGRAPH, ColorDistance).SegmentSeeded(0.5, k, 20, markers)
+			assertSeparatesMarkers(t, labels, markers)
+		}
+	}
+}
+
+func TestSeededGBSWithoutSeedsEqualsGBS(t *testing.T) {
+	img := noisyBlocksImage(30, 20, 8)
+	seeded := New(img, graph.GRIDGRAPH, ColorDistance).SegmentSeeded(0.5, 300, 20,
+		emptyMarkers(30, 20))
+	assert.Equal(t, New(img, graph.GRIDGRAPH, ColorDistance).SegmentGBS(0.5, 300, 20), seeded)
+
+	/* nil seeds are the same as no seeds */
+	labels, err := New(img, graph.GRIDGRAPH, ColorDistance).SegmentSeededContext(
+		context.Background(), 0.5, 300, 20, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, seeded, labels)
+}
+
+func TestSeededGBSRejectsSeedsOfAnotherSize(t *testing.T) {
+	s := New(noisyBlocksImage(30, 20, 9), graph.GRIDGRAPH, ColorDistance)
+	labels, err := s.SegmentSeededContext(context.Background(), 0.5, 300, 20,
+		emptyMarkers(20, 30))
+	assert.Nil(t, labels)
+	assert.NotNil(t, err)
+}
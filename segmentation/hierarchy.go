@@ -0,0 +1,244 @@
+package segmentation
+
+import (
+	"github.com/miguelfrde/image-segmentation/disjointset"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"image"
+	"image/color"
+	"math"
+)
+
+/**
+ * A single union performed by a segmentation algorithm. U and V are pixels
+ * of the two regions that were merged, Weight is the weight of the edge that
+ * caused the merge and Level is the height of the merge in the hierarchy.
+ * Levels never decrease along the merge sequence, which makes the hierarchy
+ * an ultrametric even though the weights may not be sorted.
+ */
+type Merge struct {
+	U, V   int
+	Weight float64
+	Level  float64
+}
+
+/**
+ * Complete merge tree (dendrogram) of a segmentation. It stores every union
+ * in the order in which the algorithm performed them, so any finer partition
+ * can be extracted without running the algorithm again. The first Cut merges
+ * are the ones of the algorithm. The rest go beyond its result: they keep
+ * merging its regions along the lightest edges between them, as Kruskal's
+ * algorithm does, until a single region remains, so coarser partitions can
+ * be extracted too. Their levels are above the levels of the algorithm.
+ */
+type Hierarchy struct {
+	Width, Height int
+	Merges        []Merge
+	Cut           int
+}
+
+/**
+ * Returns a new empty hierarchy for an image of size width x height
+ */
+func newHierarchy(width, height int) *Hierarchy {
+	h := new(Hierarchy)
+	h.Width = width
+	h.Height = height
+	h.Merges = make([]Merge, 0, width*height)
+	return h
+}
+
+/**
+ * Appends the union of the regions of u and v caused by an edge with the
+ * given weight
+ */
+func (h *Hierarchy) record(u, v int, weight float64) {
+	level := weight
+	if n := len(h.Merges); n > 0 && h.Merges[n-1].Level > level {
+		level = h.Merges[n-1].Level
+	}
+	h.Merges = append(h.Merges, Merge{U: u, V: v, Weight: weight, Level: level})
+}
+
+/**
+ * Marks the end of the merges of the algorithm and merges the rest of the
+ * regions along the given edges, which must be sorted by weight, until a
+ * single region remains or no edge joins the remaining ones
+ */
+func (h *Hierarchy) complete(edges graph.EdgeList) {
+	h.Cut = len(h.Merges)
+	set := disjointset.New(h.Width * h.Height)
+	for _, merge := range h.Merges {
+		set.Union(merge.U, merge.V)
+	}
+	floor := math.Inf(-1)
+	if h.Cut > 0 {
+		floor = math.Nextafter(h.Merges[h.Cut-1].Level, math.Inf(1))
+	}
+	for _, edge := range edges {
+		if set.Components() == 1 {
+			break
+		}
+		if set.Connected(edge.U(), edge.V()) {
+			continue
+		}
+		set.Union(edge.U(), edge.V())
+		h.record(edge.U(), edge.V(), edge.Weight())
+		if merge := &h.Merges[len(h.Merges)-1]; merge.Level < floor {
+			merge.Level = floor
+		}
+	}
+}
+
+/**
+ * Returns the partition obtained by replaying the first n merges
+ */
+func (h *Hierarchy) replay(n int) *Labels {
+	set := disjointset.New(h.Width * h.Height)
+	for _, merge := range h.Merges[:n] {
+		set.Union(merge.U, merge.V)
+	}
+	return LabelsFromDisjointSet(set, h.Width, h.Height)
+}
+
+/**
+ * Returns the label map that results from performing only the merges whose
+ * level is less than or equal to threshold
+ */
+func (h *Hierarchy) LabelsAtLevel(threshold float64) *Labels {
+	n := 0
+	for n < len(h.Merges) && h.Merges[n].Level <= threshold {
+		n++
+	}
+	return h.replay(n)
+}
+
+/**
+ * Returns the label map with the given number of segments. If the number is
+ * smaller than the number of segments of the coarsest partition, which is a
+ * single segment unless the graph isn't connected, that one is returned.
+ */
+func (h *Hierarchy) LabelsForCount(segments int) *Labels {
+	n := h.Width*h.Height - segments
+	if n < 0 {
+		n = 0
+	} else if n > len(h.Merges) {
+		n = len(h.Merges)
+	}
+	return h.replay(n)
+}
+
+/**
+ * Returns the ultrametric contour map of the hierarchy. The intensity of
+ * each pixel is the level at which it was merged with its 4-connected
+ * neighbors, normalized to 0-255. Only the merges of the algorithm are
+ * drawn: boundaries of its final segmentation are white.
+ */
+func (h *Hierarchy) ContourMap() image.Image {
+	forest := newMergeForest(h.Width * h.Height)
+	for _, merge := range h.Merges[:h.Cut] {
+		forest.union(merge.U, merge.V)
+	}
+	maxLevel := 0.0
+	if h.Cut > 0 {
+		maxLevel = h.Merges[h.Cut-1].Level
+	}
+
+	strength := make([]float64, h.Width*h.Height, h.Width*h.Height)
+	setStrength := func(p, q int) {
+		value := 255.0
+		if i := forest.connectedAt(p, q); i >= 0 && maxLevel > 0 {
+			value = 254 * h.Merges[i].Level / maxLevel
+		} else if i >= 0 {
+			value = 0
+		}
+		strength[p] = math.Max(strength[p], value)
+		strength[q] = math.Max(strength[q], value)
+	}
+	for y := 0; y < h.Height; y++ {
+		for x := 0; x < h.Width; x++ {
+			p := x + y*h.Width
+			if x+1 < h.Width {
+				setStrength(p, p+1)
+			}
+			if y+1 < h.Height {
+				setStrength(p, p+h.Width)
+			}
+		}
+	}
+
+	contours := image.NewGray(image.Rect(0, 0, h.Width, h.Height))
+	for p, value := range strength {
+		contours.SetGray(p%h.Width, p/h.Width, color.Gray{uint8(value)})
+	}
+	return contours
+}
+
+/**
+ * Union-find forest without path compression where each node remembers the
+ * index of the merge that attached it to its parent. Since it uses union by
+ * rank its height is logarithmic, so it can answer in O(log n) at which merge
+ * two elements got connected.
+ */
+type mergeForest struct {
+	parent, rank, time []int
+	merges             int
+}
+
+func newMergeForest(size int) *mergeForest {
+	forest := &mergeForest{parent: make([]int, size), rank: make([]int, size),
+		time: make([]int, size)}
+	for i := range forest.parent {
+		forest.parent[i] = i
+	}
+	return forest
+}
+
+func (forest *mergeForest) root(p int) int {
+	for forest.parent[p] != p {
+		p = forest.parent[p]
+	}
+	return p
+}
+
+func (forest *mergeForest) union(p, q int) {
+	i, j := forest.root(p), forest.root(q)
+	if i == j {
+		return
+	}
+	if forest.rank[i] < forest.rank[j] {
+		i, j = j, i
+	}
+	forest.parent[j] = i
+	forest.time[j] = forest.merges
+	if forest.rank[i] == forest.rank[j] {
+		forest.rank[i]++
+	}
+	forest.merges++
+}
+
+/**
+ * Returns the index of the merge that connected p and q, or -1 if they
+ * were never connected
+ */
+func (forest *mergeForest) connectedAt(p, q int) int {
+	if forest.root(p) != forest.root(q) {
+		return -1
+	}
+	attached := func(v int) int {
+		if forest.parent[v] == v {
+			return math.MaxInt32
+		}
+		return forest.time[v]
+	}
+	at := -1
+	for p != q {
+		if attached(p) > attached(q) {
+			p, q = q, p
+		}
+		if forest.time[p] > at {
+			at = forest.time[p]
+		}
+		p = forest.parent[p]
+	}
+	return at
+}
@@ -0,0 +1,166 @@
+package segmentation
+
+import (
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"math"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+/**
+ * Standard deviation of the noise that makes the credit of every region
+ * negative, so that HMSF only merges the edges lighter than minWeight
+ */
+const NO_CREDIT_SIGMA = 1e9
+
+/**
+ * Returns a segmenter of img that records the hierarchy and has already
+ * built its graph, and the edges of the graph sorted by weight
+ */
+func hierarchySegmenter(img image.Image, graphType graph.GraphType) (*Segmenter, graph.EdgeList) {
+	s := New(img, graphType, IntensityDifference)
+	s.SetRecordHierarchy(true)
+	s.buildGraph()
+	edges := make(graph.EdgeList, len(s.graph.Edges()))
+	copy(edges, s.graph.Edges())
+	s.sortEdges(edges)
+	return s, edges
+}
+
+/**
+ * Returns true if any 4-connected neighbor of the pixel p is in another
+ * segment
+ */
+func touchesOtherSegment(labels *Labels, p int) bool {
+	x, y := p%labels.Width, p/labels.Width
+	return (x > 0 && labels.Ids[p-1] != labels.Ids[p]) ||
+		(x+1 < labels.Width && labels.Ids[p+1] != labels.Ids[p]) ||
+		(y > 0 && labels.Ids[p-labels.Width] != labels.Ids[p]) ||
+		(y+1 < labels.Height && labels.Ids[p+labels.Width] != labels.Ids[p])
+}
+
+/**
+ * Returns true if every segment of fine lies inside a single segment of
+ * coarse
+ */
+func refines(fine, coarse *Labels) bool {
+	segments := make(map[int]int)
+	for p, id := range fine.Ids {
+		if segment, ok := segments[id]; ok && segment != coarse.Ids[p] {
+			return false
+		}
+		segments[id] = coarse.Ids[p]
+	}
+	return true
+}
+
+/*
+ * Tests
+ */
+
+func TestLabelsAtLevelEqualsHMSF(t *testing.T) {
+	for _, graphType := range []graph.GraphType{graph.GRIDGRAPH, graph.KINGSGRAPH} {
+		s, edges := hierarchySegmenter(noisyBlocksImage(30, 20, 10), graphType)
+		s.hmsfSegment(edges, math.Inf(1), NO_CREDIT_SIGMA)
+		hierarchy := s.GetHierarchy()
+		assert.Equal(t, 1, hierarchy.LabelsAtLevel(math.Inf(1)).Count)
+
+		for _, level := range []float64{0, 2, 5, 9.5, 30, 200} {
+			/* HMSF merges the edges lighter than minWeight and the hierarchy up to level */
+			s.hmsfSegment(edges, math.Nextafter(level, math.Inf(1)), NO_CREDIT_SIGMA)
+			assert.Equal(t, s.GetLabels(), hierarchy.LabelsAtLevel(level), "level %v", level)
+		}
+	}
+}
+
+func TestHierarchyOfAFullSegmentation(t *testing.T) {
+	s := New(noisyBlocksImage(30, 20, 11), graph.KINGSGRAPH, IntensityDifference)
+	s.SetRecordHierarchy(true)
+	labels := s.SegmentHMSF(0.5, 6)
+	hierarchy := s.GetHierarchy()
+	assert.True(t, labels.Count > 2)
+	assert.Equal(t, 30*20-labels.Count, hierarchy.Cut)
+	assert.Equal(t, 30*20-1, len(hierarchy.Merges))
+	assert.Equal(t, labels, hierarchy.LabelsAtLevel(hierarchy.Merges[hierarchy.Cut-1].Level))
+	assert.Equal(t, labels, hierarchy.LabelsForCount(labels.Count))
+	assert.Equal(t, 1, hierarchy.LabelsAtLevel(math.Inf(1)).Count)
+	assert.Equal(t, 1, hierarchy.LabelsForCount(0).Count)
+	assert.Equal(t, 30*20, hierarchy.LabelsForCount(30*20).Count)
+	for _, count := range []int{labels.Count + 1, labels.Count + 10, 100} {
+		assert.Equal(t, count, hierarchy.LabelsForCount(count).Count)
+		assert.True(t, refines(hierarchy.LabelsForCount(count), labels))
+	}
+	/* Coarser partitions merge the segments of the result */
+	for _, count := range []int{labels.Count - 1, 2, 1} {
+		assert.Equal(t, count, hierarchy.LabelsForCount(count).Count)
+		assert.True(t, refines(labels, hierarchy.LabelsForCount(count)))
+	}
+	for i := 1; i < len(hierarchy.Merges); i++ {
+		assert.True(t, hierarchy.Merges[i-1].Level <= hierarchy.Merges[i].Level)
+	}
+}
+
+func TestContourMapIsMonotone(t *testing.T) {
+	s := New(noisyBlocksImage(30, 20, 12), graph.GRIDGRAPH, IntensityDifference)
+	s.SetRecordHierarchy(true)
+	labels := s.SegmentHMSF(0.5, 6)
+	hierarchy := s.GetHierarchy()
+	contours := hierarchy.ContourMap().(*image.Gray)
+	maxLevel := hierarchy.Merges[hierarchy.Cut-1].Level
+
+	/* Pixels on the boundaries of a level are at least as bright as the level */
+	for _, fraction := range []float64{0, 0.1, 0.25, 0.5, 0.9, 1} {
+		level := fraction * maxLevel
+		cut := uint8(254 * level / maxLevel)
+		at := hierarchy.LabelsAtLevel(level)
+		for p, value := range contours.Pix {
+			if touchesOtherSegment(at, p) {
+				assert.True(t, value >= cut, "pixel %d at level %v", p, level)
+			} else {
+				assert.True(t, value <= cut, "pixel %d at level %v", p, level)
+			}
+		}
+	}
+	for p, value := range contours.Pix {
+		assert.Equal(t, touchesOtherSegment(labels, p), value == 255, "pixel %d", p)
+	}
+}
+
+func TestHierarchiesAreCompletedToASingleRegion(t *testing.T) {
+	img := noisyBlocksImage(30, 20, 13)
+	markers := randomMarkers(30, 20, 3, 14)
+	for name, segment := range map[string]func(s *Segmenter) *Labels{
+		"gbs":       func(s *Segmenter) *Labels { return s.SegmentGBS(0, 50, 5) },
+		"seeded":    func(s *Segmenter) *Labels { return s.SegmentSeeded(0, 50, 5, markers) },
+		"hmsf":      func(s *Segmenter) *Labels { return s.SegmentHMSF(0, 6) },
+		"phmsf":     func(s *Segmenter) *Labels { return s.SegmentPHMSF(0, 6) },
+		"watershed": func(s *Segmenter) *Labels { return s.SegmentWatershed(markers) },
+	} {
+		s := New(img, graph.GRIDGRAPH, IntensityDifference)
+		s.SetRecordHierarchy(true)
+		labels := segment(s)
+		hierarchy := s.GetHierarchy()
+		assert.Equal(t, 30*20-labels.Count, hierarchy.Cut, name)
+		assert.Equal(t, labels, hierarchy.LabelsForCount(labels.Count), name)
+		assert.Equal(t, 1, hierarchy.LabelsForCount(1).Count, name)
+		for i := hierarchy.Cut; i < len(hierarchy.Merges); i++ {
+			assert.True(t, hierarchy.Merges[i].Level > hierarchy.Merges[hierarchy.Cut-1].Level, name)
+		}
+	}
+}
+
+func TestMergeRegionsKeepsTheHierarchy(t *testing.T) {
+	s := New(noisyBlocksImage(30, 20, 15), graph.GRIDGRAPH, IntensityDifference)
+	s.SetRecordHierarchy(true)
+	labels := s.SegmentGBS(0, 50, 5)
+	merges := append([]Merge(nil), s.GetHierarchy().Merges...)
+	merged := s.MergeRegions(MergeToCount(2))
+	assert.Equal(t, 2, merged.Count)
+	assert.Equal(t, merges, s.GetHierarchy().Merges)
+	assert.Equal(t, labels, s.GetHierarchy().LabelsForCount(labels.Count))
+}
@@ -1,14 +1,12 @@
 package segmentation
 
 import (
-	"fmt"
+	"context"
 	"github.com/miguelfrde/image-segmentation/disjointset"
 	"github.com/miguelfrde/image-segmentation/graph"
 	"github.com/miguelfrde/image-segmentation/imagenoise"
 	"github.com/miguelfrde/image-segmentation/utils"
 	"math"
-	"sort"
-	"time"
 )
 
 /**
@@ -18,25 +16,59 @@ import (
  * For more information on this algorithm refer to either my report which link
  * is on the repo's README or to:
  * http://algo2.iti.kit.edu/wassenberg/wassenberg09parallelSegmentation.pdf
+ * Returns the label map of the resulting segmentation.
  */
-func (s *Segmenter) SegmentHMSF(sigmaSmooth, minWeight float64) {
-	start := time.Now()
-	sigma := imagenoise.EstimateStdev(s.img)
+func (s *Segmenter) SegmentHMSF(sigmaSmooth, minWeight float64) *Labels {
+	labels, _ := s.SegmentHMSFContext(context.Background(), sigmaSmooth, minWeight)
+	return labels
+}
+
+/**
+ * Same as SegmentHMSF but it stops as soon as ctx is done, in which case it
+ * returns a *CanceledError.
+ */
+func (s *Segmenter) SegmentHMSFContext(ctx context.Context, sigmaSmooth,
+	minWeight float64) (labels *Labels, err error) {
+	defer s.withContext(ctx)(&err)
+	sigma := s.estimateNoise()
 	s.smoothImage(sigmaSmooth)
 	s.buildGraph()
 
-	fmt.Printf("segment... ")
-	start = time.Now()
-	s.resultset = disjointset.New(s.graph.TotalVertices())
-
+	start := s.beginPhase(PHASE_SEGMENT)
 	edges := s.graph.Edges()
-	sort.Sort(edges)
+	s.sortEdges(edges)
+	s.hmsfSegment(edges, minWeight, sigma)
+	s.endPhase(PHASE_SEGMENT, start)
+	s.logResult("hmsf")
+	return s.GetLabels(), nil
+}
+
+/**
+ * Returns the estimated standard deviation of the noise of the image
+ */
+func (s *Segmenter) estimateNoise() float64 {
+	start := s.beginPhase(PHASE_NOISE)
+	sigma, err := imagenoise.EstimateStdevContext(s.ctx, s.img,
+		imagenoise.WithLogger(s.logger), imagenoise.WithTracer(s.tracer))
+	if err != nil {
+		panic(&CanceledError{Phase: PHASE_NOISE, Err: err})
+	}
+	s.endPhase(PHASE_NOISE, start)
+	return sigma
+}
+
+/**
+ * Runs HMSF on the given edges, which must be sorted by weight, with the
+ * given standard deviation of the noise and leaves the result in the result
+ * set
+ */
+func (s *Segmenter) hmsfSegment(edges graph.EdgeList, minWeight, sigma float64) {
+	s.newResultSet()
 	setll := s.hmsfMergeEdgesByWeight(edges, minWeight)
 	regionCredit := s.hmsfComputeCredit(setll, sigma)
 	s.hmsfMergeRegionsByCredit(edges, regionCredit)
 	regionCredit[0] = 1
-	fmt.Println(time.Since(start))
-	fmt.Println("Components:", s.resultset.Components())
+	s.completeHierarchy(edges)
 }
 
 /**
@@ -46,11 +78,12 @@ func (s *Segmenter) SegmentHMSF(sigmaSmooth, minWeight float64) {
 func (s *Segmenter) hmsfMergeEdgesByWeight(edges graph.EdgeList,
 	minWeight float64) *disjointset.DisjointSetLL {
 	setll := disjointset.NewDisjointSetLL(s.graph.TotalVertices())
-	for _, edge := range edges {
+	for i, edge := range edges {
+		s.loopProgress(PHASE_SEGMENT, i, len(edges), 0, 0.4)
 		u := s.resultset.Find(edge.U())
 		v := s.resultset.Find(edge.V())
 		if u != v && edge.Weight() < minWeight {
-			root := s.resultset.Union(u, v)
+			root := s.union(u, v, edge.Weight())
 			if root == u {
 				setll.Union(root, v)
 			} else {
@@ -106,13 +139,14 @@ func (s *Segmenter) hmfsMinWeights(setll *disjointset.DisjointSetLL) []float64 {
  * exceeds the weight of the edge connecting them.
  */
 func (s *Segmenter) hmsfMergeRegionsByCredit(edges graph.EdgeList, regionCredit []float64) {
-	for _, edge := range edges {
+	for i, edge := range edges {
+		s.loopProgress(PHASE_SEGMENT, i, len(edges), 0.6, 1)
 		u := s.resultset.Find(edge.U())
 		v := s.resultset.Find(edge.V())
 		if u != v {
 			credit := utils.MinF(regionCredit[u], regionCredit[v])
 			if credit > edge.Weight() {
-				s.resultset.Union(u, v)
+				s.union(u, v, edge.Weight())
 				survivor := s.resultset.Find(u)
 				regionCredit[survivor] = credit - edge.Weight()
 			}
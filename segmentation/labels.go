@@ -0,0 +1,154 @@
+package segmentation
+
+import (
+	"fmt"
+	"github.com/miguelfrde/image-segmentation/disjointset"
+	"sort"
+)
+
+/**
+ * Dense per-pixel segment map. Each pixel (x, y) is assigned the id of the
+ * segment it belongs to. Ids are compacted to the range 0..Count-1 and are
+ * given in order of first appearance when scanning the image row by row.
+ * When used as a marker map, pixels without a marker are UNLABELED.
+ */
+type Labels struct {
+	Width, Height int
+	Count         int
+	Ids           []int
+}
+
+/**
+ * Returns a new width x height label map where every pixel belongs to
+ * the segment 0
+ */
+func NewLabels(width, height int) *Labels {
+	labels := new(Labels)
+	labels.Width = width
+	labels.Height = height
+	labels.Ids = make([]int, width*height, width*height)
+	if width*height > 0 {
+		labels.Count = 1
+	}
+	return labels
+}
+
+/**
+ * Returns the label map that represents the partition stored in the given
+ * disjoint set for an image of size width x height, whose pixel (x, y) is
+ * the element x + y * width. It turns the result of any union-find based
+ * segmentation into the label map that NewRAG and the renderers take.
+ */
+func LabelsFromDisjointSet(set *disjointset.DisjointSet, width, height int) *Labels {
+	labels := NewLabels(width, height)
+	compact := make(map[int]int, set.Components())
+	for p := 0; p < width*height; p++ {
+		root := set.Find(p)
+		id, ok := compact[root]
+		if !ok {
+			id = len(compact)
+			compact[root] = id
+		}
+		labels.Ids[p] = id
+	}
+	labels.Count = len(compact)
+	return labels
+}
+
+/**
+ * Returns the id of the segment to which the pixel (x, y) belongs
+ */
+func (labels *Labels) At(x, y int) int {
+	return labels.Ids[x+y*labels.Width]
+}
+
+/**
+ * Returns an error if the label map isn't width x height or doesn't have an
+ * id for every pixel. name describes the label map in the error.
+ */
+func (labels *Labels) checkSize(name string, width, height int) error {
+	if labels.Width != width || labels.Height != height || len(labels.Ids) != width*height {
+		return &InvalidArgumentError{Argument: name, Message: fmt.Sprintf(
+			"the %s are %dx%d but the image is %dx%d", name, labels.Width, labels.Height,
+			width, height)}
+	}
+	return nil
+}
+
+/**
+ * Returns the number of pixels that each segment has, indexed by segment id.
+ * UNLABELED pixels are not counted.
+ */
+func (labels *Labels) Sizes() []int {
+	sizes := make([]int, labels.Count, labels.Count)
+	for _, id := range labels.Ids {
+		if id != UNLABELED {
+			sizes[id]++
+		}
+	}
+	return sizes
+}
+
+/**
+ * Returns the boundary map of the labels, indexed like Ids: a pixel is a
+ * boundary pixel if its right or bottom neighbor belongs to another segment.
+ * UNLABELED pixels are never boundaries.
+ */
+func (labels *Labels) Boundaries() []bool {
+	boundaries := make([]bool, len(labels.Ids), len(labels.Ids))
+	for y := 0; y < labels.Height; y++ {
+		for x := 0; x < labels.Width; x++ {
+			id := labels.At(x, y)
+			if id < 0 {
+				continue
+			}
+			if x+1 < labels.Width && labels.At(x+1, y) >= 0 && labels.At(x+1, y) != id {
+				boundaries[x+y*labels.Width] = true
+			}
+			if y+1 < labels.Height && labels.At(x, y+1) >= 0 && labels.At(x, y+1) != id {
+				boundaries[x+y*labels.Width] = true
+			}
+		}
+	}
+	return boundaries
+}
+
+/**
+ * Returns the ids of the neighbors of every segment, indexed by segment id
+ * and sorted. Two segments are neighbors if a pixel of one is above, below,
+ * left or right of a pixel of the other. UNLABELED pixels are ignored.
+ */
+func (labels *Labels) Adjacency() [][]int {
+	adjacent := make([]map[int]bool, labels.Count, labels.Count)
+	connect := func(a, b int) {
+		if a == b || a < 0 || b < 0 {
+			return
+		}
+		if adjacent[a] == nil {
+			adjacent[a] = make(map[int]bool)
+		}
+		if adjacent[b] == nil {
+			adjacent[b] = make(map[int]bool)
+		}
+		adjacent[a][b] = true
+		adjacent[b][a] = true
+	}
+	for y := 0; y < labels.Height; y++ {
+		for x := 0; x < labels.Width; x++ {
+			if x+1 < labels.Width {
+				connect(labels.At(x, y), labels.At(x+1, y))
+			}
+			if y+1 < labels.Height {
+				connect(labels.At(x, y), labels.At(x, y+1))
+			}
+		}
+	}
+	adjacency := make([][]int, labels.Count, labels.Count)
+	for id, neighbors := range adjacent {
+		for neighbor := range neighbors {
+			adjacency[id] = append(adjacency[id], neighbor)
+		}
+		sort.Ints(adjacency[id])
+	}
+	return adjacency
+}
@@ -0,0 +1,84 @@
+package segmentation
+
+import (
+	"github.com/miguelfrde/image-segmentation/disjointset"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+/**
+ * Returns the width x height label map with the given ids and count
+ */
+func labelsOf(width, height, count int, ids ...int) *Labels {
+	return &Labels{Width: width, Height: height, Count: count, Ids: ids}
+}
+
+/*
+ * Tests
+ */
+
+func TestNewLabels(t *testing.T) {
+	labels := NewLabels(3, 2)
+	assert.Equal(t, 1, labels.Count)
+	assert.Equal(t, []int{0, 0, 0, 0, 0, 0}, labels.Ids)
+	assert.Equal(t, 0, NewLabels(0, 0).Count)
+}
+
+func TestLabelsFromDisjointSetCompactsIds(t *testing.T) {
+	/*
+	 * 3x2 image partitioned as
+	 *   a b b
+	 *   c a b
+	 */
+	set := disjointset.New(6)
+	set.Union(4, 0)
+	set.Union(2, 1)
+	set.Union(5, 2)
+	labels := LabelsFromDisjointSet(set, 3, 2)
+	assert.Equal(t, 3, labels.Count)
+	assert.Equal(t, []int{0, 1, 1, 2, 0, 1}, labels.Ids)
+	assert.Equal(t, 2, labels.At(0, 1))
+}
+
+func TestLabelsSizesSkipUnlabeled(t *testing.T) {
+	labels := labelsOf(3, 2, 2,
+		0, 0, UNLABELED,
+		1, UNLABELED, 0)
+	assert.Equal(t, []int{3, 1}, labels.Sizes())
+}
+
+func TestLabelsBoundaries(t *testing.T) {
+	labels := labelsOf(3, 2, 2,
+		0, 0, 1,
+		0, 1, 1)
+	assert.Equal(t, []bool{
+		false, true, false,
+		true, false, false}, labels.Boundaries())
+}
+
+func TestLabelsBoundariesSkipUnlabeled(t *testing.T) {
+	labels := labelsOf(3, 2, 2,
+		0, UNLABELED, 1,
+		UNLABELED, 0, 1)
+	assert.Equal(t, []bool{
+		false, false, false,
+		false, true, false}, labels.Boundaries())
+}
+
+func TestLabelsAdjacency(t *testing.T) {
+	/* Segment 3 only touches 0 diagonally, which doesn't count */
+	labels := labelsOf(3, 3, 4,
+		0, 0, 1,
+		2, 0, 1,
+		3, 2, 1)
+	assert.Equal(t, [][]int{{1, 2}, {0, 2}, {0, 1, 3}, {2}}, labels.Adjacency())
+}
+
+func TestLabelsAdjacencySkipsUnlabeled(t *testing.T) {
+	labels := labelsOf(3, 1, 2, 0, UNLABELED, 1)
+	assert.Equal(t, [][]int{nil, nil}, labels.Adjacency())
+}
@@ -0,0 +1,277 @@
+package segmentation
+
+import (
+	"container/heap"
+	"context"
+	"math"
+)
+
+/**
+ * A region of the region merging stage. Mean stores the mean r, g and b
+ * values (0-255) of its pixels in the original image.
+ */
+type MergeRegion struct {
+	Size int
+	Mean [3]float64
+}
+
+/**
+ * Type of the functions that decide if two adjacent regions can be merged
+ * given their boundary in the region adjacency graph
+ */
+type MergePredicate func(a, b MergeRegion, boundary Boundary) bool
+
+/**
+ * Type of the functions that compute the cost of merging two adjacent
+ * regions. The cheapest pairs are merged first.
+ */
+type MergeCost func(a, b MergeRegion, boundary Boundary) float64
+
+/**
+ * Decides which regions the region merging stage merges and in which order.
+ * Adjacent regions are merged from the cheapest pair to the most expensive
+ * one while the predicate accepts them and, if there's a target, there are
+ * more segments than it.
+ */
+type MergeCriterion struct {
+	cost    MergeCost
+	accept  MergePredicate
+	maxCost float64
+	target  int
+}
+
+/**
+ * Merges the adjacent regions whose mean colors are at most threshold apart
+ */
+func MergeByColor(threshold float64) MergeCriterion {
+	return MergeCriterion{cost: colorCost, maxCost: threshold}
+}
+
+/**
+ * Merges the adjacent regions whose boundary has a mean weight of at most
+ * threshold
+ */
+func MergeByBoundary(threshold float64) MergeCriterion {
+	return MergeCriterion{cost: boundaryCost, maxCost: threshold}
+}
+
+/**
+ * Merges the adjacent regions with the closest mean colors until there
+ * are at most segments regions
+ */
+func MergeToCount(segments int) MergeCriterion {
+	return MergeCriterion{cost: colorCost, maxCost: math.Inf(1), target: segments}
+}
+
+/**
+ * Merges the adjacent regions accepted by the predicate, from the weakest
+ * boundary to the strongest one
+ */
+func MergeByPredicate(predicate MergePredicate) MergeCriterion {
+	return MergeCriterion{cost: boundaryCost, accept: predicate, maxCost: math.Inf(1)}
+}
+
+func colorCost(a, b MergeRegion, boundary Boundary) float64 {
+	d := 0.0
+	for c := range a.Mean {
+		d += (a.Mean[c] - b.Mean[c]) * (a.Mean[c] - b.Mean[c])
+	}
+	return math.Sqrt(d)
+}
+
+func boundaryCost(a, b MergeRegion, boundary Boundary) float64 {
+	return boundary.MeanWeight
+}
+
+/**
+ * Merges the regions of the last segmentation that the criterion selects.
+ * It works after any segmentation algorithm. The merge hierarchy isn't
+ * changed, since the costs of the criterion aren't edge weights.
+ * Returns the label map of the resulting segmentation or nil if no
+ * segmentation algorithm has been executed before.
+ */
+func (s *Segmenter) MergeRegions(criterion MergeCriterion) *Labels {
+	labels, _ := s.MergeRegionsContext(context.Background(), criterion)
+	return labels
+}
+
+/**
+ * Same as MergeRegions but it stops as soon as ctx is done, in which case it
+ * returns a *CanceledError and the last segmentation is partially merged.
+ */
+func (s *Segmenter) MergeRegionsContext(ctx context.Context,
+	criterion MergeCriterion) (labels *Labels, err error) {
+	defer s.withContext(ctx)(&err)
+	if s.resultset == nil {
+		return nil, nil
+	}
+	if s.graph == nil {
+		s.buildGraph()
+	}
+	start := s.beginPhase(PHASE_MERGE)
+	m := s.newRegionMerger(criterion)
+	for i := 0; m.queue.Len() > 0; i++ {
+		s.loopProgress(PHASE_MERGE, i, m.pushed, 0, 1)
+		if criterion.target > 0 && m.count <= criterion.target {
+			break
+		}
+		pair := heap.Pop(&m.queue).(mergePair)
+		if m.versions[pair.a] != pair.versionA || m.versions[pair.b] != pair.versionB {
+			continue
+		}
+		if pair.cost > criterion.maxCost {
+			break
+		}
+		boundary := *m.adjacency[pair.a][pair.b]
+		if criterion.accept != nil && !criterion.accept(m.regions[pair.a], m.regions[pair.b], boundary) {
+			continue
+		}
+		s.resultset.Union(m.pixels[pair.a], m.pixels[pair.b])
+		m.merge(pair.a, pair.b)
+	}
+	s.endPhase(PHASE_MERGE, start)
+	s.logger.Info("regions merged", "components", s.resultset.Components())
+	return s.GetLabels(), nil
+}
+
+/**
+ * A candidate merge of the regions a and b. The versions of the regions
+ * when it was computed tell if it's outdated.
+ */
+type mergePair struct {
+	a, b               int
+	versionA, versionB int
+	cost               float64
+}
+
+/**
+ * Min heap of candidate merges by cost
+ */
+type mergeQueue []mergePair
+
+func (q mergeQueue) Len() int            { return len(q) }
+func (q mergeQueue) Less(i, j int) bool  { return q[i].cost < q[j].cost }
+func (q mergeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *mergeQueue) Push(x interface{}) { *q = append(*q, x.(mergePair)) }
+func (q *mergeQueue) Pop() interface{} {
+	old := *q
+	pair := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return pair
+}
+
+/**
+ * State of the region merging stage. Regions are indexed by the ids of the
+ * labels of the segmentation, merged regions keep the id of one of them.
+ * pixels stores a pixel of every region, used to merge them in the result set.
+ */
+type regionMerger struct {
+	criterion MergeCriterion
+	regions   []MergeRegion
+	pixels    []int
+	versions  []int
+	adjacency []map[int]*Boundary
+	queue     mergeQueue
+	pushed    int
+	count     int
+}
+
+/**
+ * Returns the region merger of the last segmentation with all the adjacent
+ * regions as candidates
+ */
+func (s *Segmenter) newRegionMerger(criterion MergeCriterion) *regionMerger {
+	labels := s.GetLabels()
+	stats := ComputeRegionStats(labels, s.original, s.graph)
+	rag := NewRAG(labels, stats, s.graph)
+	m := &regionMerger{criterion: criterion, count: labels.Count}
+	m.regions = make([]MergeRegion, labels.Count, labels.Count)
+	m.pixels = make([]int, labels.Count, labels.Count)
+	m.versions = make([]int, labels.Count, labels.Count)
+	m.adjacency = make([]map[int]*Boundary, labels.Count, labels.Count)
+	for id := range m.adjacency {
+		m.adjacency[id] = make(map[int]*Boundary)
+		m.pixels[id] = -1
+	}
+
+	for p, id := range labels.Ids {
+		if m.pixels[id] < 0 {
+			m.pixels[id] = p
+		}
+	}
+	for id, region := range stats {
+		m.regions[id] = MergeRegion{Size: region.Area, Mean: region.Mean}
+	}
+
+	for _, boundary := range rag.Boundaries() {
+		b := boundary
+		m.adjacency[b.A][b.B] = &b
+		m.adjacency[b.B][b.A] = &b
+		m.push(b.A, b.B)
+	}
+	return m
+}
+
+/**
+ * Adds the merge of the adjacent regions a and b to the candidates
+ */
+func (m *regionMerger) push(a, b int) {
+	cost := m.criterion.cost(m.regions[a], m.regions[b], *m.adjacency[a][b])
+	heap.Push(&m.queue, mergePair{a: a, b: b, versionA: m.versions[a],
+		versionB: m.versions[b], cost: cost})
+	m.pushed++
+}
+
+/**
+ * Merges the region b into the adjacent region a, joining their boundaries
+ * with the rest of the regions, and adds the new candidates of a
+ */
+func (m *regionMerger) merge(a, b int) {
+	ra, rb := &m.regions[a], &m.regions[b]
+	size := float64(ra.Size + rb.Size)
+	for c := range ra.Mean {
+		ra.Mean[c] = (ra.Mean[c]*float64(ra.Size) + rb.Mean[c]*float64(rb.Size)) / size
+	}
+	ra.Size += rb.Size
+	m.versions[a]++
+	m.versions[b]++
+	m.count--
+
+	delete(m.adjacency[a], b)
+	for n, boundary := range m.adjacency[b] {
+		if n == a {
+			continue
+		}
+		delete(m.adjacency[n], b)
+		if existing, ok := m.adjacency[a][n]; ok {
+			joinBoundaries(existing, boundary)
+		} else {
+			m.adjacency[a][n] = boundary
+			m.adjacency[n][a] = boundary
+		}
+		m.adjacency[a][n].A, m.adjacency[a][n].B = minMax(a, n)
+	}
+	m.adjacency[b] = nil
+	for n := range m.adjacency[a] {
+		m.push(a, n)
+	}
+}
+
+/**
+ * Adds the edges of the boundary other to the boundary b
+ */
+func joinBoundaries(b, other *Boundary) {
+	length := b.Length + other.Length
+	b.MeanWeight = (b.MeanWeight*float64(b.Length) + other.MeanWeight*float64(other.Length)) /
+		float64(length)
+	b.Length = length
+	b.MinWeight = math.Min(b.MinWeight, other.MinWeight)
+	b.MaxWeight = math.Max(b.MaxWeight, other.MaxWeight)
+}
+
+func minMax(a, b int) (int, int) {
+	if a < b {
+		return a, b
+	}
+	return b, a
+}
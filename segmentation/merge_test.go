@@ -0,0 +1,138 @@
+package segmentation
+
+import (
+	"container/heap"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+/**
+ * Returns an image of flat 5x4 blocks side by side with the given gray values
+ */
+func blocksImage(values ...uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 5*len(values), 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 5*len(values); x++ {
+			img.SetGray(x, y, color.Gray{values[x/5]})
+		}
+	}
+	return img
+}
+
+/**
+ * Returns a segmenter of the image whose last segmentation has a segment for
+ * every flat block of blocksImage
+ */
+func blocksSegmenter(t *testing.T, values ...uint8) *Segmenter {
+	s := New(blocksImage(values...), graph.GRIDGRAPH, IntensityDifference)
+	assert.Equal(t, len(values), s.SegmentGBS(0, 1, 1).Count)
+	return s
+}
+
+/**
+ * Returns the segment of every block of the label map of blocksImage
+ */
+func blockIds(labels *Labels) []int {
+	ids := make([]int, labels.Width/5, labels.Width/5)
+	for i := range ids {
+		ids[i] = labels.At(5*i, 0)
+	}
+	return ids
+}
+
+/*
+ * Tests
+ */
+
+func TestMergeByColor(t *testing.T) {
+	/* Gray values d apart are d * sqrt(3) apart in RGB */
+	s := blocksSegmenter(t, 10, 20, 100, 112, 200)
+	labels := s.MergeRegions(MergeByColor(15 * math.Sqrt(3)))
+	assert.Equal(t, []int{0, 0, 1, 1, 2}, blockIds(labels))
+
+	s = blocksSegmenter(t, 10, 20, 100, 112, 200)
+	labels = s.MergeRegions(MergeByColor(5))
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, blockIds(labels))
+}
+
+func TestMergeByBoundary(t *testing.T) {
+	s := blocksSegmenter(t, 10, 20, 100, 112, 200)
+	labels := s.MergeRegions(MergeByBoundary(11))
+	assert.Equal(t, []int{0, 0, 1, 2, 3}, blockIds(labels))
+	labels = s.MergeRegions(MergeByBoundary(100))
+	assert.Equal(t, []int{0, 0, 0, 0, 0}, blockIds(labels))
+}
+
+func TestMergeToCountReachesTheCount(t *testing.T) {
+	img := noisyBlocksImage(40, 30, 13)
+	/* With the 4-connected grid merged regions are 4-connected too */
+	for _, segments := range []int{1, 2, 5, 17} {
+		s := New(img, graph.GRIDGRAPH, ColorDistance)
+		assert.True(t, s.SegmentSLIC(80, 10).Count > segments)
+		labels := s.MergeRegions(MergeToCount(segments))
+		assert.Equal(t, segments, labels.Count)
+		assert.Equal(t, segments, countComponents(labels))
+	}
+
+	s := New(img, graph.KINGSGRAPH, ColorDistance)
+	before := s.SegmentGBS(0.5, 300, 20)
+	assert.Equal(t, before, s.MergeRegions(MergeToCount(before.Count+5)))
+}
+
+func TestMergeByPredicate(t *testing.T) {
+	/* Regions grow from the weakest boundary until they have 2 blocks */
+	s := blocksSegmenter(t, 10, 22, 30, 100, 200, 205)
+	var sizes [][2]int
+	labels := s.MergeRegions(MergeByPredicate(func(a, b MergeRegion, boundary Boundary) bool {
+		sizes = append(sizes, [2]int{a.Size, b.Size})
+		return a.Size+b.Size <= 40
+	}))
+	assert.Equal(t, []int{0, 1, 1, 2, 3, 3}, blockIds(labels))
+	assert.Equal(t, [2]int{20, 20}, sizes[0])
+	assert.Contains(t, sizes, [2]int{40, 20})
+}
+
+func TestMergeSkipsStaleCandidates(t *testing.T) {
+	/*
+	 * Merging the first two blocks moves their mean to 4 so the cost of
+	 * merging the third block grows from 12 to 16, over the threshold of 14.
+	 * The candidate computed before the merge must not be used.
+	 */
+	s := blocksSegmenter(t, 0, 8, 20)
+	labels := s.MergeRegions(MergeByColor(14 * math.Sqrt(3)))
+	assert.Equal(t, []int{0, 0, 1}, blockIds(labels))
+}
+
+func TestRegionMergerVersions(t *testing.T) {
+	s := blocksSegmenter(t, 0, 8, 20, 40)
+	m := s.newRegionMerger(MergeByColor(math.Inf(1)))
+	assert.Equal(t, 3, m.queue.Len())
+	m.merge(0, 1)
+	assert.Equal(t, 3, m.count)
+	assert.Equal(t, MergeRegion{Size: 40, Mean: [3]float64{4, 4, 4}}, m.regions[0])
+	assert.Nil(t, m.adjacency[1])
+	assert.Contains(t, m.adjacency[2], 0)
+
+	stale := 0
+	for m.queue.Len() > 0 {
+		pair := heap.Pop(&m.queue).(mergePair)
+		if m.versions[pair.a] != pair.versionA || m.versions[pair.b] != pair.versionB {
+			stale++
+			continue
+		}
+		/* Current candidates never involve the merged region and have fresh costs */
+		assert.NotEqual(t, 1, pair.a)
+		assert.NotEqual(t, 1, pair.b)
+		assert.Equal(t, colorCost(m.regions[pair.a], m.regions[pair.b], Boundary{}), pair.cost)
+	}
+	/* (0, 1) and (1, 2) are outdated by the merge */
+	assert.Equal(t, 2, stale)
+}
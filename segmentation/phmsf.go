@@ -0,0 +1,305 @@
+package segmentation
+
+import (
+	"context"
+	"github.com/miguelfrde/image-segmentation/disjointset"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"math"
+	"runtime"
+	"sort"
+)
+
+/**
+ * Horizontal strip of the image processed by a single worker. It contains
+ * the rows [minY, maxY) and the edges whose first vertex lies on them.
+ */
+type tile struct {
+	minY, maxY int
+	edges      graph.EdgeList
+}
+
+/**
+ * Performs the image segmentation using the parallel version of the
+ * "Heuristic for Minimum Spanning Forests" algorithm. The image is split in
+ * horizontal strips that are processed concurrently by runtime.NumCPU()
+ * workers: each one sorts its edges and builds the minimum spanning forest
+ * of its strip, and then the forests are merged across the strip borders.
+ * The resulting segmentation is the same one that SegmentHMSF produces
+ * whatever the number of workers is. The recorded hierarchy is the minimum
+ * spanning forest of its segments, so it has the same cut as the one of
+ * SegmentHMSF but its levels may differ.
+ * Returns the label map of the resulting segmentation.
+ */
+func (s *Segmenter) SegmentPHMSF(sigmaSmooth, minWeight float64) *Labels {
+	labels, _ := s.SegmentPHMSFContext(context.Background(), sigmaSmooth, minWeight)
+	return labels
+}
+
+/**
+ * Same as SegmentPHMSF but it stops as soon as ctx is done, in which case it
+ * returns a *CanceledError.
+ */
+func (s *Segmenter) SegmentPHMSFContext(ctx context.Context, sigmaSmooth,
+	minWeight float64) (labels *Labels, err error) {
+	defer s.withContext(ctx)(&err)
+	sigma := s.estimateNoise()
+	s.smoothImage(sigmaSmooth)
+	s.buildGraph()
+
+	start := s.beginPhase(PHASE_SEGMENT)
+	s.phmsfRun(runtime.NumCPU(), minWeight, sigma)
+	s.endPhase(PHASE_SEGMENT, start)
+	s.logResult("phmsf")
+	return s.GetLabels(), nil
+}
+
+/**
+ * Runs PHMSF on the graph split in the tiles of the given number of workers
+ * and leaves the result in the result set
+ */
+func (s *Segmenter) phmsfRun(workers int, minWeight, sigma float64) {
+	tiles := s.phmsfTiles(workers)
+	edges := sortTiles(tiles)
+	s.phmsfSegment(tiles, edges, minWeight, sigma)
+}
+
+/**
+ * Runs PHMSF on the given tiles, whose edges must be sorted by weight, and
+ * the merge of their sorted edges with the given standard deviation of the
+ * noise and leaves the result in the result set
+ */
+func (s *Segmenter) phmsfSegment(tiles []tile, edges graph.EdgeList, minWeight, sigma float64) {
+	s.newResultSet()
+	/* The tiles are merged out of weight order, the hierarchy is built at the end */
+	hierarchy := s.hierarchy
+	s.hierarchy = nil
+	s.checkCanceled(PHASE_SEGMENT)
+	s.phmsfMergeEdgesByWeight(tiles, minWeight)
+	s.checkCanceled(PHASE_SEGMENT)
+	regionCredit := s.phmsfComputeCredit(tiles, sigma)
+	s.hmsfMergeRegionsByCredit(edges, regionCredit)
+	if hierarchy != nil {
+		s.hierarchy = hierarchy
+		s.phmsfRecordForest(edges)
+		s.completeHierarchy(edges)
+	}
+}
+
+/**
+ * Records in the hierarchy the minimum spanning forest of the segments of
+ * the result set, taking the given edges in order of weight
+ */
+func (s *Segmenter) phmsfRecordForest(edges graph.EdgeList) {
+	forest := disjointset.New(s.graph.TotalVertices())
+	for _, edge := range edges {
+		u, v := edge.U(), edge.V()
+		if s.resultset.Connected(u, v) && !forest.Connected(u, v) {
+			forest.Union(u, v)
+			s.hierarchy.record(u, v, edge.Weight())
+		}
+	}
+}
+
+/**
+ * Splits the graph in at most n horizontal strips of similar height. Every
+ * strip gets a copy of the edges whose first vertex lies on its rows, in any
+ * order the graph stores them.
+ */
+func (s *Segmenter) phmsfTiles(n int) []tile {
+	width, height := s.graph.Width(), s.graph.Height()
+	if n > height {
+		n = height
+	}
+	if n < 1 {
+		n = 1
+	}
+	tiles := make([]tile, n, n)
+	/* Index of the tile of every row */
+	rows := make([]int, height, height)
+	for i := range tiles {
+		tiles[i].minY, tiles[i].maxY = i*height/n, (i+1)*height/n
+		for y := tiles[i].minY; y < tiles[i].maxY; y++ {
+			rows[y] = i
+		}
+	}
+	edges := s.graph.Edges()
+	for _, edge := range edges {
+		t := &tiles[rows[edge.U()/width]]
+		t.edges = append(t.edges, edge)
+	}
+	return tiles
+}
+
+/**
+ * Sorts the edges of every tile concurrently and returns all of them
+ * merged in a single sorted list.
+ */
+func sortTiles(tiles []tile) graph.EdgeList {
+	lists := make([]graph.EdgeList, len(tiles), len(tiles))
+	done := make(chan bool)
+	for i := range tiles {
+		go func(i int) {
+			sort.Sort(tiles[i].edges)
+			done <- true
+		}(i)
+	}
+	for i := range tiles {
+		<-done
+		lists[i] = tiles[i].edges
+	}
+	return mergeSortedEdges(lists)
+}
+
+/**
+ * Merges the given sorted edge lists pairwise in parallel until a single
+ * sorted list remains.
+ */
+func mergeSortedEdges(lists []graph.EdgeList) graph.EdgeList {
+	if len(lists) == 0 {
+		return graph.EdgeList{}
+	}
+	for len(lists) > 1 {
+		merged := make([]graph.EdgeList, (len(lists)+1)/2, (len(lists)+1)/2)
+		done := make(chan bool)
+		for i := 0; i+1 < len(lists); i += 2 {
+			go func(i int) {
+				merged[i/2] = mergeTwoEdgeLists(lists[i], lists[i+1])
+				done <- true
+			}(i)
+		}
+		for i := 0; i+1 < len(lists); i += 2 {
+			<-done
+		}
+		if len(lists)%2 == 1 {
+			merged[len(merged)-1] = lists[len(lists)-1]
+		}
+		lists = merged
+	}
+	return lists[0]
+}
+
+/**
+ * Returns the sorted list that contains the edges of the sorted lists a and b
+ */
+func mergeTwoEdgeLists(a, b graph.EdgeList) graph.EdgeList {
+	result := make(graph.EdgeList, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if b[j].Less(&a[i]) {
+			result = append(result, b[j])
+			j++
+		} else {
+			result = append(result, a[i])
+			i++
+		}
+	}
+	result = append(result, a[i:]...)
+	return append(result, b[j:]...)
+}
+
+/**
+ * Parallel version of the first part of the HMSF algorithm. Every worker
+ * computes the minimum spanning forest of the edges lighter than minWeight
+ * that lie inside its tile. Then those forests and the light edges that cross
+ * the tile borders are merged in the result set.
+ */
+func (s *Segmenter) phmsfMergeEdgesByWeight(tiles []tile, minWeight float64) {
+	width := s.graph.Width()
+	forests := make([]graph.EdgeList, len(tiles), len(tiles))
+	crossing := make([]graph.EdgeList, len(tiles), len(tiles))
+	done := make(chan bool)
+	for i := range tiles {
+		go func(i int) {
+			t := tiles[i]
+			offset := t.minY * width
+			local := disjointset.New((t.maxY - t.minY) * width)
+			for _, edge := range t.edges {
+				if edge.Weight() >= minWeight {
+					continue
+				}
+				u, v := edge.U()-offset, edge.V()-offset
+				if v < 0 || v >= local.TotalElements() {
+					crossing[i] = append(crossing[i], edge)
+				} else if !local.Connected(u, v) {
+					local.Union(u, v)
+					forests[i] = append(forests[i], edge)
+				}
+			}
+			done <- true
+		}(i)
+	}
+	for i := 0; i < len(tiles); i++ {
+		<-done
+	}
+	for i := range tiles {
+		for _, edge := range forests[i] {
+			s.union(edge.U(), edge.V(), edge.Weight())
+		}
+	}
+	for i := range tiles {
+		for _, edge := range crossing[i] {
+			s.union(edge.U(), edge.V(), edge.Weight())
+		}
+	}
+}
+
+/**
+ * Parallel version of hmsfComputeCredit. Every worker computes the minimum
+ * weight in the border of the regions using the edges of its tile and then
+ * the credit of the vertices of its tile.
+ */
+func (s *Segmenter) phmsfComputeCredit(tiles []tile, sigma float64) []float64 {
+	total := s.graph.TotalVertices()
+	roots := make([]int, total, total)
+	sizes := make([]int, total, total)
+	for v := 0; v < total; v++ {
+		roots[v] = s.resultset.Find(v)
+		sizes[v] = s.resultset.Size(v)
+	}
+
+	minWeights := make([]float64, total, total)
+	localMins := make([]map[int]float64, len(tiles), len(tiles))
+	done := make(chan bool)
+	for i := range tiles {
+		go func(i int) {
+			localMins[i] = make(map[int]float64)
+			for _, edge := range tiles[i].edges {
+				region := roots[edge.U()]
+				if roots[edge.V()] == region {
+					continue
+				}
+				if w, ok := localMins[i][region]; !ok || edge.Weight() < w {
+					localMins[i][region] = edge.Weight()
+				}
+			}
+			done <- true
+		}(i)
+	}
+	for v := range minWeights {
+		minWeights[v] = math.Inf(1)
+	}
+	for i := 0; i < len(tiles); i++ {
+		<-done
+	}
+	for i := range tiles {
+		for region, w := range localMins[i] {
+			minWeights[region] = math.Min(minWeights[region], w)
+		}
+	}
+
+	width := s.graph.Width()
+	regionCredit := make([]float64, total, total)
+	for i := range tiles {
+		go func(t tile) {
+			for v := t.minY * width; v < t.maxY*width; v++ {
+				contrast := minWeights[roots[v]] - 2*sigma
+				regionCredit[v] = contrast * math.Sqrt(4*math.Pi*float64(sizes[v]))
+			}
+			done <- true
+		}(tiles[i])
+	}
+	for i := 0; i < len(tiles); i++ {
+		<-done
+	}
+	return regionCredit
+}
@@ -0,0 +1,103 @@
+package segmentation
+
+import (
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+/**
+ * Returns a width x height image of four flat blocks plus noise. The noise is
+ * quantized so that many edges have the same weight.
+ */
+func noisyBlocksImage(width, height int, seed int64) *image.RGBA {
+	random := rand.New(rand.NewSource(seed))
+	blocks := []color.RGBA{{40, 40, 40, 255}, {200, 60, 60, 255}, {60, 200, 60, 255},
+		{60, 60, 200, 255}}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			block := blocks[2*(2*y/height)+2*x/width]
+			noise := uint8(4 * random.Intn(6))
+			img.SetRGBA(x, y, color.RGBA{block.R + noise, block.G + noise, block.B + noise, 255})
+		}
+	}
+	return img
+}
+
+/*
+ * Tests
+ */
+
+func TestPHMSFEqualsHMSF(t *testing.T) {
+	graphs := map[string]graph.GraphType{
+		"grid":    graph.GRIDGRAPH,
+		"kings":   graph.KINGSGRAPH,
+		"24":      graph.GRAPH24,
+		"disk":    graph.DiskGraph(2.5),
+		"nearest": graph.NNGRAPH,
+	}
+	images := []image.Image{noisyBlocksImage(24, 17, 1), noisyBlocksImage(9, 31, 2),
+		noisyBlocksImage(40, 5, 3)}
+	for name, graphType := range graphs {
+		weightfn := IntensityDifference
+		if graphType == graph.NNGRAPH {
+			weightfn = NNWeight
+		}
+		for i, img := range images {
+			for _, minWeight := range []float64{1, 6, 30} {
+				s := New(img, graphType, weightfn)
+				s.buildGraph()
+				sigma := s.estimateNoise()
+				edges := make(graph.EdgeList, len(s.graph.Edges()))
+				copy(edges, s.graph.Edges())
+				s.sortEdges(edges)
+				s.hmsfSegment(edges, minWeight, sigma)
+				expected := s.GetLabels()
+
+				/* The tiles must not depend on the order of the edges of the graph */
+				rand.New(rand.NewSource(int64(i))).Shuffle(len(s.graph.Edges()), func(a, b int) {
+					s.graph.Edges()[a], s.graph.Edges()[b] = s.graph.Edges()[b], s.graph.Edges()[a]
+				})
+				for _, workers := range []int{1, 2, 3, 7, 64} {
+					s.phmsfRun(workers, minWeight, sigma)
+					assert.Equal(t, expected, s.GetLabels(), "%s graph, image %d, minweight %v, %d workers",
+						name, i, minWeight, workers)
+				}
+			}
+		}
+	}
+}
+
+func TestSegmentPHMSFEqualsSegmentHMSF(t *testing.T) {
+	img := noisyBlocksImage(30, 20, 4)
+	hmsf := New(img, graph.KINGSGRAPH, IntensityDifference).SegmentHMSF(0.5, 8)
+	phmsf := New(img, graph.KINGSGRAPH, IntensityDifference).SegmentPHMSF(0.5, 8)
+	assert.Equal(t, hmsf, phmsf)
+}
+
+func TestPHMSFHierarchyIsInWeightOrder(t *testing.T) {
+	s, edges := hierarchySegmenter(noisyBlocksImage(30, 20, 5), graph.KINGSGRAPH)
+	sigma := s.estimateNoise()
+	s.hmsfSegment(edges, 6, sigma)
+	expected := s.GetLabels()
+	for _, workers := range []int{1, 3, 64} {
+		s.phmsfRun(workers, 6, sigma)
+		hierarchy := s.GetHierarchy()
+		assert.Equal(t, 30*20-expected.Count, hierarchy.Cut, "%d workers", workers)
+		assert.Equal(t, expected, hierarchy.LabelsForCount(expected.Count), "%d workers", workers)
+		for i, merge := range hierarchy.Merges[:hierarchy.Cut] {
+			assert.Equal(t, merge.Weight, merge.Level, "%d workers, merge %d", workers, i)
+		}
+		for i := 1; i < hierarchy.Cut; i++ {
+			assert.True(t, hierarchy.Merges[i-1].Weight <= hierarchy.Merges[i].Weight)
+		}
+	}
+}
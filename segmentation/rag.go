@@ -0,0 +1,168 @@
+package segmentation
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"io"
+	"math"
+	"sort"
+)
+
+/**
+ * An edge of a region adjacency graph between the regions A and B, A < B.
+ * Length is the number of edges of the pixel graph that connect both regions
+ * and the weights are computed from those edges.
+ */
+type Boundary struct {
+	A          int     `json:"a"`
+	B          int     `json:"b"`
+	Length     int     `json:"length"`
+	MinWeight  float64 `json:"minWeight"`
+	MeanWeight float64 `json:"meanWeight"`
+	MaxWeight  float64 `json:"maxWeight"`
+}
+
+/**
+ * Region adjacency graph of a segmentation. Its regions are the statistics
+ * of the segments and two regions are adjacent if an edge of the pixel graph
+ * connects them.
+ */
+type RAG struct {
+	regions    []RegionStats
+	internal   []float64
+	boundaries []Boundary
+	adjacency  []map[int]int
+}
+
+/**
+ * Returns the region adjacency graph of the segments of labels, whose
+ * statistics are stats, over the pixel graph g. Region ids are the ones of
+ * labels and UNLABELED pixels don't belong to any region.
+ */
+func NewRAG(labels *Labels, stats []RegionStats, g *graph.Graph) *RAG {
+	rag := new(RAG)
+	rag.regions = stats
+	rag.internal = make([]float64, labels.Count, labels.Count)
+	rag.adjacency = make([]map[int]int, labels.Count, labels.Count)
+	for id := range rag.adjacency {
+		rag.adjacency[id] = make(map[int]int)
+	}
+
+	for _, edge := range g.Edges() {
+		a, b := labels.Ids[edge.U()], labels.Ids[edge.V()]
+		if a == UNLABELED || b == UNLABELED {
+			continue
+		}
+		if a == b {
+			rag.internal[a] = math.Max(rag.internal[a], edge.Weight())
+			continue
+		}
+		a, b = minMax(a, b)
+		i, ok := rag.adjacency[a][b]
+		if !ok {
+			i = len(rag.boundaries)
+			rag.adjacency[a][b] = i
+			rag.adjacency[b][a] = i
+			rag.boundaries = append(rag.boundaries,
+				Boundary{A: a, B: b, MinWeight: math.Inf(1), MaxWeight: math.Inf(-1)})
+		}
+		boundary := &rag.boundaries[i]
+		boundary.Length++
+		boundary.MeanWeight += edge.Weight()
+		boundary.MinWeight = math.Min(boundary.MinWeight, edge.Weight())
+		boundary.MaxWeight = math.Max(boundary.MaxWeight, edge.Weight())
+	}
+	for i := range rag.boundaries {
+		rag.boundaries[i].MeanWeight /= float64(rag.boundaries[i].Length)
+	}
+	return rag
+}
+
+/**
+ * Returns the total number of regions of the RAG
+ */
+func (rag *RAG) TotalRegions() int {
+	return len(rag.regions)
+}
+
+/**
+ * Returns the total number of boundaries of the RAG
+ */
+func (rag *RAG) TotalBoundaries() int {
+	return len(rag.boundaries)
+}
+
+/**
+ * Returns the statistics of the region with the given id
+ */
+func (rag *RAG) Region(id int) RegionStats {
+	return rag.regions[id]
+}
+
+/**
+ * Returns the statistics of all the regions, indexed by id
+ */
+func (rag *RAG) Regions() []RegionStats {
+	return rag.regions
+}
+
+/**
+ * Returns the maximum weight of the edges of the pixel graph that connect
+ * two pixels of the region with the given id
+ */
+func (rag *RAG) InternalWeight(id int) float64 {
+	return rag.internal[id]
+}
+
+/**
+ * Returns all the boundaries between adjacent regions
+ */
+func (rag *RAG) Boundaries() []Boundary {
+	return rag.boundaries
+}
+
+/**
+ * Returns the boundary between the regions a and b and true, or false if
+ * they aren't adjacent
+ */
+func (rag *RAG) Boundary(a, b int) (Boundary, bool) {
+	i, ok := rag.adjacency[a][b]
+	if !ok {
+		return Boundary{}, false
+	}
+	return rag.boundaries[i], true
+}
+
+/**
+ * Returns the ids of the regions adjacent to the region id in increasing order
+ */
+func (rag *RAG) Neighbors(id int) []int {
+	neighbors := make([]int, 0, len(rag.adjacency[id]))
+	for n := range rag.adjacency[id] {
+		neighbors = append(neighbors, n)
+	}
+	sort.Ints(neighbors)
+	return neighbors
+}
+
+/**
+ * Writes the RAG to w in the DOT language of Graphviz. Nodes carry the area
+ * and centroid of the regions and edges the length and weights of the
+ * boundaries, labeled with their mean weight. Graphviz reserves the weight
+ * attribute for integer layout weights, so the mean is written as meanweight.
+ */
+func (rag *RAG) WriteDOT(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "graph rag {")
+	for _, r := range rag.regions {
+		fmt.Fprintf(out, "  %d [area=%d, pos=\"%g,%g\"];\n", r.Label, r.Area, r.Centroid.X,
+			-r.Centroid.Y)
+	}
+	for _, b := range rag.boundaries {
+		fmt.Fprintf(out, "  %d -- %d [label=\"%.4g\", length=%d, meanweight=%g, minweight=%g, maxweight=%g];\n",
+			b.A, b.B, b.MeanWeight, b.Length, b.MeanWeight, b.MinWeight, b.MaxWeight)
+	}
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
@@ -0,0 +1,152 @@
+package segmentation
+
+import (
+	"bytes"
+	"github.com/miguelfrde/image-segmentation/disjointset"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"math"
+	"strings"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+/**
+ * Weight of the RAG tests: the difference between the red values of the
+ * pixels
+ */
+func redDifference(p, q graph.Pixel) float64 {
+	a, _, _, _ := p.Color.RGBA()
+	b, _, _, _ := q.Color.RGBA()
+	return math.Abs(float64(a>>8) - float64(b>>8))
+}
+
+/**
+ * 4x3 image whose left half is black and right half white except for
+ * the pixel (3, 2), which is gray, and its labels:
+ *   0 0 1 1
+ *   0 0 1 1
+ *   0 0 1 2
+ */
+func ragTestImage() (*Labels, image.Image, *graph.Graph) {
+	img := grayImage(4,
+		0, 0, 255, 255,
+		0, 0, 255, 255,
+		0, 0, 255, 128)
+	labels := labelsOf(4, 3, 3,
+		0, 0, 1, 1,
+		0, 0, 1, 1,
+		0, 0, 1, 2)
+	return labels, img, graph.FromImage(img, redDifference, graph.GRIDGRAPH)
+}
+
+func ragOf(labels *Labels, img image.Image, g *graph.Graph) *RAG {
+	return NewRAG(labels, ComputeRegionStats(labels, img, g), g)
+}
+
+/*
+ * Tests
+ */
+
+func TestRAGRegions(t *testing.T) {
+	labels, img, g := ragTestImage()
+	rag := ragOf(labels, img, g)
+	assert.Equal(t, 3, rag.TotalRegions())
+	assert.Equal(t, ComputeRegionStats(labels, img, g), rag.Regions())
+	assert.Equal(t, 6, rag.Region(0).Area)
+	assert.Equal(t, Point{0.5, 1}, rag.Region(0).Centroid)
+	assert.Equal(t, 5, rag.Region(1).Area)
+	assert.Equal(t, [3]float64{128, 128, 128}, rag.Region(2).Mean)
+	assert.Equal(t, BoundingBox{3, 2, 3, 2}, rag.Region(2).Bounds)
+}
+
+func TestRAGBoundaries(t *testing.T) {
+	rag := ragOf(ragTestImage())
+	assert.Equal(t, 2, rag.TotalBoundaries())
+	boundary, ok := rag.Boundary(0, 1)
+	assert.True(t, ok)
+	assert.Equal(t, Boundary{A: 0, B: 1, Length: 3, MinWeight: 255, MeanWeight: 255,
+		MaxWeight: 255}, boundary)
+	boundary, ok = rag.Boundary(2, 1)
+	assert.True(t, ok)
+	assert.Equal(t, 2, boundary.Length)
+	assert.Equal(t, 127.0, boundary.MinWeight)
+	assert.Equal(t, 127.0, boundary.MaxWeight)
+	_, ok = rag.Boundary(0, 2)
+	assert.False(t, ok)
+}
+
+func TestRAGNeighbors(t *testing.T) {
+	rag := ragOf(ragTestImage())
+	assert.Equal(t, []int{1}, rag.Neighbors(0))
+	assert.Equal(t, []int{0, 2}, rag.Neighbors(1))
+	assert.Equal(t, []int{1}, rag.Neighbors(2))
+	for id, region := range rag.Regions() {
+		assert.Equal(t, region.Neighbors, len(rag.Neighbors(id)))
+	}
+}
+
+func TestRAGIgnoresUnlabeledPixels(t *testing.T) {
+	g := graph.New(3, 1, graph.GRIDGRAPH)
+	labels := labelsOf(3, 1, 2, 0, UNLABELED, 1)
+	rag := NewRAG(labels, []RegionStats{{Label: 0, Area: 1}, {Label: 1, Area: 1}}, g)
+	assert.Equal(t, 0, rag.TotalBoundaries())
+	_, ok := rag.Boundary(0, 1)
+	assert.False(t, ok)
+	assert.Empty(t, rag.Neighbors(0))
+}
+
+func TestRAGInternalWeight(t *testing.T) {
+	_, img, g := ragTestImage()
+	rag := ragOf(NewLabels(4, 3), img, g)
+	assert.Equal(t, 1, rag.TotalRegions())
+	assert.Equal(t, 0, rag.TotalBoundaries())
+	assert.Equal(t, 255.0, rag.InternalWeight(0))
+
+	rag = ragOf(ragTestImage())
+	assert.Equal(t, 0.0, rag.InternalWeight(0))
+	assert.Equal(t, 0.0, rag.InternalWeight(2))
+}
+
+func TestGetRAGUsesTheLabelsOfTheSegmentation(t *testing.T) {
+	s := New(noisyBlocksImage(30, 20, 19), graph.KINGSGRAPH, ColorDistance)
+	assert.Nil(t, s.GetRAG())
+	labels := s.SegmentGBS(0.5, 300, 20)
+	rag := s.GetRAG()
+	assert.Equal(t, labels.Count, rag.TotalRegions())
+	assert.Equal(t, s.GetRegionStats(), rag.Regions())
+	for _, boundary := range rag.Boundaries() {
+		assert.True(t, boundary.A < boundary.B)
+		assert.True(t, boundary.MinWeight <= boundary.MeanWeight)
+		assert.True(t, boundary.MeanWeight <= boundary.MaxWeight)
+	}
+}
+
+func TestRAGOfADisjointSet(t *testing.T) {
+	expected, img, g := ragTestImage()
+	set := disjointset.New(12)
+	for _, edge := range g.Edges() {
+		if edge.Weight() == 0 {
+			set.Union(edge.U(), edge.V())
+		}
+	}
+	labels := LabelsFromDisjointSet(set, 4, 3)
+	assert.Equal(t, expected, labels)
+	assert.Equal(t, ragOf(expected, img, g).Boundaries(), ragOf(labels, img, g).Boundaries())
+}
+
+func TestRAGWriteDOT(t *testing.T) {
+	rag := ragOf(ragTestImage())
+	var buf bytes.Buffer
+	assert.Nil(t, rag.WriteDOT(&buf))
+	dot := buf.String()
+	assert.True(t, strings.HasPrefix(dot, "graph rag {\n"))
+	assert.Contains(t, dot, "  0 [area=6, pos=\"0.5,-1\"];\n")
+	assert.Contains(t, dot, "  0 -- 1 [label=\"255\", length=3, meanweight=255, minweight=255, maxweight=255];\n")
+	/* Graphviz only accepts integer edge weights */
+	assert.NotContains(t, dot, " weight=")
+}
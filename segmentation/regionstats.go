@@ -0,0 +1,166 @@
+package segmentation
+
+import (
+	"github.com/miguelfrde/image-segmentation/graph"
+	"image"
+	"math"
+)
+
+/**
+ * Smallest rectangle that contains all the pixels of a region. Max values
+ * are inclusive.
+ */
+type BoundingBox struct {
+	MinX int `json:"minX"`
+	MinY int `json:"minY"`
+	MaxX int `json:"maxX"`
+	MaxY int `json:"maxY"`
+}
+
+/**
+ * Point with real coordinates, used for the centroid of a region
+ */
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+/**
+ * Statistics of a single segment. Mean and Variance store the values of the
+ * r, g and b channels (0-255) in that order. Perimeter is the number of pixel
+ * sides that separate the region from other regions or from the image border.
+ * Neighbors is the number of regions that are adjacent to this one in the graph.
+ */
+type RegionStats struct {
+	Label     int         `json:"label"`
+	Area      int         `json:"area"`
+	Bounds    BoundingBox `json:"bounds"`
+	Centroid  Point       `json:"centroid"`
+	Mean      [3]float64  `json:"mean"`
+	Variance  [3]float64  `json:"variance"`
+	Perimeter int         `json:"perimeter"`
+	Neighbors int         `json:"neighbors"`
+}
+
+/**
+ * Computes the statistics of every segment of the label map using the colors
+ * of the image img and the adjacency given by the graph g. The result is
+ * indexed by segment id.
+ */
+func ComputeRegionStats(labels *Labels, img image.Image, g *graph.Graph) []RegionStats {
+	stats := make([]RegionStats, labels.Count, labels.Count)
+	sums := make([][3]float64, labels.Count, labels.Count)
+	squares := make([][3]float64, labels.Count, labels.Count)
+	for id := range stats {
+		stats[id].Label = id
+		stats[id].Bounds = BoundingBox{MinX: labels.Width, MinY: labels.Height, MaxX: -1, MaxY: -1}
+	}
+
+	for y := 0; y < labels.Height; y++ {
+		for x := 0; x < labels.Width; x++ {
+			id := labels.At(x, y)
+			region := &stats[id]
+			region.Area++
+			region.Centroid.X += float64(x)
+			region.Centroid.Y += float64(y)
+			region.Bounds.extend(x, y)
+			r, g, b, _ := img.At(x, y).RGBA()
+			for c, val := range [3]uint32{r >> 8, g >> 8, b >> 8} {
+				sums[id][c] += float64(val)
+				squares[id][c] += float64(val) * float64(val)
+			}
+			region.Perimeter += borderSides(labels, x, y)
+		}
+	}
+
+	for id := range stats {
+		area := float64(stats[id].Area)
+		stats[id].Centroid.X /= area
+		stats[id].Centroid.Y /= area
+		for c := 0; c < 3; c++ {
+			stats[id].Mean[c] = sums[id][c] / area
+			/* Rounding can make the variance of uniform regions slightly negative */
+			variance := squares[id][c]/area - stats[id].Mean[c]*stats[id].Mean[c]
+			stats[id].Variance[c] = math.Max(0, variance)
+		}
+	}
+
+	adjacent := make(map[[2]int]bool)
+	for _, edge := range g.Edges() {
+		u, v := labels.Ids[edge.U()], labels.Ids[edge.V()]
+		if u != v && !adjacent[[2]int{u, v}] {
+			adjacent[[2]int{u, v}] = true
+			adjacent[[2]int{v, u}] = true
+			stats[u].Neighbors++
+			stats[v].Neighbors++
+		}
+	}
+	return stats
+}
+
+/**
+ * Returns the statistics of every segment of the last segmentation, computed
+ * with the colors of the original image. Returns nil if no segmentation
+ * algorithm has been executed before.
+ */
+func (s *Segmenter) GetRegionStats() []RegionStats {
+	if s.resultset == nil {
+		return nil
+	}
+	if s.graph == nil {
+		s.buildGraph()
+	}
+	return ComputeRegionStats(s.GetLabels(), s.original, s.graph)
+}
+
+/**
+ * Returns the region adjacency graph of the last segmentation, whose regions
+ * are the ones of GetRegionStats. Its region ids are the same as the ones of
+ * GetLabels. Returns nil if no segmentation algorithm has been executed
+ * before.
+ */
+func (s *Segmenter) GetRAG() *RAG {
+	if s.resultset == nil {
+		return nil
+	}
+	if s.graph == nil {
+		s.buildGraph()
+	}
+	labels := s.GetLabels()
+	return NewRAG(labels, ComputeRegionStats(labels, s.original, s.graph), s.graph)
+}
+
+/**
+ * Grows the bounding box so that it contains the pixel (x, y)
+ */
+func (box *BoundingBox) extend(x, y int) {
+	if x < box.MinX {
+		box.MinX = x
+	}
+	if y < box.MinY {
+		box.MinY = y
+	}
+	if x > box.MaxX {
+		box.MaxX = x
+	}
+	if y > box.MaxY {
+		box.MaxY = y
+	}
+}
+
+/**
+ * Returns how many of the four sides of the pixel (x, y) touch either the
+ * image border or a pixel of a different segment
+ */
+func borderSides(labels *Labels, x, y int) int {
+	id := labels.At(x, y)
+	sides := 0
+	for _, d := range [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+		nx, ny := x+d[0], y+d[1]
+		if nx < 0 || ny < 0 || nx >= labels.Width || ny >= labels.Height ||
+			labels.At(nx, ny) != id {
+			sides++
+		}
+	}
+	return sides
+}
@@ -0,0 +1,71 @@
+package segmentation
+
+import (
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+/**
+ * Returns the grayscale image of the given width with the given values
+ */
+func grayImage(width int, values ...uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, len(values)/width))
+	for i, value := range values {
+		img.SetGray(i%width, i/width, color.Gray{value})
+	}
+	return img
+}
+
+/*
+ * Tests
+ */
+
+func TestComputeRegionStats(t *testing.T) {
+	img := grayImage(3,
+		10, 20, 200,
+		30, 40, 200)
+	labels := labelsOf(3, 2, 2,
+		0, 0, 1,
+		0, 0, 1)
+	stats := ComputeRegionStats(labels, img, graph.FromImage(img, ColorDistance, graph.GRIDGRAPH))
+	assert.Equal(t, 2, len(stats))
+
+	left := stats[0]
+	assert.Equal(t, 0, left.Label)
+	assert.Equal(t, 4, left.Area)
+	assert.Equal(t, BoundingBox{0, 0, 1, 1}, left.Bounds)
+	assert.Equal(t, Point{0.5, 0.5}, left.Centroid)
+	assert.Equal(t, [3]float64{25, 25, 25}, left.Mean)
+	assert.Equal(t, [3]float64{125, 125, 125}, left.Variance)
+	assert.Equal(t, 8, left.Perimeter)
+	assert.Equal(t, 1, left.Neighbors)
+
+	right := stats[1]
+	assert.Equal(t, 2, right.Area)
+	assert.Equal(t, BoundingBox{2, 0, 2, 1}, right.Bounds)
+	assert.Equal(t, Point{2, 0.5}, right.Centroid)
+	assert.Equal(t, [3]float64{200, 200, 200}, right.Mean)
+	assert.Equal(t, 6, right.Perimeter)
+	assert.Equal(t, 1, right.Neighbors)
+}
+
+func TestRegionStatsVarianceIsNeverNegative(t *testing.T) {
+	for value := 0; value < 256; value++ {
+		values := make([]uint8, 7*5, 7*5)
+		for i := range values {
+			values[i] = uint8(value)
+		}
+		img := grayImage(7, values...)
+		stats := ComputeRegionStats(NewLabels(7, 5), img,
+			graph.FromImage(img, ColorDistance, graph.GRIDGRAPH))
+		assert.Equal(t, [3]float64{0, 0, 0}, stats[0].Variance, "value %d", value)
+		assert.Equal(t, 0, stats[0].Neighbors)
+	}
+}
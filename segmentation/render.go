@@ -0,0 +1,241 @@
+package segmentation
+
+import (
+	"fmt"
+	"github.com/miguelfrde/image-segmentation/palette"
+	"image"
+	"image/color"
+	"math"
+)
+
+/**
+ * How a Renderer draws the segments of a label map
+ */
+type RenderMode int
+
+const (
+	RENDER_FILL RenderMode = iota
+	RENDER_BOUNDARIES
+	RENDER_BLEND
+	RENDER_MASK
+)
+
+var renderModeNames = map[RenderMode]string{
+	RENDER_FILL:       "fill",
+	RENDER_BOUNDARIES: "boundaries",
+	RENDER_BLEND:      "blend",
+	RENDER_MASK:       "mask",
+}
+
+/**
+ * Maximum width in pixels of the boundaries drawn by a Renderer
+ */
+const MAX_BOUNDARY_WIDTH = 20
+
+func (mode RenderMode) String() string {
+	if name, ok := renderModeNames[mode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RenderMode(%d)", int(mode))
+}
+
+/**
+ * Returns the render mode with the given name: fill, boundaries, blend or
+ * mask
+ */
+func ParseRenderMode(name string) (RenderMode, error) {
+	for mode, modeName := range renderModeNames {
+		if modeName == name {
+			return mode, nil
+		}
+	}
+	return RENDER_FILL, fmt.Errorf("unknown render mode %q", name)
+}
+
+/**
+ * Draws the result images of segmentations. Depending on its mode it:
+ *  - RENDER_FILL: fills every segment with its color.
+ *  - RENDER_BOUNDARIES: draws the boundaries between segments over the
+ *    image with BoundaryColor.
+ *  - RENDER_BLEND: blends the color of every segment with the image, the
+ *    color weighting Opacity and the image 1 - Opacity.
+ *  - RENDER_MASK: returns a grayscale image where the boundaries are white
+ *    and everything else is black.
+ * The color of a segment is the mean color of its pixels in the image, or
+ * the one chosen by Palette if RandomColors is true. Boundaries are
+ * BoundaryWidth pixels wide.
+ */
+type Renderer struct {
+	Mode          RenderMode
+	RandomColors  bool
+	Palette       palette.Palette
+	BoundaryColor color.Color
+	BoundaryWidth int
+	Opacity       float64
+}
+
+/**
+ * Returns a renderer with the given mode that draws 1 pixel wide red
+ * boundaries and blends colors with an opacity of 0.5
+ */
+func NewRenderer(mode RenderMode) Renderer {
+	return Renderer{
+		Mode:          mode,
+		BoundaryColor: color.RGBA{255, 0, 0, 255},
+		BoundaryWidth: 1,
+		Opacity:       0.5,
+	}
+}
+
+/**
+ * Returns the image of the segments of labels drawn over the image img. The
+ * result image starts at (0, 0) even if the bounds of img don't. Returns an
+ * error if labels and img don't have the same size.
+ */
+func (renderer Renderer) Render(labels *Labels, img image.Image) (image.Image, error) {
+	bounds := img.Bounds()
+	if err := labels.checkSize("labels", bounds.Dx(), bounds.Dy()); err != nil {
+		return nil, err
+	}
+	/* Reads img as if it started at (0, 0) */
+	at := func(x, y int) color.Color {
+		return img.At(bounds.Min.X+x, bounds.Min.Y+y)
+	}
+	switch renderer.Mode {
+	case RENDER_BOUNDARIES:
+		return renderer.renderBoundaries(labels, at), nil
+	case RENDER_BLEND:
+		return renderer.renderBlend(labels, at), nil
+	case RENDER_MASK:
+		return renderer.renderMask(labels), nil
+	}
+	return renderer.renderFill(labels, at), nil
+}
+
+/**
+ * Returns the color of every segment of labels indexed by segment id: the
+ * mean color of its pixels in the image read by at or the one of the palette
+ */
+func (renderer Renderer) segmentColors(labels *Labels, at func(x, y int) color.Color) []color.NRGBA {
+	colors := make([]color.NRGBA, labels.Count, labels.Count)
+	if renderer.RandomColors {
+		var adjacency [][]int
+		if renderer.Palette.UsesAdjacency() {
+			adjacency = labels.Adjacency()
+		}
+		for id, clr := range renderer.Palette.Assign(labels.Count, adjacency) {
+			colors[id] = color.NRGBA{clr.R, clr.G, clr.B, 255}
+		}
+		return colors
+	}
+	means := make([]ImageColor, labels.Count, labels.Count)
+	sizes := labels.Sizes()
+	for y := 0; y < labels.Height; y++ {
+		for x := 0; x < labels.Width; x++ {
+			id := labels.At(x, y)
+			r, g, b, _ := at(x, y).RGBA()
+			means[id].r += float32(r>>8) / float32(sizes[id])
+			means[id].g += float32(g>>8) / float32(sizes[id])
+			means[id].b += float32(b>>8) / float32(sizes[id])
+		}
+	}
+	for id, mean := range means {
+		colors[id] = color.NRGBA{uint8(mean.r), uint8(mean.g), uint8(mean.b), 255}
+	}
+	return colors
+}
+
+/**
+ * Returns the boundary map of labels with the boundaries widened to
+ * BoundaryWidth pixels. Wide boundaries grow to both sides of the 1 pixel
+ * ones.
+ */
+func (renderer Renderer) boundaries(labels *Labels) []bool {
+	width := renderer.BoundaryWidth
+	if width < 1 {
+		width = 1
+	} else if width > MAX_BOUNDARY_WIDTH {
+		width = MAX_BOUNDARY_WIDTH
+	}
+	boundaries := labels.Boundaries()
+	if width == 1 {
+		return boundaries
+	}
+	/* Dilates the map with a width x width square, one dimension at a time */
+	from, to := -(width-1)/2, width/2
+	dilate := func(src []bool, step, length int) []bool {
+		dst := make([]bool, len(src), len(src))
+		for p, boundary := range src {
+			if !boundary {
+				continue
+			}
+			pos := p % labels.Width
+			if step != 1 {
+				pos = p / labels.Width
+			}
+			for d := from; d <= to; d++ {
+				if pos+d >= 0 && pos+d < length {
+					dst[p+d*step] = true
+				}
+			}
+		}
+		return dst
+	}
+	boundaries = dilate(boundaries, 1, labels.Width)
+	return dilate(boundaries, labels.Width, labels.Height)
+}
+
+func (renderer Renderer) renderFill(labels *Labels, at func(x, y int) color.Color) image.Image {
+	resultimg := image.NewNRGBA(image.Rect(0, 0, labels.Width, labels.Height))
+	colors := renderer.segmentColors(labels, at)
+	for y := 0; y < labels.Height; y++ {
+		for x := 0; x < labels.Width; x++ {
+			resultimg.SetNRGBA(x, y, colors[labels.At(x, y)])
+		}
+	}
+	return resultimg
+}
+
+func (renderer Renderer) renderBoundaries(labels *Labels, at func(x, y int) color.Color) image.Image {
+	resultimg := image.NewNRGBA(image.Rect(0, 0, labels.Width, labels.Height))
+	boundaryColor := color.NRGBAModel.Convert(renderer.BoundaryColor)
+	boundaries := renderer.boundaries(labels)
+	for y := 0; y < labels.Height; y++ {
+		for x := 0; x < labels.Width; x++ {
+			if boundaries[x+y*labels.Width] {
+				resultimg.Set(x, y, boundaryColor)
+			} else {
+				resultimg.Set(x, y, at(x, y))
+			}
+		}
+	}
+	return resultimg
+}
+
+func (renderer Renderer) renderBlend(labels *Labels, at func(x, y int) color.Color) image.Image {
+	resultimg := image.NewNRGBA(image.Rect(0, 0, labels.Width, labels.Height))
+	colors := renderer.segmentColors(labels, at)
+	opacity := math.Max(0, math.Min(1, renderer.Opacity))
+	blend := func(a uint32, b uint8) uint8 {
+		return uint8(math.Round(float64(a>>8)*(1-opacity) + float64(b)*opacity))
+	}
+	for y := 0; y < labels.Height; y++ {
+		for x := 0; x < labels.Width; x++ {
+			r, g, b, _ := at(x, y).RGBA()
+			fill := colors[labels.At(x, y)]
+			resultimg.SetNRGBA(x, y, color.NRGBA{blend(r, fill.R), blend(g, fill.G),
+				blend(b, fill.B), 255})
+		}
+	}
+	return resultimg
+}
+
+func (renderer Renderer) renderMask(labels *Labels) image.Image {
+	mask := image.NewGray(image.Rect(0, 0, labels.Width, labels.Height))
+	for p, boundary := range renderer.boundaries(labels) {
+		if boundary {
+			mask.Pix[p] = 255
+		}
+	}
+	return mask
+}
@@ -0,0 +1,196 @@
+package segmentation
+
+import (
+	"github.com/miguelfrde/image-segmentation/palette"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+/**
+ * Returns a width x height image whose pixel (x, y) has the gray value
+ * 10 * x + y
+ */
+func rampImage(width, height int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{uint8(10*x + y)})
+		}
+	}
+	return img
+}
+
+/**
+ * Returns a width x height label map with the columns before split in the
+ * segment 0 and the rest in the segment 1
+ */
+func columnLabels(width, height, split int) *Labels {
+	labels := NewLabels(width, height)
+	for p := range labels.Ids {
+		if p%width >= split {
+			labels.Ids[p] = 1
+		}
+	}
+	labels.Count = 2
+	return labels
+}
+
+func render(t *testing.T, renderer Renderer, labels *Labels, img image.Image) image.Image {
+	rendered, err := renderer.Render(labels, img)
+	assert.Nil(t, err)
+	return rendered
+}
+
+/**
+ * Returns the columns of the first row of the image that are white in the
+ * mask drawn by the renderer
+ */
+func maskColumns(t *testing.T, renderer Renderer, labels *Labels) []int {
+	renderer.Mode = RENDER_MASK
+	mask := render(t, renderer, labels, rampImage(labels.Width, labels.Height)).(*image.Gray)
+	var columns []int
+	for x := 0; x < labels.Width; x++ {
+		if mask.GrayAt(x, 0).Y == 255 {
+			columns = append(columns, x)
+		}
+	}
+	return columns
+}
+
+/*
+ * Tests
+ */
+
+func TestParseRenderModeNames(t *testing.T) {
+	for _, mode := range []RenderMode{RENDER_FILL, RENDER_BOUNDARIES, RENDER_BLEND, RENDER_MASK} {
+		parsed, err := ParseRenderMode(mode.String())
+		assert.Nil(t, err)
+		assert.Equal(t, mode, parsed)
+	}
+	_, err := ParseRenderMode("outline")
+	assert.NotNil(t, err)
+}
+
+func TestRenderFillUsesTheMeanColors(t *testing.T) {
+	/* The mean of the segment 0 is 5 and the one of 1 is 30 */
+	rendered := render(t, NewRenderer(RENDER_FILL), columnLabels(5, 1, 2), rampImage(5, 1))
+	assert.Equal(t, image.Rect(0, 0, 5, 1), rendered.Bounds())
+	for x, gray := range []uint8{5, 5, 30, 30, 30} {
+		assert.Equal(t, color.NRGBA{gray, gray, gray, 255}, rendered.At(x, 0), "pixel %d", x)
+	}
+}
+
+func TestRenderFillWithPalette(t *testing.T) {
+	renderer := NewRenderer(RENDER_FILL)
+	renderer.RandomColors = true
+	renderer.Palette = palette.Palette{Mode: palette.RANDOM, Seed: 3}
+	rendered := render(t, renderer, columnLabels(4, 2, 1), rampImage(4, 2))
+	colors := palette.Random(2, 3)
+	for p := 0; p < 8; p++ {
+		clr := colors[0]
+		if p%4 >= 1 {
+			clr = colors[1]
+		}
+		assert.Equal(t, color.NRGBA{clr.R, clr.G, clr.B, 255}, rendered.At(p%4, p/4))
+	}
+}
+
+func TestRenderBoundaries(t *testing.T) {
+	img := rampImage(6, 3)
+	renderer := NewRenderer(RENDER_BOUNDARIES)
+	renderer.BoundaryColor = color.RGBA{0, 0, 255, 255}
+	rendered := render(t, renderer, columnLabels(6, 3, 2), img)
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 6; x++ {
+			if x == 1 {
+				assert.Equal(t, color.NRGBA{0, 0, 255, 255}, rendered.At(x, y))
+			} else {
+				gray := img.GrayAt(x, y).Y
+				assert.Equal(t, color.NRGBA{gray, gray, gray, 255}, rendered.At(x, y))
+			}
+		}
+	}
+}
+
+func TestRenderBoundaryWidths(t *testing.T) {
+	renderer := NewRenderer(RENDER_MASK)
+	labels := columnLabels(8, 3, 4)
+	for width, columns := range map[int][]int{
+		0: {3}, 1: {3}, 2: {3, 4}, 3: {2, 3, 4}, 4: {2, 3, 4, 5}} {
+		renderer.BoundaryWidth = width
+		assert.Equal(t, columns, maskColumns(t, renderer, labels), "width %d", width)
+	}
+	/* Wide boundaries are clamped */
+	renderer.BoundaryWidth = MAX_BOUNDARY_WIDTH + 50
+	wide := maskColumns(t, renderer, columnLabels(60, 1, 30))
+	assert.Equal(t, MAX_BOUNDARY_WIDTH, len(wide))
+	renderer.BoundaryWidth = MAX_BOUNDARY_WIDTH
+	assert.Equal(t, wide, maskColumns(t, renderer, columnLabels(60, 1, 30)))
+}
+
+func TestRenderBoundariesAtTheImageEdges(t *testing.T) {
+	renderer := NewRenderer(RENDER_MASK)
+	renderer.BoundaryWidth = 5
+	assert.Equal(t, []int{0, 1, 2}, maskColumns(t, renderer, columnLabels(6, 2, 1)))
+	assert.Equal(t, []int{2, 3, 4, 5}, maskColumns(t, renderer, columnLabels(6, 2, 5)))
+
+	/* The boundary of the first row grows down only */
+	labels := labelsOf(1, 6, 2, 0, 1, 1, 1, 1, 1)
+	mask := render(t, renderer, labels, rampImage(1, 6)).(*image.Gray)
+	assert.Equal(t, []uint8{255, 255, 255, 0, 0, 0}, mask.Pix)
+}
+
+func TestRenderBlend(t *testing.T) {
+	labels := columnLabels(5, 1, 2)
+	img := rampImage(5, 1)
+	for opacity, grays := range map[float64][]uint8{
+		0: {0, 10, 20, 30, 40}, 1: {5, 5, 30, 30, 30}, 2: {5, 5, 30, 30, 30},
+		0.5: {3, 8, 25, 30, 35}} {
+		renderer := NewRenderer(RENDER_BLEND)
+		renderer.Opacity = opacity
+		rendered := render(t, renderer, labels, img)
+		for x, gray := range grays {
+			assert.Equal(t, color.NRGBA{gray, gray, gray, 255}, rendered.At(x, 0),
+				"opacity %v, pixel %d", opacity, x)
+		}
+	}
+}
+
+func TestRenderMask(t *testing.T) {
+	labels := labelsOf(3, 2, 2,
+		0, 0, 1,
+		0, 1, 1)
+	mask := render(t, NewRenderer(RENDER_MASK), labels, rampImage(3, 2)).(*image.Gray)
+	assert.Equal(t, []uint8{0, 255, 0, 255, 0, 0}, mask.Pix)
+}
+
+func TestRenderImagesThatDontStartAtTheOrigin(t *testing.T) {
+	big := rampImage(10, 8)
+	sub := big.SubImage(image.Rect(3, 2, 9, 5))
+	img := rampImage(6, 3)
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 6; x++ {
+			img.SetGray(x, y, big.GrayAt(x+3, y+2))
+		}
+	}
+	labels := columnLabels(6, 3, 2)
+	for _, mode := range []RenderMode{RENDER_FILL, RENDER_BOUNDARIES, RENDER_BLEND, RENDER_MASK} {
+		assert.Equal(t, render(t, NewRenderer(mode), labels, img),
+			render(t, NewRenderer(mode), labels, sub), "%s", mode)
+	}
+}
+
+func TestRenderRejectsLabelsOfAnotherSize(t *testing.T) {
+	for _, labels := range []*Labels{columnLabels(5, 3, 2), columnLabels(6, 4, 2),
+		{Width: 6, Height: 3, Count: 1, Ids: make([]int, 17)}} {
+		rendered, err := NewRenderer(RENDER_FILL).Render(labels, rampImage(6, 3))
+		assert.Nil(t, rendered)
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,193 @@
+package segmentation
+
+import (
+	"context"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"math"
+	"runtime"
+)
+
+/**
+ * Maximum number of segmentations run by a segment count search
+ */
+const MAX_SEARCH_ITERATIONS = 20
+
+/**
+ * Smallest k tried by the segment count search of GBS
+ */
+const SEARCH_MIN_K = 0.01
+
+/**
+ * Performs a GBS segmentation with the k for which it finds between
+ * minSegments and maxSegments segments. k is searched by bisection, reusing
+ * the smoothed image, the graph and the sorted edges in every iteration. If
+ * no k gives a segment count in the range, the closest one is used. Returns
+ * the label map of the resulting segmentation and the k used.
+ */
+func (s *Segmenter) SegmentGBSToCount(sigma float64, minSize, minSegments,
+	maxSegments int) (*Labels, float64) {
+	labels, k, _ := s.SegmentGBSToCountContext(context.Background(), sigma, minSize,
+		minSegments, maxSegments)
+	return labels, k
+}
+
+/**
+ * Same as SegmentGBSToCount but it stops as soon as ctx is done, in which case
+ * it returns a *CanceledError.
+ */
+func (s *Segmenter) SegmentGBSToCountContext(ctx context.Context, sigma float64, minSize,
+	minSegments, maxSegments int) (labels *Labels, k float64, err error) {
+	defer s.withContext(ctx)(&err)
+	s.smoothImage(sigma)
+	s.buildGraph()
+	start := s.beginPhase(PHASE_SEGMENT)
+	edges := s.graph.Edges()
+	s.sortEdges(edges)
+	maxK := (maxWeight(edges) + 1) * float64(s.graph.TotalVertices())
+	k = s.searchParameter("k", SEARCH_MIN_K, maxK, true, minSegments, maxSegments,
+		func(k float64) {
+			s.gbsSegment(edges, k, minSize)
+		})
+	s.endPhase(PHASE_SEGMENT, start)
+	s.logResult("gbs")
+	return s.GetLabels(), k, nil
+}
+
+/**
+ * Performs a HMSF segmentation with the minWeight for which it finds between
+ * minSegments and maxSegments segments. minWeight is searched by bisection,
+ * reusing the estimated noise, the smoothed image, the graph and the sorted
+ * edges in every iteration. If no minWeight gives a segment count in the
+ * range, the closest one is used. Returns the label map of the resulting
+ * segmentation and the minWeight used.
+ */
+func (s *Segmenter) SegmentHMSFToCount(sigmaSmooth float64, minSegments,
+	maxSegments int) (*Labels, float64) {
+	labels, minWeight, _ := s.SegmentHMSFToCountContext(context.Background(), sigmaSmooth,
+		minSegments, maxSegments)
+	return labels, minWeight
+}
+
+/**
+ * Same as SegmentHMSFToCount but it stops as soon as ctx is done, in which
+ * case it returns a *CanceledError.
+ */
+func (s *Segmenter) SegmentHMSFToCountContext(ctx context.Context, sigmaSmooth float64,
+	minSegments, maxSegments int) (labels *Labels, minWeight float64, err error) {
+	defer s.withContext(ctx)(&err)
+	sigma := s.estimateNoise()
+	s.smoothImage(sigmaSmooth)
+	s.buildGraph()
+	start := s.beginPhase(PHASE_SEGMENT)
+	edges := s.graph.Edges()
+	s.sortEdges(edges)
+	minWeight = s.searchParameter("minweight", 0, maxWeight(edges)+1, false, minSegments,
+		maxSegments, func(minWeight float64) {
+			s.hmsfSegment(edges, minWeight, sigma)
+		})
+	s.endPhase(PHASE_SEGMENT, start)
+	s.logResult("hmsf")
+	return s.GetLabels(), minWeight, nil
+}
+
+/**
+ * Same as SegmentHMSFToCount but using the parallel version of HMSF. Returns
+ * the label map of the resulting segmentation and the minWeight used.
+ */
+func (s *Segmenter) SegmentPHMSFToCount(sigmaSmooth float64, minSegments,
+	maxSegments int) (*Labels, float64) {
+	labels, minWeight, _ := s.SegmentPHMSFToCountContext(context.Background(), sigmaSmooth,
+		minSegments, maxSegments)
+	return labels, minWeight
+}
+
+/**
+ * Same as SegmentPHMSFToCount but it stops as soon as ctx is done, in which
+ * case it returns a *CanceledError.
+ */
+func (s *Segmenter) SegmentPHMSFToCountContext(ctx context.Context, sigmaSmooth float64,
+	minSegments, maxSegments int) (labels *Labels, minWeight float64, err error) {
+	defer s.withContext(ctx)(&err)
+	sigma := s.estimateNoise()
+	s.smoothImage(sigmaSmooth)
+	s.buildGraph()
+	start := s.beginPhase(PHASE_SEGMENT)
+	tiles := s.phmsfTiles(runtime.NumCPU())
+	edges := sortTiles(tiles)
+	minWeight = s.searchParameter("minweight", 0, maxWeight(edges)+1, false, minSegments,
+		maxSegments, func(minWeight float64) {
+			s.phmsfSegment(tiles, edges, minWeight, sigma)
+		})
+	s.endPhase(PHASE_SEGMENT, start)
+	s.logResult("phmsf")
+	return s.GetLabels(), minWeight, nil
+}
+
+/**
+ * Searches by bisection a value between lo and hi of the parameter with the
+ * given name for which segment leaves between minSegments and maxSegments
+ * segments in the result set. Greater values must give fewer segments. If
+ * geometric is true, the middle of the interval is the geometric mean of its
+ * ends, which suits parameters that span several orders of magnitude.
+ * The result set holds the segmentation of the returned value.
+ */
+func (s *Segmenter) searchParameter(name string, lo, hi float64, geometric bool,
+	minSegments, maxSegments int, segment func(float64)) float64 {
+	if maxSegments < minSegments {
+		maxSegments = minSegments
+	}
+	progress := s.progress
+	defer func() {
+		s.progress = progress
+	}()
+
+	best, bestDistance, last := 0.0, math.MaxInt, 0.0
+	for i := 0; i < MAX_SEARCH_ITERATIONS; i++ {
+		value := (lo + hi) / 2
+		if geometric {
+			value = math.Sqrt(lo * hi)
+		}
+		iteration := float64(i)
+		if progress != nil {
+			s.progress = func(phase string, fraction float64) {
+				progress(phase, (iteration+fraction)/MAX_SEARCH_ITERATIONS)
+			}
+		}
+		segment(value)
+		last = value
+		segments := s.resultset.Components()
+		s.logger.Debug("segment count search", "parameter", name, "value", value,
+			"segments", segments)
+
+		distance := 0
+		if segments < minSegments {
+			distance = minSegments - segments
+			hi = value
+		} else if segments > maxSegments {
+			distance = segments - maxSegments
+			lo = value
+		}
+		if distance < bestDistance {
+			best, bestDistance = value, distance
+		}
+		if distance == 0 {
+			break
+		}
+	}
+	if last != best {
+		segment(best)
+	}
+	s.logger.Info("segment count search finished", "parameter", name, "value", best,
+		"segments", s.resultset.Components())
+	return best
+}
+
+/**
+ * Returns the weight of the last edge of a list of edges sorted by weight
+ */
+func maxWeight(edges graph.EdgeList) float64 {
+	if len(edges) == 0 {
+		return 0
+	}
+	return edges[len(edges)-1].Weight()
+}
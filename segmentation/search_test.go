@@ -0,0 +1,113 @@
+package segmentation
+
+import (
+	"github.com/miguelfrde/image-segmentation/disjointset"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+/**
+ * Returns a segment function for searchParameter that leaves count(value)
+ * segments in the result set of s and records the values it's called with
+ */
+func countSegmenter(s *Segmenter, count func(float64) int, values *[]float64) func(float64) {
+	return func(value float64) {
+		*values = append(*values, value)
+		s.resultset = disjointset.New(1000)
+		for i := count(value); i < 1000; i++ {
+			s.resultset.Union(0, i)
+		}
+	}
+}
+
+/*
+ * Tests
+ */
+
+func TestSearchParameterReachesTheTarget(t *testing.T) {
+	s := New(noisyBlocksImage(4, 4, 14), graph.GRIDGRAPH, IntensityDifference)
+	var values []float64
+	count := func(value float64) int {
+		return int(math.Max(1, 900-value))
+	}
+	for _, target := range []int{1, 37, 500, 899} {
+		values = nil
+		value := s.searchParameter("test", 0, 1000, false, target, target,
+			countSegmenter(s, count, &values))
+		assert.Equal(t, target, s.resultset.Components(), "target %d", target)
+		assert.Equal(t, target, count(value))
+		assert.True(t, len(values) <= MAX_SEARCH_ITERATIONS)
+		assert.Equal(t, value, values[len(values)-1])
+	}
+
+	/* A range accepts any count in it and stops the search earlier */
+	values = nil
+	value := s.searchParameter("test", 0, 1000, false, 300, 800, countSegmenter(s, count, &values))
+	assert.Equal(t, []float64{500}, values)
+	assert.Equal(t, 500.0, value)
+}
+
+func TestSearchParameterKeepsTheClosestCount(t *testing.T) {
+	s := New(noisyBlocksImage(4, 4, 15), graph.GRIDGRAPH, IntensityDifference)
+	var values []float64
+	/* No value gives between 20 and 25 segments, 10 is the closest count */
+	count := func(value float64) int {
+		if value < 5 {
+			return 40
+		}
+		return 10
+	}
+	value := s.searchParameter("test", 0, 1000, false, 20, 25, countSegmenter(s, count, &values))
+	assert.Equal(t, MAX_SEARCH_ITERATIONS+1, len(values))
+	assert.True(t, value >= 5)
+	assert.Equal(t, 10, s.resultset.Components())
+
+	/* The best value is segmented again if the last one wasn't it */
+	values = nil
+	count = func(value float64) int {
+		if value < 5 {
+			return 22
+		}
+		return 1
+	}
+	value = s.searchParameter("test", 0, 1000, false, 30, 30, countSegmenter(s, count, &values))
+	assert.True(t, value < 5)
+	assert.Equal(t, 22, s.resultset.Components())
+	assert.Equal(t, value, values[len(values)-1])
+}
+
+func TestSearchParameterGeometric(t *testing.T) {
+	s := New(noisyBlocksImage(4, 4, 16), graph.GRIDGRAPH, IntensityDifference)
+	var values []float64
+	count := func(value float64) int {
+		return int(math.Max(1, 500-50*math.Log10(value)))
+	}
+	s.searchParameter("test", 0.01, 1e6, true, 200, 200, countSegmenter(s, count, &values))
+	assert.Equal(t, 200, s.resultset.Components())
+	assert.InDelta(t, 100, values[0], 1e-9)
+	/* 100 gives 400 segments, too many, so the next value is sqrt(100 * 1e6) */
+	assert.InDelta(t, 1e4, values[1], 1e-9)
+}
+
+func TestSegmentToCount(t *testing.T) {
+	img := noisyBlocksImage(40, 30, 17)
+	labels, k := New(img, graph.KINGSGRAPH, ColorDistance).SegmentGBSToCount(0.5, 5, 8, 12)
+	assert.True(t, labels.Count >= 8 && labels.Count <= 12, "%d segments", labels.Count)
+	assert.Equal(t, New(img, graph.KINGSGRAPH, ColorDistance).SegmentGBS(0.5, k, 5), labels)
+
+	/* The credit of HMSF merges the blocks of this image into few segments */
+	labels, minWeight := New(img, graph.KINGSGRAPH, ColorDistance).SegmentHMSFToCount(0.5, 3, 6)
+	assert.True(t, labels.Count >= 3 && labels.Count <= 6, "%d segments", labels.Count)
+	assert.Equal(t, New(img, graph.KINGSGRAPH, ColorDistance).SegmentHMSF(0.5, minWeight), labels)
+
+	parallel, parallelMinWeight := New(img, graph.KINGSGRAPH, ColorDistance).
+		SegmentPHMSFToCount(0.5, 3, 6)
+	assert.Equal(t, labels, parallel)
+	assert.Equal(t, minWeight, parallelMinWeight)
+}
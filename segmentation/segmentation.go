@@ -6,76 +6,395 @@
 package segmentation
 
 import (
-	"fmt"
+	"context"
+	"github.com/miguelfrde/image-segmentation/colorspace"
 	"github.com/miguelfrde/image-segmentation/disjointset"
+	"github.com/miguelfrde/image-segmentation/features"
 	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/miguelfrde/image-segmentation/palette"
+	"github.com/miguelfrde/image-segmentation/tracing"
 	"github.com/miguelfrde/imaging"
 	"image"
+	"io"
+	"log/slog"
 	"time"
 )
 
+/**
+ * Names of the phases of a segmentation
+ */
+const (
+	PHASE_NOISE    = "noise"
+	PHASE_BLUR     = "blur"
+	PHASE_CONVERT  = "convert"
+	PHASE_FEATURES = "features"
+	PHASE_GRAPH    = "graph"
+	PHASE_SEGMENT  = "segment"
+	PHASE_MERGE    = "merge"
+	PHASE_IMAGE    = "image"
+)
+
+/**
+ * Number of iterations between two progress reports inside a loop
+ */
+const PROGRESS_INTERVAL = 1 << 16
+
+/**
+ * Type of the functions that receive the progress of a segmentation.
+ * fraction goes from 0 when the phase starts to 1 when it finishes.
+ */
+type ProgressFn func(phase string, fraction float64)
+
+var phaseDescriptions = map[string]string{
+	PHASE_NOISE:    "estimate noise",
+	PHASE_BLUR:     "blur image",
+	PHASE_CONVERT:  "convert colors",
+	PHASE_FEATURES: "compute features",
+	PHASE_GRAPH:    "build graph",
+	PHASE_SEGMENT:  "segment",
+	PHASE_MERGE:    "merge regions",
+	PHASE_IMAGE:    "build image",
+}
+
+/**
+ * Error returned by the segmentation algorithms when one of their arguments
+ * is invalid, like a marker map of another size than the image. Argument is
+ * the name of the argument.
+ */
+type InvalidArgumentError struct {
+	Argument string
+	Message  string
+}
+
+func (err *InvalidArgumentError) Error() string {
+	return err.Message
+}
+
 /**
  * Type used to run all the segmentation algorithms.
- * It stores the graph, the resultset, the original image, the graph
- * obtained from the image and if it will generate a result image with
- * random colors.
+ * It stores the graph, the resultset, the original image, the image
+ * after smoothing, the graph obtained from the image and the renderer of
+ * the result images.
  */
 type Segmenter struct {
-	randomColors bool
+	renderer     Renderer
+	hierarchy    *Hierarchy
+	recordMerges bool
+	original     image.Image
 	img          image.Image
 	graph        *graph.Graph
 	resultset    *disjointset.DisjointSet
 	graphType    graph.GraphType
 	weightfn     graph.WeightFn
+	colorSpace   colorspace.Space
+	extractors   []features.Extractor
+	featureMap   *features.Map
+	timings      map[string]time.Duration
+	progress     ProgressFn
+	logger       *slog.Logger
+	tracer       tracing.Tracer
+	ctx          context.Context
+	running      runningPhase
+}
+
+/**
+ * Changes a setting of a Segmenter when it's created
+ */
+type Option func(*Segmenter)
+
+/**
+ * Logs the phases and the results of the segmentations to the given logger.
+ * Phase timings are logged with level debug. By default nothing is logged.
+ */
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Segmenter) {
+		s.logger = logger
+	}
+}
+
+/**
+ * Reports every phase of the segmentations as a span of the given tracer
+ */
+func WithTracer(tracer tracing.Tracer) Option {
+	return func(s *Segmenter) {
+		s.tracer = tracer
+	}
 }
 
 /**
  * Returns a new Segmenter, generates a graph of the given graph type from
  * the given image using the given weight function to compute the edge
- * weights.
+ * weights. The options change the default settings.
  */
 func New(img image.Image, graphType graph.GraphType,
-	weightfn graph.WeightFn) *Segmenter {
+	weightfn graph.WeightFn, opts ...Option) *Segmenter {
 	s := new(Segmenter)
-	s.randomColors = false
+	s.renderer = NewRenderer(RENDER_FILL)
+	s.original = img
 	s.img = img
 	s.weightfn = weightfn
 	s.graphType = graphType
+	s.timings = make(map[string]time.Duration)
+	s.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	s.tracer = tracing.Nop
+	s.ctx = context.Background()
+	for _, opt := range opts {
+		opt(s)
+	}
 	return s
 }
 
 func (s *Segmenter) smoothImage(sigma float64) {
-	fmt.Printf("blur image... ")
-	start := time.Now()
+	start := s.beginPhase(PHASE_BLUR)
 	s.img = imaging.Blur(s.img, sigma, 4)
-	fmt.Println(time.Since(start))
+	s.endPhase(PHASE_BLUR, start)
 }
 
+/**
+ * Builds the graph of the smoothed image. If a color space other than RGB
+ * was set, the image is converted to it first so that the weight function
+ * receives colorspace.Color pixels. If feature extractors were set, the
+ * feature map is attached to the image so that the weight function receives
+ * features.Color pixels.
+ */
 func (s *Segmenter) buildGraph() {
-	fmt.Printf("build graph... ")
-	start := time.Now()
-	s.graph = graph.FromImage(s.img, s.weightfn, s.graphType)
-	fmt.Println(time.Since(start))
+	img := s.img
+	if s.colorSpace != colorspace.RGB {
+		start := s.beginPhase(PHASE_CONVERT)
+		img = colorspace.ConvertImage(s.img, s.colorSpace)
+		s.endPhase(PHASE_CONVERT, start)
+	}
+	if len(s.extractors) > 0 {
+		if s.featureMap == nil {
+			start := s.beginPhase(PHASE_FEATURES)
+			s.featureMap = features.Compute(s.original, s.extractors...)
+			s.endPhase(PHASE_FEATURES, start)
+		}
+		img = s.featureMap.Attach(img)
+	}
+	start := s.beginPhase(PHASE_GRAPH)
+	g, err := graph.FromImageContext(s.ctx, img, s.weightfn, s.graphType)
+	if err != nil {
+		panic(&CanceledError{Phase: PHASE_GRAPH, Err: err})
+	}
+	s.graph = g
+	s.endPhase(PHASE_GRAPH, start)
+}
+
+/**
+ * A phase that is running: when it started and its span
+ */
+type runningPhase struct {
+	start time.Time
+	span  tracing.Span
+}
+
+/**
+ * Marks the beginning of a phase. Returns the running phase that must be
+ * given to endPhase. Stops the segmentation if it was canceled.
+ */
+func (s *Segmenter) beginPhase(phase string) runningPhase {
+	s.checkCanceled(phase)
+	s.reportProgress(phase, 0)
+	s.running = runningPhase{start: time.Now(), span: s.tracer.Start(phaseDescriptions[phase])}
+	return s.running
+}
+
+/**
+ * Marks the end of a running phase and adds its duration to the timings of
+ * the Segmenter
+ */
+func (s *Segmenter) endPhase(phase string, running runningPhase) {
+	elapsed := time.Since(running.start)
+	running.span.End()
+	s.running = runningPhase{}
+	s.timings[phase] += elapsed
+	s.logger.Debug("phase finished", "phase", phase, "duration", elapsed)
+	s.reportProgress(phase, 1)
+}
+
+/**
+ * Logs the number of regions found by the given algorithm
+ */
+func (s *Segmenter) logResult(algorithm string) {
+	s.logger.Info("segmentation finished", "algorithm", algorithm,
+		"components", s.resultset.Components())
+}
+
+/**
+ * Sets the function that will receive the progress of the segmentations.
+ * It's called from the goroutine that runs the segmentation.
+ */
+func (s *Segmenter) SetProgress(fn ProgressFn) {
+	s.progress = fn
+}
+
+func (s *Segmenter) reportProgress(phase string, fraction float64) {
+	if s.progress != nil {
+		s.progress(phase, fraction)
+	}
+}
+
+/**
+ * Reports the progress of the i-th iteration of a loop of total iterations
+ * that covers the part of the phase that goes from the fraction from to the
+ * fraction to. It only reports every PROGRESS_INTERVAL iterations, which is
+ * also when it stops the segmentation if it was canceled.
+ */
+func (s *Segmenter) loopProgress(phase string, i, total int, from, to float64) {
+	if i%PROGRESS_INTERVAL != 0 {
+		return
+	}
+	s.checkCanceled(phase)
+	if s.progress != nil {
+		s.progress(phase, from+(to-from)*float64(i)/float64(total))
+	}
+}
+
+/**
+ * Returns the total time spent in each phase by all the segmentations that
+ * the Segmenter has run, indexed by phase name
+ */
+func (s *Segmenter) GetTimings() map[string]time.Duration {
+	timings := make(map[string]time.Duration, len(s.timings))
+	for phase, elapsed := range s.timings {
+		timings[phase] = elapsed
+	}
+	return timings
+}
+
+/**
+ * Initializes the result set where every pixel is its own region and, if
+ * merges are being recorded, an empty hierarchy.
+ */
+func (s *Segmenter) newResultSet() {
+	s.resultset = disjointset.New(s.graph.TotalVertices())
+	s.hierarchy = nil
+	if s.recordMerges {
+		s.hierarchy = newHierarchy(s.graph.Width(), s.graph.Height())
+	}
+}
+
+/**
+ * Merges the regions to which u and v belong because of an edge with the
+ * given weight. If merges are being recorded, the union is added to the
+ * hierarchy unless the algorithm doesn't build one, like SLIC.
+ * Returns the root of the resulting region.
+ */
+func (s *Segmenter) union(u, v int, weight float64) int {
+	if s.hierarchy != nil && !s.resultset.Connected(u, v) {
+		s.hierarchy.record(u, v, weight)
+	}
+	return s.resultset.Union(u, v)
+}
+
+/**
+ * Completes the hierarchy, if merges are being recorded, with the given
+ * edges sorted by weight once the algorithm has performed all its merges
+ */
+func (s *Segmenter) completeHierarchy(edges graph.EdgeList) {
+	if s.hierarchy != nil {
+		s.hierarchy.complete(edges)
+	}
+}
+
+/**
+ * Sets if the graph based algorithms should record the complete merge
+ * hierarchy of the next segmentations
+ */
+func (s *Segmenter) SetRecordHierarchy(val bool) {
+	s.recordMerges = val
+}
+
+/**
+ * Returns the merge hierarchy of the last segmentation. Returns nil if it
+ * wasn't recorded or no segmentation algorithm has been executed before.
+ */
+func (s *Segmenter) GetHierarchy() *Hierarchy {
+	return s.hierarchy
+}
+
+/**
+ * Sets the color space to which the image is converted before building the
+ * graph of the graph based algorithms. It's RGB by default, which means no
+ * conversion. Use it with ColorDistance or CIEDE2000Weight.
+ */
+func (s *Segmenter) SetColorSpace(space colorspace.Space) {
+	s.colorSpace = space
+}
+
+/**
+ * Sets the extractors of the per pixel feature vectors used by FeatureDistance
+ * and TextureWeight. Features are computed from the original image, because
+ * smoothing destroys texture, the first time a graph is built and reused by
+ * the following segmentations.
+ */
+func (s *Segmenter) SetFeatures(extractors ...features.Extractor) {
+	s.extractors = extractors
+	s.featureMap = nil
 }
 
 /**
  * Sets the random color attribute to true or false according to val
  */
 func (s *Segmenter) SetRandomColors(val bool) {
-	s.randomColors = val
+	s.renderer.RandomColors = val
+}
+
+/**
+ * Sets the palette that chooses the random colors of the result images
+ */
+func (s *Segmenter) SetPalette(p palette.Palette) {
+	s.renderer.Palette = p
 }
 
 /**
- * Returns the result image. Returns nil if no segmentation algorithm
- * has been executed before.
+ * Sets the renderer of the result images, which also decides whether they
+ * use random colors
+ */
+func (s *Segmenter) SetRenderer(renderer Renderer) {
+	s.renderer = renderer
+}
+
+/**
+ * Returns the renderer of the result images
+ */
+func (s *Segmenter) GetRenderer() Renderer {
+	return s.renderer
+}
+
+/**
+ * Returns the result image drawn by the renderer. Segments are filled with
+ * the mean colors of the smoothed image and the other modes draw over the
+ * original one. Returns nil if no segmentation algorithm has been executed
+ * before or the label map doesn't have the size of the image, see
+ * Renderer.Render.
  */
 func (s *Segmenter) GetResultImage() image.Image {
 	if s.resultset == nil {
 		return nil
 	}
-	fmt.Printf("build image... ")
-	start := time.Now()
-	resultimg := imageFromDisjointSet(s.resultset, s.img, s.randomColors)
-	fmt.Println(time.Since(start))
+	start := s.beginPhase(PHASE_IMAGE)
+	img := s.original
+	if s.renderer.Mode == RENDER_FILL {
+		img = s.img
+	}
+	resultimg, err := s.renderer.Render(s.GetLabels(), img)
+	s.endPhase(PHASE_IMAGE, start)
+	if err != nil {
+		s.logger.Error("could not render the result image", "error", err)
+		return nil
+	}
 	return resultimg
 }
+
+/**
+ * Returns the label map of the last segmentation. Returns nil if no
+ * segmentation algorithm has been executed before.
+ */
+func (s *Segmenter) GetLabels() *Labels {
+	if s.resultset == nil {
+		return nil
+	}
+	return LabelsFromDisjointSet(s.resultset, s.img.Bounds().Max.X, s.img.Bounds().Max.Y)
+}
@@ -0,0 +1,218 @@
+package segmentation
+
+import (
+	"context"
+	"fmt"
+	"github.com/miguelfrde/image-segmentation/colorspace"
+	"github.com/miguelfrde/image-segmentation/disjointset"
+	"github.com/miguelfrde/image-segmentation/utils"
+	"math"
+)
+
+/**
+ * Number of k-means iterations performed by SLIC. The paper reports that
+ * 10 iterations are enough for most images.
+ */
+const SLIC_ITERATIONS = 10
+
+/**
+ * Center of a SLIC cluster in the labxy space
+ */
+type slicCenter struct {
+	l, a, b, x, y float64
+}
+
+/**
+ * Performs the image segmentation using the "Simple Linear Iterative
+ * Clustering" superpixel algorithm. numSuperpixels is the approximate number
+ * of superpixels to generate and compactness weights the spatial distance
+ * against the color distance (usual values are between 1 and 40).
+ * Returns the label map of the resulting segmentation, or nil if
+ * numSuperpixels isn't positive.
+ * For more information on this algorithm refer to:
+ * http://infoscience.epfl.ch/record/177415/files/Superpixel_PAMI2011-2.pdf
+ */
+func (s *Segmenter) SegmentSLIC(numSuperpixels int, compactness float64) *Labels {
+	labels, _ := s.SegmentSLICContext(context.Background(), numSuperpixels, compactness)
+	return labels
+}
+
+/**
+ * Same as SegmentSLIC but it stops as soon as ctx is done, in which case it
+ * returns a *CanceledError. Returns an error if numSuperpixels isn't
+ * positive.
+ */
+func (s *Segmenter) SegmentSLICContext(ctx context.Context, numSuperpixels int,
+	compactness float64) (labels *Labels, err error) {
+	if err := checkSuperpixels(numSuperpixels); err != nil {
+		return nil, err
+	}
+	defer s.withContext(ctx)(&err)
+	width, height := s.img.Bounds().Max.X, s.img.Bounds().Max.Y
+	start := s.beginPhase(PHASE_CONVERT)
+	lab := colorspace.ConvertImage(s.img, colorspace.LAB).Values
+	s.endPhase(PHASE_CONVERT, start)
+
+	start = s.beginPhase(PHASE_SEGMENT)
+	s.slicSegment(lab, width, height, numSuperpixels, compactness)
+	s.endPhase(PHASE_SEGMENT, start)
+	s.logResult("slic")
+	return s.GetLabels(), nil
+}
+
+/**
+ * Returns an error if SLIC can't generate the given number of superpixels
+ */
+func checkSuperpixels(numSuperpixels int) error {
+	if numSuperpixels < 1 {
+		return &InvalidArgumentError{Argument: "superpixels", Message: fmt.Sprintf(
+			"the number of superpixels must be positive, got %d", numSuperpixels)}
+	}
+	return nil
+}
+
+/**
+ * Runs SLIC on the given CIELAB values of a width x height image and leaves
+ * the result in the result set
+ */
+func (s *Segmenter) slicSegment(lab [][3]float64, width, height, numSuperpixels int,
+	compactness float64) {
+	step := int(math.Sqrt(float64(width*height) / float64(numSuperpixels)))
+	if step < 1 {
+		step = 1
+	}
+	centers := slicSeedCenters(lab, width, height, step)
+	assignments := s.slicCluster(lab, width, height, step, compactness, centers)
+	s.resultset = slicEnforceConnectivity(assignments, width, height, step*step/4)
+	s.hierarchy = nil
+}
+
+/**
+ * Places the initial cluster centers on a regular grid with the given step
+ * and moves each one of them to the lowest gradient position in its 3x3
+ * neighborhood to avoid seeding them on an edge. The first row and column
+ * of the grid are kept inside the image, so there's always a center even
+ * if the image is thinner than half a step.
+ */
+func slicSeedCenters(lab [][3]float64, width, height, step int) []slicCenter {
+	gradient := func(x, y int) float64 {
+		if x < 1 || y < 1 || x+1 >= width || y+1 >= height {
+			return math.Inf(1)
+		}
+		g := 0.0
+		for c := 0; c < 3; c++ {
+			dx := lab[x+1+y*width][c] - lab[x-1+y*width][c]
+			dy := lab[x+(y+1)*width][c] - lab[x+(y-1)*width][c]
+			g += dx*dx + dy*dy
+		}
+		return g
+	}
+
+	centers := make([]slicCenter, 0, (width/step+1)*(height/step+1))
+	for y := utils.MinI(step/2, height-1); y < height; y += step {
+		for x := utils.MinI(step/2, width-1); x < width; x += step {
+			bestX, bestY := x, y
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if gradient(x+dx, y+dy) < gradient(bestX, bestY) {
+						bestX, bestY = x+dx, y+dy
+					}
+				}
+			}
+			c := lab[bestX+bestY*width]
+			centers = append(centers, slicCenter{l: c[0], a: c[1], b: c[2],
+				x: float64(bestX), y: float64(bestY)})
+		}
+	}
+	return centers
+}
+
+/**
+ * Runs the k-means iterations of SLIC. Each center only competes for the
+ * pixels in a 2S x 2S window around it. Returns the index of the center
+ * assigned to each pixel.
+ */
+func (s *Segmenter) slicCluster(lab [][3]float64, width, height, step int, compactness float64,
+	centers []slicCenter) []int {
+	assignments := make([]int, width*height, width*height)
+	distances := make([]float64, width*height, width*height)
+	spatialFactor := (compactness * compactness) / float64(step*step)
+
+	for iteration := 0; iteration < SLIC_ITERATIONS; iteration++ {
+		s.reportProgress(PHASE_SEGMENT, float64(iteration)/SLIC_ITERATIONS)
+		for p := range distances {
+			distances[p] = math.Inf(1)
+		}
+		for i, center := range centers {
+			s.checkCanceled(PHASE_SEGMENT)
+			minX, maxX := int(center.x)-step, int(center.x)+step
+			minY, maxY := int(center.y)-step, int(center.y)+step
+			for y := utils.MaxI(minY, 0); y < utils.MinI(maxY+1, height); y++ {
+				for x := utils.MaxI(minX, 0); x < utils.MinI(maxX+1, width); x++ {
+					p := x + y*width
+					dl, da, db := lab[p][0]-center.l, lab[p][1]-center.a, lab[p][2]-center.b
+					dx, dy := float64(x)-center.x, float64(y)-center.y
+					d := dl*dl + da*da + db*db + (dx*dx+dy*dy)*spatialFactor
+					if d < distances[p] {
+						distances[p] = d
+						assignments[p] = i
+					}
+				}
+			}
+		}
+
+		sums := make([]slicCenter, len(centers), len(centers))
+		counts := make([]int, len(centers), len(centers))
+		for p, i := range assignments {
+			sums[i].l += lab[p][0]
+			sums[i].a += lab[p][1]
+			sums[i].b += lab[p][2]
+			sums[i].x += float64(p % width)
+			sums[i].y += float64(p / width)
+			counts[i]++
+		}
+		for i := range centers {
+			if counts[i] > 0 {
+				n := float64(counts[i])
+				centers[i] = slicCenter{l: sums[i].l / n, a: sums[i].a / n, b: sums[i].b / n,
+					x: sums[i].x / n, y: sums[i].y / n}
+			}
+		}
+	}
+	return assignments
+}
+
+/**
+ * k-means does not guarantee that the pixels of a cluster are connected.
+ * Builds a disjoint set where each connected group of pixels with the same
+ * cluster is a component and then merges the components with less than
+ * minSize pixels into an adjacent one.
+ */
+func slicEnforceConnectivity(assignments []int, width, height, minSize int) *disjointset.DisjointSet {
+	set := disjointset.New(width * height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := x + y*width
+			if x+1 < width && assignments[p] == assignments[p+1] {
+				set.Union(p, p+1)
+			}
+			if y+1 < height && assignments[p] == assignments[p+width] {
+				set.Union(p, p+width)
+			}
+		}
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := x + y*width
+			for _, n := range [2]int{p + 1, p + width} {
+				if (n == p+1 && x+1 >= width) || n >= width*height {
+					continue
+				}
+				if !set.Connected(p, n) && (set.Size(p) < minSize || set.Size(n) < minSize) {
+					set.Union(p, n)
+				}
+			}
+		}
+	}
+	return set
+}
@@ -0,0 +1,95 @@
+package segmentation
+
+import (
+	"context"
+	"github.com/miguelfrde/image-segmentation/disjointset"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+/**
+ * Returns the number of 4-connected components of pixels with the same label
+ */
+func countComponents(labels *Labels) int {
+	set := disjointset.New(labels.Width * labels.Height)
+	for y := 0; y < labels.Height; y++ {
+		for x := 0; x < labels.Width; x++ {
+			p := x + y*labels.Width
+			if x+1 < labels.Width && labels.Ids[p] == labels.Ids[p+1] {
+				set.Union(p, p+1)
+			}
+			if y+1 < labels.Height && labels.Ids[p] == labels.Ids[p+labels.Width] {
+				set.Union(p, p+labels.Width)
+			}
+		}
+	}
+	return set.Components()
+}
+
+/*
+ * Tests
+ */
+
+func TestSLICSegmentsAreConnected(t *testing.T) {
+	img := noisyBlocksImage(60, 40, 5)
+	for _, superpixels := range []int{1, 6, 24, 100} {
+		labels := New(img, graph.GRIDGRAPH, ColorDistance).SegmentSLIC(superpixels, 10)
+		assert.Equal(t, 60, labels.Width)
+		assert.Equal(t, 40, labels.Height)
+		assert.Equal(t, labels.Count, countComponents(labels), "%d superpixels", superpixels)
+		assert.True(t, labels.Count >= superpixels/2 && labels.Count <= 2*superpixels,
+			"%d superpixels gave %d segments", superpixels, labels.Count)
+	}
+}
+
+func TestSLICFollowsColorEdges(t *testing.T) {
+	/* Left half black and right half white, the edge isn't on the grid of centers */
+	img := image.NewGray(image.Rect(0, 0, 40, 40))
+	for y := 0; y < 40; y++ {
+		for x := 17; x < 40; x++ {
+			img.SetGray(x, y, color.Gray{255})
+		}
+	}
+	labels := New(img, graph.GRIDGRAPH, ColorDistance).SegmentSLIC(16, 10)
+	for y := 0; y < 40; y++ {
+		assert.NotEqual(t, labels.At(16, y), labels.At(17, y), "row %d", y)
+	}
+}
+
+func TestSLICIsDeterministic(t *testing.T) {
+	img := noisyBlocksImage(30, 30, 6)
+	assert.Equal(t, New(img, graph.GRIDGRAPH, ColorDistance).SegmentSLIC(20, 5),
+		New(img, graph.GRIDGRAPH, ColorDistance).SegmentSLIC(20, 5))
+}
+
+func TestSLICRejectsNonPositiveSuperpixels(t *testing.T) {
+	img := noisyBlocksImage(10, 10, 7)
+	for _, superpixels := range []int{0, -3} {
+		s := New(img, graph.GRIDGRAPH, ColorDistance)
+		assert.Nil(t, s.SegmentSLIC(superpixels, 10))
+		_, err := s.SweepSLICContext(context.Background(), []int{4, superpixels}, []float64{10})
+		assert.NotNil(t, err)
+	}
+}
+
+func TestSLICOnThinAndSmallImages(t *testing.T) {
+	for _, size := range [][2]int{{1, 100}, {100, 1}, {3, 40}, {40, 3}, {1, 1}, {2, 2}, {5, 300}} {
+		img := noisyBlocksImage(size[0], size[1], 6)
+		for _, superpixels := range []int{1, 2, 7, 1000} {
+			labels, err := New(img, graph.GRIDGRAPH, ColorDistance).
+				SegmentSLICContext(context.Background(), superpixels, 10)
+			assert.Nil(t, err, "%v, %d superpixels", size, superpixels)
+			assert.Equal(t, size[0]*size[1], len(labels.Ids))
+			assert.True(t, labels.Count >= 1)
+			assert.Equal(t, labels.Count, countComponents(labels), "%v, %d superpixels",
+				size, superpixels)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package segmentation
+
+import (
+	"context"
+	"github.com/miguelfrde/image-segmentation/colorspace"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"image"
+	"runtime"
+)
+
+/**
+ * A setting of a parameter sweep and the result of the segmentation with
+ * it. Parameters that the algorithm doesn't use are 0.
+ */
+type SweepResult struct {
+	Sigma       float64     `json:"sigma,omitempty"`
+	K           float64     `json:"k,omitempty"`
+	MinSize     int         `json:"minsize,omitempty"`
+	MinWeight   float64     `json:"minweight,omitempty"`
+	Superpixels int         `json:"superpixels,omitempty"`
+	Compactness float64     `json:"compactness,omitempty"`
+	Segments    int         `json:"segments"`
+	Labels      *Labels     `json:"-"`
+	Image       image.Image `json:"-"`
+}
+
+/**
+ * Runs GBS with every combination of the given sigmas, ks and minimum sizes.
+ * The image is smoothed and the graph built and sorted once per sigma. Every
+ * setting gives the same result as running it on a new Segmenter. Returns
+ * the results in the order of the sigmas, then ks and then minimum sizes.
+ */
+func (s *Segmenter) SweepGBS(sigmas, ks []float64, minSizes []int) []SweepResult {
+	results, _ := s.SweepGBSContext(context.Background(), sigmas, ks, minSizes)
+	return results
+}
+
+/**
+ * Same as SweepGBS but it stops as soon as ctx is done, in which case it
+ * returns a *CanceledError.
+ */
+func (s *Segmenter) SweepGBSContext(ctx context.Context, sigmas, ks []float64,
+	minSizes []int) (results []SweepResult, err error) {
+	defer s.withContext(ctx)(&err)
+	progress := s.progress
+	defer s.SetProgress(progress)
+	total := len(sigmas) * len(ks) * len(minSizes)
+	for _, sigma := range sigmas {
+		s.sweepProgress(progress, len(results), total)
+		s.sweepGraph(sigma)
+		edges := s.sortedEdges()
+		for _, k := range ks {
+			for _, minSize := range minSizes {
+				s.sweepProgress(progress, len(results), total)
+				start := s.beginPhase(PHASE_SEGMENT)
+				s.gbsSegment(edges, k, minSize)
+				s.endPhase(PHASE_SEGMENT, start)
+				results = append(results, s.sweepResult(SweepResult{Sigma: sigma, K: k,
+					MinSize: minSize}))
+			}
+		}
+	}
+	s.logger.Info("sweep finished", "algorithm", "gbs", "settings", len(results))
+	return results, nil
+}
+
+/**
+ * Runs HMSF with every combination of the given sigmas and minimum weights.
+ * The noise is estimated once and the image is smoothed and the graph built
+ * and sorted once per sigma. Every setting gives the same result as running
+ * it on a new Segmenter. Returns the results in the order of the sigmas and
+ * then minimum weights.
+ */
+func (s *Segmenter) SweepHMSF(sigmas, minWeights []float64) []SweepResult {
+	results, _ := s.SweepHMSFContext(context.Background(), sigmas, minWeights)
+	return results
+}
+
+/**
+ * Same as SweepHMSF but it stops as soon as ctx is done, in which case it
+ * returns a *CanceledError.
+ */
+func (s *Segmenter) SweepHMSFContext(ctx context.Context, sigmas,
+	minWeights []float64) (results []SweepResult, err error) {
+	defer s.withContext(ctx)(&err)
+	return s.sweepHMSF(sigmas, minWeights, false), nil
+}
+
+/**
+ * Same as SweepHMSF but using the parallel version of HMSF
+ */
+func (s *Segmenter) SweepPHMSF(sigmas, minWeights []float64) []SweepResult {
+	results, _ := s.SweepPHMSFContext(context.Background(), sigmas, minWeights)
+	return results
+}
+
+/**
+ * Same as SweepPHMSF but it stops as soon as ctx is done, in which case it
+ * returns a *CanceledError.
+ */
+func (s *Segmenter) SweepPHMSFContext(ctx context.Context, sigmas,
+	minWeights []float64) (results []SweepResult, err error) {
+	defer s.withContext(ctx)(&err)
+	return s.sweepHMSF(sigmas, minWeights, true), nil
+}
+
+func (s *Segmenter) sweepHMSF(sigmas, minWeights []float64, parallel bool) []SweepResult {
+	progress := s.progress
+	defer s.SetProgress(progress)
+	total := len(sigmas) * len(minWeights)
+	s.sweepProgress(progress, 0, total)
+	s.img = s.original
+	noise := s.estimateNoise()
+	results := make([]SweepResult, 0, total)
+	for _, sigma := range sigmas {
+		s.sweepProgress(progress, len(results), total)
+		s.sweepGraph(sigma)
+		var edges graph.EdgeList
+		var tiles []tile
+		if parallel {
+			start := s.beginPhase(PHASE_SEGMENT)
+			tiles = s.phmsfTiles(runtime.NumCPU())
+			edges = sortTiles(tiles)
+			s.endPhase(PHASE_SEGMENT, start)
+		} else {
+			edges = s.sortedEdges()
+		}
+		for _, minWeight := range minWeights {
+			s.sweepProgress(progress, len(results), total)
+			start := s.beginPhase(PHASE_SEGMENT)
+			if parallel {
+				s.phmsfSegment(tiles, edges, minWeight, noise)
+			} else {
+				s.hmsfSegment(edges, minWeight, noise)
+			}
+			s.endPhase(PHASE_SEGMENT, start)
+			results = append(results, s.sweepResult(SweepResult{Sigma: sigma,
+				MinWeight: minWeight}))
+		}
+	}
+	algorithm := "hmsf"
+	if parallel {
+		algorithm = "phmsf"
+	}
+	s.logger.Info("sweep finished", "algorithm", algorithm, "settings", len(results))
+	return results
+}
+
+/**
+ * Runs SLIC with every combination of the given numbers of superpixels and
+ * compactness values. The image is converted to CIELAB once. Returns the
+ * results in the order of the numbers of superpixels and then compactness
+ * values, or nil if any number of superpixels isn't positive.
+ */
+func (s *Segmenter) SweepSLIC(superpixels []int, compactness []float64) []SweepResult {
+	results, _ := s.SweepSLICContext(context.Background(), superpixels, compactness)
+	return results
+}
+
+/**
+ * Same as SweepSLIC but it stops as soon as ctx is done, in which case it
+ * returns a *CanceledError. Returns an error if any number of superpixels
+ * isn't positive.
+ */
+func (s *Segmenter) SweepSLICContext(ctx context.Context, superpixels []int,
+	compactness []float64) (results []SweepResult, err error) {
+	for _, n := range superpixels {
+		if err := checkSuperpixels(n); err != nil {
+			return nil, err
+		}
+	}
+	defer s.withContext(ctx)(&err)
+	progress := s.progress
+	defer s.SetProgress(progress)
+	total := len(superpixels) * len(compactness)
+	s.sweepProgress(progress, 0, total)
+	s.img = s.original
+	width, height := s.img.Bounds().Max.X, s.img.Bounds().Max.Y
+	start := s.beginPhase(PHASE_CONVERT)
+	lab := colorspace.ConvertImage(s.img, colorspace.LAB).Values
+	s.endPhase(PHASE_CONVERT, start)
+	for _, n := range superpixels {
+		for _, c := range compactness {
+			s.sweepProgress(progress, len(results), total)
+			start := s.beginPhase(PHASE_SEGMENT)
+			s.slicSegment(lab, width, height, n, c)
+			s.endPhase(PHASE_SEGMENT, start)
+			results = append(results, s.sweepResult(SweepResult{Superpixels: n, Compactness: c}))
+		}
+	}
+	s.logger.Info("sweep finished", "algorithm", "slic", "settings", len(results))
+	return results, nil
+}
+
+/**
+ * Smooths the original image with the given sigma and builds its graph
+ */
+func (s *Segmenter) sweepGraph(sigma float64) {
+	s.img = s.original
+	s.smoothImage(sigma)
+	s.buildGraph()
+}
+
+/**
+ * Returns the edges of the graph sorted by weight
+ */
+func (s *Segmenter) sortedEdges() graph.EdgeList {
+	start := s.beginPhase(PHASE_SEGMENT)
+	edges := s.graph.Edges()
+	s.sortEdges(edges)
+	s.endPhase(PHASE_SEGMENT, start)
+	return edges
+}
+
+/**
+ * Makes the progress of the next phases be reported to the function
+ * progress as the part of the sweep that corresponds to the i-th of total
+ * settings
+ */
+func (s *Segmenter) sweepProgress(progress ProgressFn, i, total int) {
+	if progress == nil {
+		return
+	}
+	s.progress = func(phase string, fraction float64) {
+		progress(phase, (float64(i)+fraction)/float64(total))
+	}
+}
+
+/**
+ * Returns the given setting with the segment count, the label map and the
+ * result image of the last segmentation
+ */
+func (s *Segmenter) sweepResult(setting SweepResult) SweepResult {
+	setting.Labels = s.GetLabels()
+	setting.Segments = setting.Labels.Count
+	setting.Image = s.GetResultImage()
+	s.logger.Debug("sweep setting finished", "segments", setting.Segments)
+	return setting
+}
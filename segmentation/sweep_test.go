@@ -0,0 +1,70 @@
+package segmentation
+
+import (
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+/**
+ * Returns a new segmenter of the sweep test image
+ */
+func sweepSegmenter() *Segmenter {
+	s := New(noisyBlocksImage(30, 20, 18), graph.KINGSGRAPH, ColorDistance)
+	s.SetRenderer(NewRenderer(RENDER_BLEND))
+	return s
+}
+
+/**
+ * Asserts that the result of a sweep is the one of the same segmentation run
+ * by a new segmenter
+ */
+func assertFreshResult(t *testing.T, result SweepResult, fresh *Segmenter, labels *Labels) {
+	assert.Equal(t, labels, result.Labels, "%+v", result)
+	assert.Equal(t, labels.Count, result.Segments)
+	assert.Equal(t, fresh.GetResultImage(), result.Image, "%+v", result)
+}
+
+/*
+ * Tests
+ */
+
+func TestSweepGBSEqualsFreshSegmentations(t *testing.T) {
+	results := sweepSegmenter().SweepGBS([]float64{0.5, 1}, []float64{50, 300}, []int{5, 40})
+	assert.Equal(t, 8, len(results))
+	for _, result := range results {
+		fresh := sweepSegmenter()
+		assertFreshResult(t, result, fresh, fresh.SegmentGBS(result.Sigma, result.K, result.MinSize))
+	}
+	assert.Equal(t, SweepResult{Sigma: 0.5, K: 300, MinSize: 5}, SweepResult{Sigma: results[2].Sigma,
+		K: results[2].K, MinSize: results[2].MinSize})
+}
+
+func TestSweepHMSFEqualsFreshSegmentations(t *testing.T) {
+	sigmas, minWeights := []float64{0.5, 1}, []float64{2, 6, 20}
+	results := sweepSegmenter().SweepHMSF(sigmas, minWeights)
+	parallel := sweepSegmenter().SweepPHMSF(sigmas, minWeights)
+	assert.Equal(t, 6, len(results))
+	assert.Equal(t, 6, len(parallel))
+	for i, result := range results {
+		fresh := sweepSegmenter()
+		assertFreshResult(t, result, fresh, fresh.SegmentHMSF(result.Sigma, result.MinWeight))
+		fresh = sweepSegmenter()
+		assertFreshResult(t, parallel[i], fresh, fresh.SegmentPHMSF(result.Sigma, result.MinWeight))
+	}
+	assert.Equal(t, 1.0, results[3].Sigma)
+	assert.Equal(t, 2.0, results[3].MinWeight)
+}
+
+func TestSweepSLICEqualsFreshSegmentations(t *testing.T) {
+	results := sweepSegmenter().SweepSLIC([]int{10, 40}, []float64{5, 20})
+	assert.Equal(t, 4, len(results))
+	for _, result := range results {
+		fresh := sweepSegmenter()
+		assertFreshResult(t, result, fresh, fresh.SegmentSLIC(result.Superpixels, result.Compactness))
+	}
+}
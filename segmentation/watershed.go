@@ -0,0 +1,191 @@
+package segmentation
+
+import (
+	"container/heap"
+	"context"
+	"github.com/miguelfrde/image-segmentation/disjointset"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"image"
+	"image/color"
+)
+
+/**
+ * Id given to the pixels of a marker map that don't belong to any marker
+ */
+const UNLABELED = -1
+
+/**
+ * Priority queue of edges, the lightest edge is always on top.
+ * It can be used with container/heap.
+ */
+type edgeQueue struct {
+	graph.EdgeList
+}
+
+func (q *edgeQueue) Push(edge interface{}) {
+	q.EdgeList = append(q.EdgeList, edge.(graph.Edge))
+}
+
+func (q *edgeQueue) Pop() interface{} {
+	n := len(q.EdgeList)
+	edge := q.EdgeList[n-1]
+	q.EdgeList = q.EdgeList[:n-1]
+	return edge
+}
+
+/**
+ * Returns a marker map from the given seed image. Every distinct color is a
+ * different marker and black or transparent pixels are UNLABELED. The alpha
+ * of the other pixels is ignored.
+ */
+func MarkersFromImage(img image.Image) *Labels {
+	width, height := img.Bounds().Max.X, img.Bounds().Max.Y
+	markers := NewLabels(width, height)
+	ids := make(map[color.NRGBA]int)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A == 0 || (c.R == 0 && c.G == 0 && c.B == 0) {
+				markers.Ids[x+y*width] = UNLABELED
+				continue
+			}
+			c.A = 255
+			id, ok := ids[c]
+			if !ok {
+				id = len(ids)
+				ids[c] = id
+			}
+			markers.Ids[x+y*width] = id
+		}
+	}
+	markers.Count = len(ids)
+	return markers
+}
+
+/**
+ * Performs a marker-controlled watershed segmentation over the edges of the
+ * graph. Regions are flooded from the markers following the edges in order
+ * of increasing weight, two regions that contain different markers are never
+ * merged. If markers is nil, one marker is created for each regional minimum
+ * of the image gradient.
+ * Returns the label map of the resulting segmentation, or nil if the marker
+ * map doesn't have the size of the image.
+ */
+func (s *Segmenter) SegmentWatershed(markers *Labels) *Labels {
+	labels, _ := s.SegmentWatershedContext(context.Background(), markers)
+	return labels
+}
+
+/**
+ * Same as SegmentWatershed but it stops as soon as ctx is done, in which case it
+ * returns a *CanceledError. Returns an error if the marker map doesn't have
+ * the size of the image.
+ */
+func (s *Segmenter) SegmentWatershedContext(ctx context.Context,
+	markers *Labels) (labels *Labels, err error) {
+	if markers != nil {
+		bounds := s.img.Bounds()
+		if err := markers.checkSize("markers", bounds.Max.X, bounds.Max.Y); err != nil {
+			return nil, err
+		}
+	}
+	defer s.withContext(ctx)(&err)
+	s.buildGraph()
+	if markers == nil {
+		markers = s.regionalMinimaMarkers()
+	}
+
+	start := s.beginPhase(PHASE_SEGMENT)
+	s.newResultSet()
+	seeds := make([]int, s.graph.TotalVertices(), s.graph.TotalVertices())
+	copy(seeds, markers.Ids)
+
+	queue := &edgeQueue{make(graph.EdgeList, len(s.graph.Edges()))}
+	copy(queue.EdgeList, s.graph.Edges())
+	heap.Init(queue)
+	total := queue.Len()
+	sorted := make(graph.EdgeList, 0, total)
+	for queue.Len() > 0 {
+		s.loopProgress(PHASE_SEGMENT, total-queue.Len(), total, 0, 1)
+		edge := heap.Pop(queue).(graph.Edge)
+		s.seededUnion(seeds, edge.U(), edge.V(), edge.Weight())
+		sorted = append(sorted, edge)
+	}
+	s.completeHierarchy(sorted)
+	s.endPhase(PHASE_SEGMENT, start)
+	s.logResult("watershed")
+	return s.GetLabels(), nil
+}
+
+/**
+ * Merges the regions to which u and v belong unless they contain different
+ * seeds. seeds stores the seed of each region indexed by its root, it's
+ * updated so that the new root keeps the seed of the merged regions. weight
+ * is the weight of the edge that caused the merge.
+ * Returns true if the regions were merged.
+ */
+func (s *Segmenter) seededUnion(seeds []int, u, v int, weight float64) bool {
+	u, v = s.resultset.Find(u), s.resultset.Find(v)
+	if u == v {
+		return false
+	}
+	seed := seeds[u]
+	if seed == UNLABELED {
+		seed = seeds[v]
+	} else if seeds[v] != UNLABELED && seeds[v] != seed {
+		return false
+	}
+	seeds[s.union(u, v, weight)] = seed
+	return true
+}
+
+/**
+ * Computes the gradient of each pixel as the weight of its heaviest edge and
+ * returns a marker map with a marker for each regional minimum of it, that is,
+ * each plateau of connected pixels with the same gradient whose neighbors all
+ * have a bigger one.
+ */
+func (s *Segmenter) regionalMinimaMarkers() *Labels {
+	gradient := make([]float64, s.graph.TotalVertices(), s.graph.TotalVertices())
+	for _, edge := range s.graph.Edges() {
+		if edge.Weight() > gradient[edge.U()] {
+			gradient[edge.U()] = edge.Weight()
+		}
+		if edge.Weight() > gradient[edge.V()] {
+			gradient[edge.V()] = edge.Weight()
+		}
+	}
+
+	plateaus := disjointset.New(s.graph.TotalVertices())
+	for _, edge := range s.graph.Edges() {
+		if gradient[edge.U()] == gradient[edge.V()] {
+			plateaus.Union(edge.U(), edge.V())
+		}
+	}
+	notMinimum := make([]bool, s.graph.TotalVertices(), s.graph.TotalVertices())
+	for _, edge := range s.graph.Edges() {
+		if gradient[edge.U()] < gradient[edge.V()] {
+			notMinimum[plateaus.Find(edge.V())] = true
+		} else if gradient[edge.V()] < gradient[edge.U()] {
+			notMinimum[plateaus.Find(edge.U())] = true
+		}
+	}
+
+	markers := NewLabels(s.graph.Width(), s.graph.Height())
+	ids := make(map[int]int)
+	for v := range markers.Ids {
+		root := plateaus.Find(v)
+		if notMinimum[root] {
+			markers.Ids[v] = UNLABELED
+			continue
+		}
+		id, ok := ids[root]
+		if !ok {
+			id = len(ids)
+			ids[root] = id
+		}
+		markers.Ids[v] = id
+	}
+	markers.Count = len(ids)
+	return markers
+}
@@ -0,0 +1,122 @@
+package segmentation
+
+import (
+	"context"
+	"github.com/miguelfrde/image-segmentation/graph"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+/**
+ * Returns a width x height image whose columns before edge are dark and the
+ * rest bright, with a slight horizontal gradient on both sides
+ */
+func twoHalvesImage(width, height, edge int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			value := uint8(20 + x)
+			if x >= edge {
+				value = uint8(200 + x - edge)
+			}
+			img.SetGray(x, y, color.Gray{value})
+		}
+	}
+	return img
+}
+
+/**
+ * Returns a width x height marker map without any marker
+ */
+func emptyMarkers(width, height int) *Labels {
+	markers := NewLabels(width, height)
+	for p := range markers.Ids {
+		markers.Ids[p] = UNLABELED
+	}
+	markers.Count = 0
+	return markers
+}
+
+/*
+ * Tests
+ */
+
+func TestMarkersFromImage(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	img.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	img.SetNRGBA(2, 0, color.NRGBA{0, 0, 255, 128})
+	img.SetNRGBA(0, 1, color.NRGBA{255, 0, 0, 10})
+	img.SetNRGBA(1, 1, color.NRGBA{0, 0, 0, 255})
+	markers := MarkersFromImage(img)
+	assert.Equal(t, 2, markers.Count)
+	assert.Equal(t, []int{0, UNLABELED, 1, 0, UNLABELED, UNLABELED}, markers.Ids)
+}
+
+func TestWatershedFloodsFromMarkers(t *testing.T) {
+	markers := emptyMarkers(12, 5)
+	markers.Ids[0] = 0
+	markers.Ids[11+4*12] = 1
+	markers.Count = 2
+	labels := New(twoHalvesImage(12, 5, 7), graph.GRIDGRAPH, IntensityDifference).
+		SegmentWatershed(markers)
+	assert.Equal(t, 2, labels.Count)
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 12; x++ {
+			assert.Equal(t, labels.At(0, 0) != labels.At(x, y), x >= 7, "pixel (%d, %d)", x, y)
+		}
+	}
+}
+
+func TestWatershedNeverMergesDifferentMarkers(t *testing.T) {
+	/* Both markers lie on the same flat half, so they split it */
+	markers := emptyMarkers(12, 5)
+	markers.Ids[0+2*12] = 0
+	markers.Ids[5+2*12] = 1
+	markers.Count = 2
+	labels := New(twoHalvesImage(12, 5, 7), graph.KINGSGRAPH, IntensityDifference).
+		SegmentWatershed(markers)
+	assert.Equal(t, 2, labels.Count)
+	assert.NotEqual(t, labels.At(0, 2), labels.At(5, 2))
+}
+
+func TestWatershedWithRegionalMinima(t *testing.T) {
+	/* Without the gradient every half is a plateau and a regional minimum */
+	img := image.NewGray(image.Rect(0, 0, 10, 6))
+	for y := 0; y < 6; y++ {
+		for x := 6; x < 10; x++ {
+			img.SetGray(x, y, color.Gray{255})
+		}
+	}
+	s := New(img, graph.GRIDGRAPH, IntensityDifference)
+	s.buildGraph()
+	minima := s.regionalMinimaMarkers()
+	assert.Equal(t, 2, minima.Count)
+	assert.Equal(t, UNLABELED, minima.At(5, 0))
+	assert.Equal(t, UNLABELED, minima.At(6, 0))
+
+	labels := New(img, graph.GRIDGRAPH, IntensityDifference).SegmentWatershed(nil)
+	assert.Equal(t, 2, labels.Count)
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 10; x++ {
+			assert.Equal(t, labels.At(0, 0) != labels.At(x, y), x >= 6, "pixel (%d, %d)", x, y)
+		}
+	}
+}
+
+func TestWatershedRejectsMarkersOfAnotherSize(t *testing.T) {
+	img := twoHalvesImage(12, 5, 7)
+	for _, markers := range []*Labels{emptyMarkers(11, 5), emptyMarkers(12, 6),
+		{Width: 12, Height: 5, Ids: make([]int, 10)}} {
+		s := New(img, graph.GRIDGRAPH, IntensityDifference)
+		labels, err := s.SegmentWatershedContext(context.Background(), markers)
+		assert.Nil(t, labels)
+		assert.NotNil(t, err)
+		assert.Nil(t, s.SegmentWatershed(markers))
+	}
+}
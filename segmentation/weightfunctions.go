@@ -1,8 +1,11 @@
 package segmentation
 
 import (
+	"github.com/miguelfrde/image-segmentation/colorspace"
+	"github.com/miguelfrde/image-segmentation/features"
 	"github.com/miguelfrde/image-segmentation/graph"
 	"github.com/miguelfrde/image-segmentation/utils"
+	"image/color"
 	"math"
 )
 
@@ -26,3 +29,66 @@ func NNWeight(p1 graph.Pixel, p2 graph.Pixel) float64 {
 func IntensityDifference(p1 graph.Pixel, p2 graph.Pixel) float64 {
 	return math.Abs(utils.Intensity(p2.Color) - utils.Intensity(p1.Color))
 }
+
+/**
+ * Computes the distance between the two pixels in the color space to which
+ * the image was converted (see Segmenter.SetColorSpace) using
+ * colorspace.Distance. If the image wasn't converted it's the same as
+ * NNWeight.
+ */
+func ColorDistance(p1 graph.Pixel, p2 graph.Pixel) float64 {
+	c1, ok1 := p1.Color.(colorspace.Color)
+	c2, ok2 := p2.Color.(colorspace.Color)
+	if !ok1 || !ok2 || c1.Space != c2.Space {
+		return NNWeight(p1, p2)
+	}
+	return colorspace.Distance(c1.Values, c2.Values, c1.Space)
+}
+
+/**
+ * Computes the CIEDE2000 difference between the two pixels. It's much
+ * faster if the image was converted to CIELAB (see Segmenter.SetColorSpace),
+ * otherwise every pixel is converted for each one of its edges.
+ */
+func CIEDE2000Weight(p1 graph.Pixel, p2 graph.Pixel) float64 {
+	return colorspace.CIEDE2000(labValues(p1.Color), labValues(p2.Color))
+}
+
+func labValues(clr color.Color) [3]float64 {
+	if converted, ok := clr.(colorspace.Color); ok && converted.Space == colorspace.LAB {
+		return converted.Values
+	}
+	return colorspace.Convert(clr, colorspace.LAB)
+}
+
+/**
+ * Computes the distance between the feature vectors of the two pixels (see
+ * Segmenter.SetFeatures). Returns 0 if the image has no features.
+ */
+func FeatureDistance(p1 graph.Pixel, p2 graph.Pixel) float64 {
+	c1, ok1 := p1.Color.(features.Color)
+	c2, ok2 := p2.Color.(features.Color)
+	if !ok1 || !ok2 {
+		return 0
+	}
+	return features.Distance(c1.Vector, c2.Vector)
+}
+
+/**
+ * Returns a weight function that mixes the color difference given by
+ * colorWeight with the feature distance:
+ * w = (1 - alpha) * colorWeight + alpha * FeatureDistance
+ * alpha goes from 0 (only color) to 1 (only texture).
+ */
+func TextureWeight(colorWeight graph.WeightFn, alpha float64) graph.WeightFn {
+	return func(p1 graph.Pixel, p2 graph.Pixel) float64 {
+		texture := FeatureDistance(p1, p2)
+		if c1, ok := p1.Color.(features.Color); ok {
+			p1.Color = c1.Color
+		}
+		if c2, ok := p2.Color.(features.Color); ok {
+			p2.Color = c2.Color
+		}
+		return (1-alpha)*colorWeight(p1, p2) + alpha*texture
+	}
+}
@@ -0,0 +1,107 @@
+package sweep
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+/**
+ * Size in pixels of the glyphs of the bitmap font, without spacing
+ */
+const (
+	GLYPH_WIDTH  = 5
+	GLYPH_HEIGHT = 7
+)
+
+/**
+ * 5x7 bitmap font with the characters used by the labels of the contact
+ * sheets. Every row is a 5 bit number whose most significant bit is the
+ * leftmost pixel. Missing characters are drawn as '?'.
+ */
+var glyphs = map[rune][GLYPH_HEIGHT]uint8{
+	' ': {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	'0': {0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e},
+	'1': {0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'2': {0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f},
+	'3': {0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e},
+	'4': {0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02},
+	'5': {0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e},
+	'6': {0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e},
+	'7': {0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e},
+	'9': {0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c},
+	'a': {0x00, 0x00, 0x0e, 0x01, 0x0f, 0x11, 0x0f},
+	'b': {0x10, 0x10, 0x16, 0x19, 0x11, 0x11, 0x1e},
+	'c': {0x00, 0x00, 0x0e, 0x10, 0x10, 0x11, 0x0e},
+	'd': {0x01, 0x01, 0x0d, 0x13, 0x11, 0x11, 0x0f},
+	'e': {0x00, 0x00, 0x0e, 0x11, 0x1f, 0x10, 0x0e},
+	'f': {0x06, 0x09, 0x08, 0x1c, 0x08, 0x08, 0x08},
+	'g': {0x00, 0x0f, 0x11, 0x11, 0x0f, 0x01, 0x0e},
+	'h': {0x10, 0x10, 0x16, 0x19, 0x11, 0x11, 0x11},
+	'i': {0x04, 0x00, 0x0c, 0x04, 0x04, 0x04, 0x0e},
+	'j': {0x02, 0x00, 0x06, 0x02, 0x02, 0x12, 0x0c},
+	'k': {0x10, 0x10, 0x12, 0x14, 0x18, 0x14, 0x12},
+	'l': {0x0c, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'm': {0x00, 0x00, 0x1a, 0x15, 0x15, 0x11, 0x11},
+	'n': {0x00, 0x00, 0x16, 0x19, 0x11, 0x11, 0x11},
+	'o': {0x00, 0x00, 0x0e, 0x11, 0x11, 0x11, 0x0e},
+	'p': {0x00, 0x00, 0x1e, 0x11, 0x1e, 0x10, 0x10},
+	'q': {0x00, 0x00, 0x0d, 0x13, 0x0f, 0x01, 0x01},
+	'r': {0x00, 0x00, 0x16, 0x19, 0x10, 0x10, 0x10},
+	's': {0x00, 0x00, 0x0e, 0x10, 0x0e, 0x01, 0x1e},
+	't': {0x08, 0x08, 0x1c, 0x08, 0x08, 0x09, 0x06},
+	'u': {0x00, 0x00, 0x11, 0x11, 0x11, 0x13, 0x0d},
+	'v': {0x00, 0x00, 0x11, 0x11, 0x11, 0x0a, 0x04},
+	'w': {0x00, 0x00, 0x11, 0x11, 0x15, 0x15, 0x0a},
+	'x': {0x00, 0x00, 0x11, 0x0a, 0x04, 0x0a, 0x11},
+	'y': {0x00, 0x00, 0x11, 0x11, 0x0f, 0x01, 0x0e},
+	'z': {0x00, 0x00, 0x1f, 0x02, 0x04, 0x08, 0x1f},
+	'=': {0x00, 0x00, 0x1f, 0x00, 0x1f, 0x00, 0x00},
+	'.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x0c},
+	',': {0x00, 0x00, 0x00, 0x00, 0x0c, 0x04, 0x08},
+	':': {0x00, 0x0c, 0x0c, 0x00, 0x0c, 0x0c, 0x00},
+	'-': {0x00, 0x00, 0x00, 0x1f, 0x00, 0x00, 0x00},
+	'+': {0x00, 0x04, 0x04, 0x1f, 0x04, 0x04, 0x00},
+	'?': {0x0e, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+}
+
+/**
+ * Returns the width in pixels of the text drawn with DrawText at the given
+ * scale
+ */
+func TextWidth(text string, scale int) int {
+	n := len([]rune(text))
+	if n == 0 {
+		return 0
+	}
+	return (n*(GLYPH_WIDTH+1) - 1) * scale
+}
+
+/**
+ * Draws the text on img with the color c, its top left corner at x, y.
+ * Every pixel of the font is drawn as a scale x scale square. Uppercase
+ * letters are drawn as lowercase ones. Pixels outside of img are ignored.
+ */
+func DrawText(img draw.Image, x, y int, text string, c color.Color, scale int) {
+	src := image.NewUniform(c)
+	for _, r := range text {
+		if r >= 'A' && r <= 'Z' {
+			r += 'a' - 'A'
+		}
+		glyph, ok := glyphs[r]
+		if !ok {
+			glyph = glyphs['?']
+		}
+		for row, bits := range glyph {
+			for col := 0; col < GLYPH_WIDTH; col++ {
+				if bits&(1<<uint(GLYPH_WIDTH-1-col)) == 0 {
+					continue
+				}
+				rect := image.Rect(x+col*scale, y+row*scale, x+(col+1)*scale, y+(row+1)*scale)
+				draw.Draw(img, rect.Intersect(img.Bounds()), src, image.Point{}, draw.Src)
+			}
+		}
+		x += (GLYPH_WIDTH + 1) * scale
+	}
+}
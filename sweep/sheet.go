@@ -0,0 +1,192 @@
+package sweep
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/miguelfrde/image-segmentation/segmentation"
+	"github.com/miguelfrde/image-segmentation/utils"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+	"strings"
+)
+
+/**
+ * Default width in pixels of the thumbnails of a contact sheet
+ */
+const THUMB_WIDTH = 200
+
+/**
+ * Space in pixels around the thumbnails and labels of a contact sheet
+ */
+const SHEET_PADDING = 8
+
+/**
+ * A setting of a contact sheet: its parameters and segment count, its label
+ * and the position and size of its thumbnail in the sheet image
+ */
+type Cell struct {
+	segmentation.SweepResult
+	Label  string `json:"label"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+/**
+ * A contact sheet: a grid of the result images of a parameter sweep, each
+ * one with a label below with the parameters that change between settings
+ * and the number of segments
+ */
+type Sheet struct {
+	Image   *image.RGBA `json:"-"`
+	Columns int         `json:"columns"`
+	Cells   []Cell      `json:"settings"`
+}
+
+/**
+ * Returns the contact sheet of the results of a sweep with the given number
+ * of columns, or a square grid if it's not positive, and thumbnails of the
+ * given width, or THUMB_WIDTH if it's not positive
+ */
+func NewSheet(results []segmentation.SweepResult, columns, thumbWidth int) *Sheet {
+	if thumbWidth <= 0 {
+		thumbWidth = THUMB_WIDTH
+	}
+	if columns <= 0 {
+		columns = int(math.Ceil(math.Sqrt(float64(len(results)))))
+	}
+	if columns > len(results) {
+		columns = len(results)
+	}
+	sheet := &Sheet{Columns: columns}
+	if len(results) == 0 {
+		sheet.Image = image.NewRGBA(image.Rect(0, 0, 0, 0))
+		return sheet
+	}
+
+	thumbHeight := 0
+	for _, r := range results {
+		bounds := r.Image.Bounds()
+		height := int(math.Round(float64(bounds.Dy()*thumbWidth) / float64(bounds.Dx())))
+		thumbHeight = utils.MaxI(thumbHeight, height)
+	}
+	lineHeight := GLYPH_HEIGHT + 3
+	cellWidth := thumbWidth + SHEET_PADDING
+	cellHeight := thumbHeight + 2*lineHeight + SHEET_PADDING
+	rows := (len(results) + columns - 1) / columns
+	sheet.Image = image.NewRGBA(image.Rect(0, 0, columns*cellWidth+SHEET_PADDING,
+		rows*cellHeight+SHEET_PADDING))
+	draw.Draw(sheet.Image, sheet.Image.Bounds(), image.White, image.Point{}, draw.Src)
+
+	labels := Labels(results)
+	for i, r := range results {
+		x := SHEET_PADDING + (i%columns)*cellWidth
+		y := SHEET_PADDING + (i/columns)*cellHeight
+		thumb := Thumbnail(r.Image, thumbWidth)
+		draw.Draw(sheet.Image, thumb.Bounds().Add(image.Pt(x, y)), thumb, image.Point{}, draw.Src)
+
+		/* The labels are clipped to the width of the thumbnail */
+		text := sheet.Image.SubImage(image.Rect(x, y+thumbHeight, x+thumbWidth,
+			y+thumbHeight+2*lineHeight)).(*image.RGBA)
+		DrawText(text, x, y+thumbHeight+2, labels[i], color.Black, 1)
+		DrawText(text, x, y+thumbHeight+2+lineHeight, fmt.Sprintf("%d segments", r.Segments),
+			color.Gray{96}, 1)
+		sheet.Cells = append(sheet.Cells, Cell{SweepResult: r, Label: labels[i], X: x, Y: y,
+			Width: thumb.Bounds().Dx(), Height: thumb.Bounds().Dy()})
+	}
+	return sheet
+}
+
+/**
+ * Writes the index of the sheet, its settings and where their thumbnails
+ * are, to w as JSON
+ */
+func (sheet *Sheet) WriteIndex(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sheet)
+}
+
+/**
+ * A parameter of the settings of a sweep
+ */
+type parameter struct {
+	name  string
+	value func(segmentation.SweepResult) float64
+}
+
+var parameters = []parameter{
+	{"sigma", func(r segmentation.SweepResult) float64 { return r.Sigma }},
+	{"k", func(r segmentation.SweepResult) float64 { return r.K }},
+	{"minsize", func(r segmentation.SweepResult) float64 { return float64(r.MinSize) }},
+	{"minweight", func(r segmentation.SweepResult) float64 { return r.MinWeight }},
+	{"superpixels", func(r segmentation.SweepResult) float64 { return float64(r.Superpixels) }},
+	{"compactness", func(r segmentation.SweepResult) float64 { return r.Compactness }},
+}
+
+/**
+ * Returns the labels of the settings of a sweep: the values of the
+ * parameters that change between them, like "sigma=0.8 k=300". If there's a
+ * single setting, it has all its non zero parameters.
+ */
+func Labels(results []segmentation.SweepResult) []string {
+	var shown []parameter
+	for _, p := range parameters {
+		for _, r := range results {
+			if p.value(r) != p.value(results[0]) {
+				shown = append(shown, p)
+				break
+			}
+		}
+	}
+	if len(shown) == 0 && len(results) > 0 {
+		for _, p := range parameters {
+			if p.value(results[0]) != 0 {
+				shown = append(shown, p)
+			}
+		}
+	}
+	labels := make([]string, len(results), len(results))
+	for i, r := range results {
+		parts := make([]string, len(shown), len(shown))
+		for j, p := range shown {
+			parts[j] = fmt.Sprintf("%s=%g", p.name, p.value(r))
+		}
+		labels[i] = strings.Join(parts, " ")
+	}
+	return labels
+}
+
+/**
+ * Returns the image img scaled to the given width, keeping its aspect ratio.
+ * Every pixel of the thumbnail is the mean of the pixels of img that it
+ * covers.
+ */
+func Thumbnail(img image.Image, width int) *image.RGBA {
+	bounds := img.Bounds()
+	height := utils.MaxI(1, int(math.Round(float64(bounds.Dy()*width)/float64(bounds.Dx()))))
+	thumb := image.NewRGBA(image.Rect(0, 0, width, height))
+	for ty := 0; ty < height; ty++ {
+		y0 := bounds.Min.Y + ty*bounds.Dy()/height
+		y1 := utils.MaxI(y0+1, bounds.Min.Y+(ty+1)*bounds.Dy()/height)
+		for tx := 0; tx < width; tx++ {
+			x0 := bounds.Min.X + tx*bounds.Dx()/width
+			x1 := utils.MaxI(x0+1, bounds.Min.X+(tx+1)*bounds.Dx()/width)
+			var sum [4]uint32
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					r, g, b, a := img.At(x, y).RGBA()
+					sum[0], sum[1], sum[2], sum[3] = sum[0]+r>>8, sum[1]+g>>8, sum[2]+b>>8, sum[3]+a>>8
+				}
+			}
+			n := uint32((x1 - x0) * (y1 - y0))
+			thumb.SetRGBA(tx, ty, color.RGBA{uint8(sum[0] / n), uint8(sum[1] / n),
+				uint8(sum[2] / n), uint8(sum[3] / n)})
+		}
+	}
+	return thumb
+}
@@ -0,0 +1,124 @@
+package sweep
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/miguelfrde/image-segmentation/segmentation"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+/*
+ * Helper functions
+ */
+
+func uniform(width, height int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+/*
+ * Tests
+ */
+
+func TestParseValues(t *testing.T) {
+	values, err := ParseValues("0.5:1.5:0.5, 3")
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{0.5, 1, 1.5, 3}, values)
+	values, err = ParseValues("0.1:0.3:0.1")
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{0.1, 0.2, 0.3}, values)
+	values, err = ParseValues("100:250:100")
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{100, 200}, values)
+}
+
+func TestParseValuesErrors(t *testing.T) {
+	for _, spec := range []string{"", "a", "1:2", "1:2:0", "2:1:1", "0:1e9:1", "1:2:x"} {
+		_, err := ParseValues(spec)
+		assert.NotNil(t, err, spec)
+	}
+}
+
+func TestParseInts(t *testing.T) {
+	values, err := ParseInts("10:30:10,50")
+	assert.Nil(t, err)
+	assert.Equal(t, []int{10, 20, 30, 50}, values)
+	_, err = ParseInts("0.5")
+	assert.NotNil(t, err)
+}
+
+func TestLabels(t *testing.T) {
+	results := []segmentation.SweepResult{
+		{Sigma: 0.8, K: 100, MinSize: 50},
+		{Sigma: 0.8, K: 300, MinSize: 50},
+	}
+	assert.Equal(t, []string{"k=100", "k=300"}, Labels(results))
+	assert.Equal(t, []string{"sigma=0.8 k=100 minsize=50"}, Labels(results[:1]))
+}
+
+func TestTextWidth(t *testing.T) {
+	assert.Equal(t, 0, TextWidth("", 1))
+	assert.Equal(t, 5, TextWidth("a", 1))
+	assert.Equal(t, 22, TextWidth("ab", 2))
+}
+
+func TestDrawText(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 6, 7))
+	DrawText(img, 0, 0, "1", color.White, 1)
+	/* Top row of '1' is 00100 and the bottom one 01110 */
+	assert.Equal(t, []uint8{0, 0, 255, 0, 0, 0}, img.Pix[0:6])
+	assert.Equal(t, []uint8{0, 255, 255, 255, 0, 0}, img.Pix[36:42])
+
+	/* Unknown characters are drawn as '?' and uppercase as lowercase */
+	a, b := image.NewGray(img.Bounds()), image.NewGray(img.Bounds())
+	DrawText(a, 0, 0, "~", color.White, 1)
+	DrawText(b, 0, 0, "?", color.White, 1)
+	assert.Equal(t, b.Pix, a.Pix)
+	DrawText(a, 0, 0, "K", color.White, 1)
+	DrawText(b, 0, 0, "k", color.White, 1)
+	assert.Equal(t, b.Pix, a.Pix)
+}
+
+func TestThumbnail(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	draw.Draw(img, image.Rect(0, 0, 2, 2), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(2, 0, 4, 2), image.Black, image.Point{}, draw.Src)
+	thumb := Thumbnail(img, 2)
+	assert.Equal(t, image.Rect(0, 0, 2, 1), thumb.Bounds())
+	assert.Equal(t, color.RGBA{255, 255, 255, 255}, thumb.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{0, 0, 0, 255}, thumb.RGBAAt(1, 0))
+}
+
+func TestNewSheet(t *testing.T) {
+	var results []segmentation.SweepResult
+	for k := 1; k <= 5; k++ {
+		results = append(results, segmentation.SweepResult{K: float64(k), Segments: k,
+			Image: uniform(40, 20, color.RGBA{255, 0, 0, 255})})
+	}
+	sheet := NewSheet(results, 0, 20)
+	assert.Equal(t, 3, sheet.Columns)
+	assert.Equal(t, 5, len(sheet.Cells))
+	cell := sheet.Cells[4]
+	assert.Equal(t, "k=5", cell.Label)
+	assert.Equal(t, 20, cell.Width)
+	assert.Equal(t, 10, cell.Height)
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, sheet.Image.RGBAAt(cell.X, cell.Y))
+	assert.Equal(t, sheet.Cells[3].Y, cell.Y)
+	assert.Equal(t, sheet.Cells[1].X, cell.X)
+	assert.True(t, cell.X > sheet.Cells[3].X)
+	assert.True(t, sheet.Image.Bounds().Max.Y > cell.Y+cell.Height)
+
+	var index bytes.Buffer
+	assert.Nil(t, sheet.WriteIndex(&index))
+	var decoded map[string]interface{}
+	assert.Nil(t, json.Unmarshal(index.Bytes(), &decoded))
+	settings := decoded["settings"].([]interface{})
+	assert.Equal(t, 5, len(settings))
+	assert.Equal(t, map[string]interface{}{"k": 5.0, "segments": 5.0, "label": "k=5",
+		"x": float64(cell.X), "y": float64(cell.Y), "width": 20.0, "height": 10.0}, settings[4])
+}
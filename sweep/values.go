@@ -0,0 +1,95 @@
+/**
+ * Package sweep helps tuning the parameters of the segmentation algorithms.
+ * It parses ranges of parameter values and lays out the results of a
+ * parameter sweep of a Segmenter in a contact sheet: a grid of labeled
+ * thumbnails, one per setting, with an index of the settings.
+ */
+package sweep
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Maximum number of values that a range can expand to
+ */
+const MAX_VALUES = 1000
+
+/**
+ * Parses a comma separated list of values or ranges. A range start:stop:step
+ * goes from start to stop, both included, in increments of step. For example
+ * "0.5:1.5:0.5,3" is 0.5, 1, 1.5 and 3.
+ */
+func ParseValues(spec string) ([]float64, error) {
+	var values []float64
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) != 1 && len(parts) != 3 {
+			return nil, fmt.Errorf("invalid range %q, expected start:stop:step", item)
+		}
+		numbers := make([]float64, len(parts), len(parts))
+		for i, part := range parts {
+			number, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+				return nil, fmt.Errorf("invalid number %q", part)
+			}
+			numbers[i] = number
+		}
+		if len(numbers) == 1 {
+			values = append(values, numbers[0])
+		} else {
+			start, stop, step := numbers[0], numbers[1], numbers[2]
+			if step <= 0 || stop < start {
+				return nil, fmt.Errorf("invalid range %q, the step must be positive and stop "+
+					"not smaller than start", item)
+			}
+			if (stop-start)/step >= MAX_VALUES {
+				return nil, fmt.Errorf("the range %q has too many values", item)
+			}
+			/* Computed from the index to avoid accumulating rounding errors */
+			for i := 0; start+float64(i)*step <= stop+step*1e-9; i++ {
+				values = append(values, round(start+float64(i)*step))
+			}
+		}
+		if len(values) > MAX_VALUES {
+			return nil, fmt.Errorf("%q has too many values", spec)
+		}
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no values")
+	}
+	return values, nil
+}
+
+/**
+ * Same as ParseValues but all the values must be integers
+ */
+func ParseInts(spec string) ([]int, error) {
+	values, err := ParseValues(spec)
+	if err != nil {
+		return nil, err
+	}
+	ints := make([]int, len(values), len(values))
+	for i, value := range values {
+		if value != math.Trunc(value) {
+			return nil, fmt.Errorf("%g is not an integer", value)
+		}
+		ints[i] = int(value)
+	}
+	return ints, nil
+}
+
+/**
+ * Rounds x to 10 significant digits, so that 0.1+0.2 is 0.3
+ */
+func round(x float64) float64 {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(x, 'g', 10, 64), 64)
+	return rounded
+}
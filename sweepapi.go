@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/miguelfrde/image-segmentation/segmentation"
+	"github.com/miguelfrde/image-segmentation/sweep"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+/**
+ * Maximum number of settings of a sweep request
+ */
+const MAX_SWEEP_SETTINGS = 64
+
+/**
+ * Maximum width of the thumbnails of a contact sheet
+ */
+const MAX_THUMB_WIDTH = 400
+
+/**
+ * Parameters of a sweep request. The parameters of the algorithms take comma
+ * separated values and start:stop:step ranges, the rest are the same as the
+ * ones of a segmentation request.
+ */
+type sweepParams struct {
+	Image         string   `json:"image,omitempty"`
+	Algorithm     string   `json:"algorithm"`
+	Sigma         string   `json:"sigma"`
+	K             string   `json:"k"`
+	MinSize       string   `json:"minsize"`
+	MinWeight     string   `json:"minweight"`
+	Superpixels   string   `json:"superpixels"`
+	Compactness   string   `json:"compactness"`
+	Graph         string   `json:"graph"`
+	Radius        float64  `json:"radius"`
+	WeightFn      string   `json:"weightfn"`
+	ColorSpace    string   `json:"colorspace"`
+	Features      []string `json:"features,omitempty"`
+	FeatureWeight float64  `json:"featureWeight"`
+	Columns       int      `json:"columns"`
+	Width         int      `json:"width"`
+	renderParams
+}
+
+/**
+ * Successful response of the sweep API. Sheet is the contact sheet image and
+ * Index the JSON file with its settings, which are also in Settings.
+ */
+type sweepResponse struct {
+	Id       string             `json:"id"`
+	Original string             `json:"original"`
+	Sheet    string             `json:"sheet"`
+	Index    string             `json:"index"`
+	Settings []sweep.Cell       `json:"settings"`
+	Timings  map[string]float64 `json:"timings"`
+}
+
+/**
+ * Returns the parameters with the same default values that the web form uses
+ */
+func defaultSweepParams() sweepParams {
+	defaults := defaultSegmentParams()
+	return sweepParams{
+		Algorithm:     defaults.Algorithm,
+		Sigma:         "0.8",
+		K:             "300",
+		MinSize:       "50",
+		MinWeight:     "5",
+		Superpixels:   "400",
+		Compactness:   "10",
+		Graph:         defaults.Graph,
+		Radius:        defaults.Radius,
+		WeightFn:      defaults.WeightFn,
+		ColorSpace:    defaults.ColorSpace,
+		FeatureWeight: defaults.FeatureWeight,
+		Width:         sweep.THUMB_WIDTH,
+		renderParams:  defaultRenderParams(),
+	}
+}
+
+/**
+ * Returns the segmentation parameters that hold the graph settings of the
+ * sweep
+ */
+func (params *sweepParams) graphOptions() (graphSettings, *apiError) {
+	segment := defaultSegmentParams()
+	segment.Graph = params.Graph
+	segment.Radius = params.Radius
+	segment.WeightFn = params.WeightFn
+	segment.ColorSpace = params.ColorSpace
+	segment.Features = params.Features
+	segment.FeatureWeight = params.FeatureWeight
+	return segment.graphOptions()
+}
+
+func parseSweepValues(name, spec string) ([]float64, *apiError) {
+	values, err := sweep.ParseValues(spec)
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, "invalid_parameter", "%s: %v", name, err)
+	}
+	return values, nil
+}
+
+func parseSweepInts(name, spec string) ([]int, *apiError) {
+	values, err := sweep.ParseInts(spec)
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, "invalid_parameter", "%s: %v", name, err)
+	}
+	return values, nil
+}
+
+/**
+ * Runs the sweep described by the parameters on the segmenter. It stops as
+ * soon as ctx is done.
+ */
+func runSweep(ctx context.Context, segmenter *segmentation.Segmenter,
+	params sweepParams) ([]segmentation.SweepResult, *apiError) {
+	var settings int
+	var run func() ([]segmentation.SweepResult, error)
+	switch params.Algorithm {
+	case "gbs":
+		sigmas, err := parseSweepValues("sigma", params.Sigma)
+		if err != nil {
+			return nil, err
+		}
+		ks, err := parseSweepValues("k", params.K)
+		if err != nil {
+			return nil, err
+		}
+		minSizes, err := parseSweepInts("minsize", params.MinSize)
+		if err != nil {
+			return nil, err
+		}
+		settings = len(sigmas) * len(ks) * len(minSizes)
+		run = func() ([]segmentation.SweepResult, error) {
+			return segmenter.SweepGBSContext(ctx, sigmas, ks, minSizes)
+		}
+	case "hmsf", "phmsf":
+		sigmas, err := parseSweepValues("sigma", params.Sigma)
+		if err != nil {
+			return nil, err
+		}
+		minWeights, err := parseSweepValues("minweight", params.MinWeight)
+		if err != nil {
+			return nil, err
+		}
+		settings = len(sigmas) * len(minWeights)
+		run = func() ([]segmentation.SweepResult, error) {
+			if params.Algorithm == "phmsf" {
+				return segmenter.SweepPHMSFContext(ctx, sigmas, minWeights)
+			}
+			return segmenter.SweepHMSFContext(ctx, sigmas, minWeights)
+		}
+	case "slic":
+		superpixels, err := parseSweepInts("superpixels", params.Superpixels)
+		if err != nil {
+			return nil, err
+		}
+		compactness, err := parseSweepValues("compactness", params.Compactness)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range superpixels {
+			if n < 1 {
+				return nil, newAPIError(http.StatusBadRequest, "invalid_parameter",
+					"superpixels must be positive")
+			}
+		}
+		settings = len(superpixels) * len(compactness)
+		run = func() ([]segmentation.SweepResult, error) {
+			return segmenter.SweepSLICContext(ctx, superpixels, compactness)
+		}
+	default:
+		return nil, newAPIError(http.StatusBadRequest, "invalid_parameter",
+			"unknown algorithm %q", params.Algorithm)
+	}
+	if settings > MAX_SWEEP_SETTINGS {
+		return nil, newAPIError(http.StatusBadRequest, "invalid_parameter",
+			"the sweep has %d settings, at most %d are allowed", settings, MAX_SWEEP_SETTINGS)
+	}
+	results, err := run()
+	if err != nil {
+		return nil, segmentError(err)
+	}
+	return results, nil
+}
+
+/**
+ * Reads the parameters and the image of a sweep request, either from a JSON
+ * or from a multipart body. The image is stored in the tmp directory.
+ * Returns the parameters and the name and extension of the stored image.
+ */
+func parseSweepRequest(w http.ResponseWriter, r *http.Request) (sweepParams, string, string,
+	*apiError) {
+	params := defaultSweepParams()
+	mediaType, apiErr := checkAPIRequest(w, r)
+	if apiErr != nil {
+		return params, "", "", apiErr
+	}
+	if mediaType == "application/json" {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			return params, "", "", newAPIError(http.StatusBadRequest, "invalid_json", "%v", err)
+		}
+		filename, extension, apiErr := storeBase64Image(params.Image)
+		params.Image = ""
+		return params, filename, extension, apiErr
+	}
+
+	if err := r.ParseMultipartForm(MAX_REQUEST_SIZE); err != nil {
+		return params, "", "", newAPIError(http.StatusBadRequest, "invalid_form", "%v", err)
+	}
+	texts := map[string]*string{"algorithm": &params.Algorithm, "sigma": &params.Sigma,
+		"k": &params.K, "minsize": &params.MinSize, "minweight": &params.MinWeight,
+		"superpixels": &params.Superpixels, "compactness": &params.Compactness,
+		"graph": &params.Graph, "weightfn": &params.WeightFn, "colorspace": &params.ColorSpace}
+	floats := map[string]*float64{"radius": &params.Radius, "featureWeight": &params.FeatureWeight}
+	ints := map[string]*int{"columns": &params.Columns, "width": &params.Width}
+	for name, value := range texts {
+		if r.FormValue(name) != "" {
+			*value = r.FormValue(name)
+		}
+	}
+	for name, value := range floats {
+		if r.FormValue(name) == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(r.FormValue(name), 64)
+		if err != nil {
+			return params, "", "", newAPIError(http.StatusBadRequest, "invalid_parameter",
+				"%s must be a number", name)
+		}
+		*value = parsed
+	}
+	for name, value := range ints {
+		if r.FormValue(name) == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(r.FormValue(name))
+		if err != nil {
+			return params, "", "", newAPIError(http.StatusBadRequest, "invalid_parameter",
+				"%s must be an integer", name)
+		}
+		*value = parsed
+	}
+	params.Features = formFeatures(r)
+	if apiErr := params.readForm(r); apiErr != nil {
+		return params, "", "", apiErr
+	}
+	filename, extension, apiErr := storeFormImage(r)
+	return params, filename, extension, apiErr
+}
+
+/**
+ * Runs the sweep on the image stored in the tmp directory with the given
+ * name and extension and writes the contact sheet and its index next to it
+ */
+func sweepStoredImage(ctx context.Context, filename, extension string, params sweepParams,
+	logger *slog.Logger) (sweepResponse, *apiError) {
+	if params.Width < 1 || params.Width > MAX_THUMB_WIDTH {
+		return sweepResponse{}, newAPIError(http.StatusBadRequest, "invalid_parameter",
+			"width must be between 1 and %d", MAX_THUMB_WIDTH)
+	}
+	settings, apiErr := params.graphOptions()
+	if apiErr != nil {
+		return sweepResponse{}, apiErr
+	}
+	renderer, apiErr := params.renderer()
+	if apiErr != nil {
+		return sweepResponse{}, apiErr
+	}
+	img := loadImageFromFile("tmp/" + filename + extension)
+	if img == nil {
+		return sweepResponse{}, newAPIError(http.StatusBadRequest, "invalid_image",
+			"the image could not be decoded")
+	}
+	segmenter := settings.newSegmenter(img, segmentation.WithLogger(logger.With("image", filename)))
+	segmenter.SetRenderer(renderer)
+	results, apiErr := runSweep(ctx, segmenter, params)
+	if apiErr != nil {
+		return sweepResponse{}, apiErr
+	}
+
+	sheet := sweep.NewSheet(results, params.Columns, params.Width)
+	base := "tmp/sweep_" + filename
+	if err := writeTmpFile(base+".png", func(w io.Writer) error {
+		return png.Encode(w, sheet.Image)
+	}); err != nil {
+		return sweepResponse{}, newAPIError(http.StatusInternalServerError, "internal_error", "%v", err)
+	}
+	if err := writeTmpFile(base+".json", sheet.WriteIndex); err != nil {
+		return sweepResponse{}, newAPIError(http.StatusInternalServerError, "internal_error", "%v", err)
+	}
+
+	timings := make(map[string]float64)
+	for phase, elapsed := range segmenter.GetTimings() {
+		timings[phase] = float64(elapsed) / float64(time.Millisecond)
+	}
+	return sweepResponse{
+		Id:       filename,
+		Original: "/tmp/" + filename + extension,
+		Sheet:    "/" + base + ".png",
+		Index:    "/" + base + ".json",
+		Settings: sheet.Cells,
+		Timings:  timings,
+	}, nil
+}
+
+/**
+ * Creates the file path and writes it with the function write
+ */
+func writeTmpFile(path string, write func(io.Writer) error) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+/**
+ * Handles /api/v1/sweep. Accepts POST requests with either a JSON or a
+ * multipart body and answers with a sweepResponse or an error as JSON. The
+ * sweep stops if the client disconnects or it takes longer than
+ * SEGMENT_TIMEOUT.
+ */
+func apiSweepHandler(w http.ResponseWriter, r *http.Request) {
+	params, filename, extension, apiErr := parseSweepRequest(w, r)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), SEGMENT_TIMEOUT)
+	defer cancel()
+	response, apiErr := sweepStoredImage(ctx, filename, extension, params, requestLogger(r))
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
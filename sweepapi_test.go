@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+/*
+ * Tests
+ */
+
+func TestSweepAPI(t *testing.T) {
+	w := serve(apiSweepHandler, jsonRequest("/api/v1/sweep", map[string]interface{}{
+		"sigma": "0", "k": "100,300", "minsize": "5", "width": 40}, pngImage(20, 10)))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response sweepResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 2, len(response.Settings))
+	for _, path := range []string{response.Original, response.Sheet, response.Index} {
+		_, err := os.Stat(path[1:])
+		assert.Nil(t, err, path)
+	}
+
+	w = serve(apiSweepHandler, multipartRequest("/api/v1/sweep", map[string]string{
+		"algorithm": "slic", "superpixels": "2,4", "compactness": "5:15:5"}, "img.jpg",
+		pngImage(20, 10)))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 6, len(response.Settings))
+	assert.Equal(t, "/tmp/"+response.Id+".png", response.Original)
+}
+
+func TestSweepAPIRejectsInvalidRequests(t *testing.T) {
+	img := pngImage(20, 10)
+	for name, test := range map[string]struct {
+		request *http.Request
+		status  int
+		code    string
+	}{
+		"get":      {httptest.NewRequest("GET", "/api/v1/sweep", nil), 405, "method_not_allowed"},
+		"no image": {jsonRequest("/api/v1/sweep", nil, nil), 400, "missing_image"},
+		"unknown algorithm": {jsonRequest("/api/v1/sweep",
+			map[string]interface{}{"algorithm": "kmeans"}, img), 400, "invalid_parameter"},
+		"invalid values": {jsonRequest("/api/v1/sweep",
+			map[string]interface{}{"k": "1,a"}, img), 400, "invalid_parameter"},
+		"too many settings": {jsonRequest("/api/v1/sweep",
+			map[string]interface{}{"k": "1:100:1"}, img), 400, "invalid_parameter"},
+		"no superpixels": {jsonRequest("/api/v1/sweep",
+			map[string]interface{}{"algorithm": "slic", "superpixels": "0,10"}, img), 400,
+			"invalid_parameter"},
+		"wide thumbnails": {jsonRequest("/api/v1/sweep",
+			map[string]interface{}{"width": MAX_THUMB_WIDTH + 1}, img), 400, "invalid_parameter"},
+		"bad columns": {multipartRequest("/api/v1/sweep", map[string]string{"columns": "a"},
+			"img.png", img), 400, "invalid_parameter"},
+	} {
+		w := serve(apiSweepHandler, test.request)
+		assert.Equal(t, test.status, w.Code, name)
+		assert.Equal(t, test.code, errorCode(t, w), name)
+	}
+}
@@ -0,0 +1,68 @@
+/**
+ * Package tracing defines the span based hooks used by the segmentation and
+ * imagenoise packages to report how long every phase of their work takes.
+ */
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+/**
+ * Starts a span for every named step of some work
+ */
+type Tracer interface {
+	Start(name string) Span
+}
+
+/**
+ * A step of some work that is running. End must be called once when the
+ * step finishes.
+ */
+type Span interface {
+	End()
+}
+
+/**
+ * Tracer that does nothing, used when no tracer is given
+ */
+var Nop Tracer = nopTracer{}
+
+type nopTracer struct{}
+type nopSpan struct{}
+
+func (nopTracer) Start(name string) Span {
+	return nopSpan{}
+}
+
+func (nopSpan) End() {}
+
+/**
+ * Returns a tracer that logs every span to the given logger with the given
+ * level when it ends, with its name and its duration.
+ */
+func Log(logger *slog.Logger, level slog.Level) Tracer {
+	return logTracer{logger: logger, level: level}
+}
+
+type logTracer struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+type logSpan struct {
+	tracer logTracer
+	name   string
+	start  time.Time
+}
+
+func (t logTracer) Start(name string) Span {
+	return &logSpan{tracer: t, name: name, start: time.Now()}
+}
+
+func (span *logSpan) End() {
+	span.tracer.logger.Log(context.Background(), span.tracer.level, "span finished",
+		"span", span.name, "duration", time.Since(span.start))
+}
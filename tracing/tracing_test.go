@@ -0,0 +1,35 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"testing"
+)
+
+func TestNopTracer(t *testing.T) {
+	span := Nop.Start("phase")
+	span.End()
+}
+
+func TestLogTracerLogsSpanWhenItEnds(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	span := Log(logger, slog.LevelInfo).Start("blur")
+	assert.Equal(t, 0, buf.Len())
+	span.End()
+
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "span finished", entry["msg"])
+	assert.Equal(t, "blur", entry["span"])
+	assert.Contains(t, entry, "duration")
+}
+
+func TestLogTracerRespectsLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	Log(logger, slog.LevelDebug).Start("blur").End()
+	assert.Equal(t, 0, buf.Len())
+}
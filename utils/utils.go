@@ -30,6 +30,26 @@ func MinI(a, b int) int {
 	return b
 }
 
+/**
+ * Computes the maximum of two int values
+ */
+func MaxI(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+/**
+ * Computes the absolute value of an int value
+ */
+func AbsI(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
 /**
  * Rounds the number X.Y
  * Returns X if Y < 0.5 and X+1 if Y >= 0.5
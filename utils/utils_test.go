@@ -11,6 +11,18 @@ func TestMinOfTwoIntegers(t *testing.T) {
 	assert.Equal(t, 3, MinI(3, 3))
 }
 
+func TestMaxOfTwoIntegers(t *testing.T) {
+	assert.Equal(t, 4, MaxI(3, 4))
+	assert.Equal(t, 4, MaxI(4, 3))
+	assert.Equal(t, 3, MaxI(3, 3))
+}
+
+func TestAbsOfIntegers(t *testing.T) {
+	assert.Equal(t, 3, AbsI(3))
+	assert.Equal(t, 3, AbsI(-3))
+	assert.Equal(t, 0, AbsI(0))
+}
+
 func TestMinOfTwoFloats(t *testing.T) {
 	assert.Equal(t, 3.1, MinF(3.1, 4.2))
 	assert.Equal(t, 3.1, MinF(4.2, 3.1))
@@ -5,6 +5,62 @@ function changeImage(activeImage, hiddenImage) {
   $('#show-' + hiddenImage).removeClass('btn-primary');
   $('#' + hiddenImage + '-image').hide();
   $('#' + activeImage + '-image').show();
+  $('#scribbles-canvas').toggle(activeImage == 'original');
+}
+
+function resetScribbles() {
+  var image = $('#original-image')[0];
+  var canvas = $('#scribbles-canvas')[0];
+  canvas.width = image.naturalWidth;
+  canvas.height = image.naturalHeight;
+}
+
+function showResult(original, result) {
+  $('#btn-run').removeAttr('disabled');
+  $('#btn-run').text('Run');
+  $('#btn-scribbles').removeAttr('disabled');
+  $('#work-status').hide();
+  $('#result-image').attr('src', result);
+  if ($('#original-image').attr('src') != original) {
+    $('#original-image').attr('src', original);
+  }
+  changeImage('result', 'original');
+}
+
+function showTextResult(data) {
+  data = data.split(' ');
+  var filename = data[0];
+  var originalext = data[1];
+  showResult('/tmp/' + filename + originalext, '/tmp/new_' + filename + '.png');
+}
+
+function showProgress(job) {
+  var percentage = Math.round(job.progress * 100) + '%';
+  $('#work-progress').css('width', percentage);
+  $('#work-phase').text(job.status == 'running' ? job.phase + ' ' + percentage : job.status);
+}
+
+function showError(message) {
+  $('#btn-run').removeAttr('disabled');
+  $('#btn-run').text('Run');
+  $('#work-status').hide();
+  alert(message);
+}
+
+/* Follows the progress of a job through Server-Sent Events */
+function followJob(id) {
+  var source = new EventSource('/jobs/' + id + '/events');
+  source.addEventListener('progress', function(e) {
+    var job = JSON.parse(e.data);
+    showProgress(job);
+    if (job.status == 'done') {
+      source.close();
+      showResult(job.result.original, job.result.result);
+    } else if (job.status == 'failed') {
+      source.close();
+      showError(job.error);
+    }
+  });
 }
 
 $(function() {
@@ -53,6 +109,36 @@ $(function() {
     }
   });
 
+  $('#superpixels-slider').noUiSlider({
+    start: 400,
+    step: 10,
+    connect: 'lower',
+    range: {
+      min: 10,
+      max: 3000
+    }
+  });
+
+  $('#compactness-slider').noUiSlider({
+    start: 10,
+    step: 1,
+    connect: 'lower',
+    range: {
+      min: 1,
+      max: 40
+    }
+  });
+
+  $('#featureweight-slider').noUiSlider({
+    start: 0.5,
+    step: 0.05,
+    connect: 'lower',
+    range: {
+      min: 0,
+      max: 1
+    }
+  });
+
   $('#sigma-slider').Link('lower').to($('#input-sigma'));
 
   $('#k-slider').Link('lower').to($('#input-k'), null, {
@@ -67,14 +153,29 @@ $(function() {
 
   $('#minweight-slider').Link('lower').to($('#input-minweight'));
 
+  $('#superpixels-slider').Link('lower').to($('#input-superpixels'), null, {
+    to: parseInt,
+    from: Number
+  });
+
+  $('#compactness-slider').Link('lower').to($('#input-compactness'), null, {
+    to: parseInt,
+    from: Number
+  });
+
+  $('#featureweight-slider').Link('lower').to($('#input-featureweight'));
+
   $('input[name="algorithm"]:radio').change(function() {
-    if ($('input[name="algorithm"]:radio:checked').val() == 1) {
-      $('#phsmf-params').hide();
-      $('#gbs-params').show();
-    } else {
-      $('#phsmf-params').show();
-      $('#gbs-params').hide();
-    }
+    var algorithm = $('input[name="algorithm"]:radio:checked').val();
+    $('#gbs-params').toggle(algorithm == 'gbs');
+    $('#phsmf-params').toggle(algorithm == 'hmsf' || algorithm == 'phmsf');
+    $('#slic-params').toggle(algorithm == 'slic');
+    $('#segments-params').toggle(algorithm != 'slic');
+    $('#segments-params input').prop('disabled', algorithm == 'slic');
+  });
+
+  $('input[name="randomColors"]').change(function() {
+    $('#palette-params').toggle(this.checked);
   });
 
   $('#show-original').click(function() {
@@ -88,28 +189,112 @@ $(function() {
   $('#settings-form').submit(function() {
     $('#btn-run').attr('disabled', 'disabled');
     $('#btn-run').text('Segmenting');
+    showProgress({status: 'queued', progress: 0});
     $('#work-status').show();
     $.ajax({
       type: 'POST',
-      url: '/segment',
+      url: '/jobs',
       data: new FormData(this),
       processData: false,
       contentType: false,
-      success: function(data) {
-        data = data.split(' ');
-        var filename = data[0];
-        var originalext = data[1];
-        $('#btn-run').removeAttr('disabled');
-        $('#btn-run').text('Run');
-        $('#work-status').hide();
-        current_original = filename + originalext;
-        current_result  = 'new_' + filename + '.png';
-        $('#original-image').attr('src', '/tmp/' + current_original);
-        $('#result-image').attr('src', '/tmp/' + current_result);
-        changeImage('result', 'original');
+      success: function(job) {
+        followJob(job.id);
+      },
+      error: function(xhr) {
+        showError(xhr.responseJSON ? xhr.responseJSON.error.message : xhr.statusText);
+      }
+    });
+    return false;
+  });
+
+  /* Parameter sweeps, the sweep fields override the values of the form */
+  $('#btn-sweep').click(function() {
+    var form = new FormData($('#settings-form')[0]);
+    $('#sweep-params input').each(function() {
+      if ($(this).val() != '') {
+        form.set($(this).data('param'), $(this).val());
+      }
+    });
+    $('#btn-sweep').attr('disabled', 'disabled');
+    $.ajax({
+      type: 'POST',
+      url: '/api/v1/sweep',
+      data: form,
+      processData: false,
+      contentType: false,
+      success: function(sweep) {
+        $('#btn-sweep').removeAttr('disabled');
+        showResult(sweep.original, sweep.sheet);
+      },
+      error: function(xhr) {
+        $('#btn-sweep').removeAttr('disabled');
+        showError(xhr.responseJSON ? xhr.responseJSON.error.message : xhr.statusText);
       }
     });
+  });
+
+  /* Scribbles painted over the original image */
+
+  var scribbleColor = '#ff0000';
+  var painting = false;
+  var canvas = $('#scribbles-canvas')[0];
+  var context = canvas.getContext('2d');
+
+  $('#original-image').on('load', resetScribbles);
+
+  function paint(e) {
+    var rect = canvas.getBoundingClientRect();
+    var x = Math.round((e.clientX - rect.left) * canvas.width / rect.width);
+    var y = Math.round((e.clientY - rect.top) * canvas.height / rect.height);
+    context.fillStyle = scribbleColor;
+    context.fillRect(x - 2, y - 2, 5, 5);
+  }
+
+  $(canvas).mousedown(function(e) {
+    painting = true;
+    paint(e);
+  });
+
+  $(canvas).mousemove(function(e) {
+    if (painting) {
+      paint(e);
+    }
+  });
+
+  $(document).mouseup(function() {
+    painting = false;
+  });
+
+  $('.scribble-color').click(function() {
+    scribbleColor = $(this).data('color');
+    $('.scribble-color').addClass('btn-default').removeClass('btn-primary');
+    $(this).addClass('btn-primary').removeClass('btn-default');
     return false;
   });
 
+  $('#clear-scribbles').click(function() {
+    resetScribbles();
+    return false;
+  });
+
+  $('#btn-scribbles').click(function() {
+    var form = new FormData($('#settings-form')[0]);
+    $('#btn-scribbles').attr('disabled', 'disabled');
+    canvas.toBlob(function(blob) {
+      form.append('scribbles', blob, 'scribbles.png');
+      $.ajax({
+        type: 'POST',
+        url: '/segment/scribbles',
+        data: form,
+        processData: false,
+        contentType: false,
+        success: showTextResult,
+        error: function(xhr) {
+          $('#btn-scribbles').removeAttr('disabled');
+          showError(xhr.responseText || xhr.statusText);
+        }
+      });
+    }, 'image/png');
+  });
+
 });